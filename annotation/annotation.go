@@ -70,6 +70,7 @@ func (a *Annotator) Init() {
 					fl := <-ch
 
 					// Align timestamp on `aggrTime` raster
+					exportTime := fl.Timestamp
 					fl.Timestamp = fl.Timestamp - (fl.Timestamp % a.cfg.AggregationPeriod)
 
 					// Update global statstics
@@ -86,6 +87,15 @@ func (a *Annotator) Init() {
 						fl = tmpFlow
 					}
 
+					// Spread flow over all time slots it was active in
+					if a.spreadEnabled(fl) {
+						fl.Timestamp = exportTime
+						for _, part := range spread(fl, a.cfg.AggregationPeriod, a.maxAge()) {
+							a.output <- part
+						}
+						continue
+					}
+
 					// Send flow over to database module
 					a.output <- fl
 				}
@@ -0,0 +1,135 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotation
+
+import (
+	"net"
+
+	"github.com/bio-routing/tflow2/netflow"
+)
+
+// spreadEnabled checks if flows of the agent that exported `fl` are to be spread
+func (a *Annotator) spreadEnabled(fl *netflow.Flow) bool {
+	agent, ok := a.cfg.AgentsByIP[net.IP(fl.Router).String()]
+	if !ok {
+		return false
+	}
+
+	return agent.SpreadFlows
+}
+
+// maxAge returns the time in seconds flows are kept in memory
+func (a *Annotator) maxAge() int64 {
+	if a.cfg.CacheTime == nil {
+		return 0
+	}
+
+	return *a.cfg.CacheTime
+}
+
+// spread splits flow `fl` into one flow per aggregation period of `period` seconds the flow was active in.
+// Bytes and packets are distributed proportionally to the time the flow was active in each period.
+// `fl.Timestamp` is the export time of the flow. Flows are never spread further back than `maxAge` seconds.
+func spread(fl *netflow.Flow, period int64, maxAge int64) []*netflow.Flow {
+	start := int64(fl.FlowStart)
+	end := int64(fl.FlowEnd)
+	if start == 0 || end == 0 || end < start {
+		fl.Timestamp = align(fl.Timestamp, period)
+		return []*netflow.Flow{fl}
+	}
+
+	// A flow can not end after it has been exported
+	if exportTime := fl.Timestamp * 1000; end > exportTime {
+		end = exportTime
+	}
+
+	if maxAge > 0 && start < end-maxAge*1000 {
+		start = end - maxAge*1000
+	}
+
+	firstSlot := align(start/1000, period)
+	lastSlot := align(end/1000, period)
+	if firstSlot >= lastSlot {
+		fl.Timestamp = lastSlot
+		return []*netflow.Flow{fl}
+	}
+
+	shares := make([]int64, 0, (lastSlot-firstSlot)/period+1)
+	for slot := firstSlot; slot <= lastSlot; slot += period {
+		slotStart := max(start, slot*1000)
+		slotEnd := min(end, (slot+period)*1000)
+		shares = append(shares, slotEnd-slotStart)
+	}
+
+	duration := end - start
+	sizes := distribute(fl.Size, shares, duration)
+	packets := distribute(fl.Packets, shares, duration)
+	outBytes := distribute(fl.OutBytes, shares, duration)
+	outPkts := distribute(fl.OutPkts, shares, duration)
+
+	res := make([]*netflow.Flow, 0, len(shares))
+	for i := range shares {
+		if sizes[i] == 0 && packets[i] == 0 && outBytes[i] == 0 && outPkts[i] == 0 {
+			continue
+		}
+
+		part := *fl
+		part.Timestamp = firstSlot + int64(i)*period
+		part.Size = sizes[i]
+		part.Packets = packets[i]
+		part.OutBytes = outBytes[i]
+		part.OutPkts = outPkts[i]
+		res = append(res, &part)
+	}
+
+	return res
+}
+
+// distribute splits `total` into parts proportional to `shares` of `sum`.
+// Rounding errors are added to the last part so parts always add up to `total`.
+func distribute(total uint64, shares []int64, sum int64) []uint64 {
+	res := make([]uint64, len(shares))
+	if sum <= 0 {
+		res[len(res)-1] = total
+		return res
+	}
+
+	rest := total
+	for i := 0; i < len(shares)-1; i++ {
+		res[i] = uint64(float64(total) * float64(shares[i]) / float64(sum))
+		if res[i] > rest {
+			res[i] = rest
+		}
+		rest -= res[i]
+	}
+	res[len(res)-1] = rest
+
+	return res
+}
+
+func align(ts int64, period int64) int64 {
+	return ts - ts%period
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
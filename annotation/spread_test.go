@@ -0,0 +1,137 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotation
+
+import (
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpread(t *testing.T) {
+	type part struct {
+		ts      int64
+		size    uint64
+		packets uint64
+	}
+
+	tests := []struct {
+		name     string
+		flow     *netflow.Flow
+		maxAge   int64
+		expected []part
+	}{
+		{
+			name: "No start/end",
+			flow: &netflow.Flow{
+				Timestamp: 1000,
+				Size:      100,
+				Packets:   1,
+			},
+			expected: []part{{ts: 960, size: 100, packets: 1}},
+		},
+		{
+			name: "Single slot",
+			flow: &netflow.Flow{
+				Timestamp: 1000,
+				FlowStart: 961000,
+				FlowEnd:   990000,
+				Size:      100,
+				Packets:   1,
+			},
+			expected: []part{{ts: 960, size: 100, packets: 1}},
+		},
+		{
+			name: "Three slots",
+			flow: &netflow.Flow{
+				Timestamp: 1100,
+				FlowStart: 930000,
+				FlowEnd:   1050000,
+				Size:      1200,
+				Packets:   12,
+			},
+			expected: []part{
+				{ts: 900, size: 300, packets: 3},
+				{ts: 960, size: 600, packets: 6},
+				{ts: 1020, size: 300, packets: 3},
+			},
+		},
+		{
+			name: "End after export",
+			flow: &netflow.Flow{
+				Timestamp: 1020,
+				FlowStart: 990000,
+				FlowEnd:   1050000,
+				Size:      100,
+				Packets:   10,
+			},
+			expected: []part{{ts: 960, size: 100, packets: 10}},
+		},
+		{
+			name: "Start beyond max age",
+			flow: &netflow.Flow{
+				Timestamp: 1100,
+				FlowStart: 1000,
+				FlowEnd:   1080000,
+				Size:      120,
+				Packets:   2,
+			},
+			maxAge: 60,
+			expected: []part{
+				{ts: 1020, size: 120, packets: 2},
+			},
+		},
+		{
+			name: "Rounding",
+			flow: &netflow.Flow{
+				Timestamp: 1100,
+				FlowStart: 950000,
+				FlowEnd:   970000,
+				Size:      10,
+				Packets:   1,
+			},
+			expected: []part{
+				{ts: 900, size: 5, packets: 0},
+				{ts: 960, size: 5, packets: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		res := spread(test.flow, 60, test.maxAge)
+
+		parts := make([]part, 0, len(res))
+		for _, fl := range res {
+			parts = append(parts, part{ts: fl.Timestamp, size: fl.Size, packets: fl.Packets})
+		}
+		assert.Equal(t, test.expected, parts, test.name)
+	}
+}
+
+func TestSpreadEnabled(t *testing.T) {
+	a := &Annotator{
+		cfg: &config.Config{
+			AgentsByIP: map[string]*config.Agent{
+				"192.0.2.1": {
+					SpreadFlows: true,
+				},
+				"192.0.2.2": {},
+			},
+		},
+	}
+
+	assert.True(t, a.spreadEnabled(&netflow.Flow{Router: []byte{192, 0, 2, 1}}))
+	assert.False(t, a.spreadEnabled(&netflow.Flow{Router: []byte{192, 0, 2, 2}}))
+	assert.False(t, a.spreadEnabled(&netflow.Flow{Router: []byte{192, 0, 2, 3}}))
+}
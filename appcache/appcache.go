@@ -0,0 +1,59 @@
+// Package appcache caches the application tables (application ID to name) exporters send in options data records
+package appcache
+
+import (
+	"net"
+	"sync"
+)
+
+// AppCache caches the names of the applications of agents
+type AppCache struct {
+	names map[appKey]string
+	mu    sync.RWMutex
+}
+
+// appKey identifies an application of an agent
+type appKey struct {
+	agent string
+	id    string
+}
+
+// New creates a new AppCache
+func New() *AppCache {
+	return &AppCache{
+		names: make(map[appKey]string),
+	}
+}
+
+// Set sets the name of application `id` of `rtr`. A nil *AppCache caches nothing.
+func (c *AppCache) Set(rtr net.IP, id []byte, name string) {
+	if c == nil || len(id) == 0 || name == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.names[appKey{agent: key(rtr), id: string(id)}] = name
+}
+
+// Get gets the name of application `id` of `rtr`. It returns an empty string if the application is unknown.
+func (c *AppCache) Get(rtr net.IP, id []byte) string {
+	if c == nil || len(id) == 0 {
+		return ""
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.names[appKey{agent: key(rtr), id: string(id)}]
+}
+
+// key returns the cache key for `rtr`. IPv4 addresses are normalized to their 4 byte representation
+// so lookups work regardless of how the address was obtained.
+func key(rtr net.IP) string {
+	if addr := rtr.To4(); addr != nil {
+		return string(addr)
+	}
+	return string(rtr.To16())
+}
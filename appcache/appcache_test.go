@@ -0,0 +1,21 @@
+package appcache
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppCache(t *testing.T) {
+	c := New()
+	c.Set(net.IP{192, 0, 2, 1}, []byte{3, 0, 80}, "http")
+
+	assert.Equal(t, "http", c.Get(net.ParseIP("192.0.2.1"), []byte{3, 0, 80}))
+	assert.Equal(t, "", c.Get(net.ParseIP("192.0.2.1"), []byte{3, 1, 187}))
+	assert.Equal(t, "", c.Get(net.ParseIP("192.0.2.2"), []byte{3, 0, 80}))
+
+	var nilCache *AppCache
+	nilCache.Set(net.IP{192, 0, 2, 1}, []byte{3, 0, 80}, "http")
+	assert.Equal(t, "", nilCache.Get(net.IP{192, 0, 2, 1}, []byte{3, 0, 80}))
+}
@@ -376,6 +376,68 @@ func (root *TreeNode) intersection(b *TreeNode, res *TreeNode, n *int) *TreeNode
 	return res
 }
 
+// Union builds a tree of all elements of all trees in `candidates`
+func Union(candidates []*Tree) (res *Tree) {
+	res = New()
+	for _, t := range candidates {
+		if t == nil {
+			continue
+		}
+
+		t.lock.RLock()
+		t.root.union(res)
+		t.lock.RUnlock()
+	}
+
+	return res
+}
+
+// union recursively adds all elements of tree with root `root` missing in `res` to `res`
+func (root *TreeNode) union(res *Tree) {
+	if root == nil {
+		return
+	}
+
+	root.left.union(res)
+	root.right.union(res)
+	if !res.root.exists(root.key) {
+		res.root, _ = res.root.insert(root.key, root.key, root.issmaller)
+		res.Count++
+	}
+}
+
+// Difference builds a tree of all elements of tree `t` missing in tree `x`
+func (t *Tree) Difference(x *Tree) (res *Tree) {
+	if t == nil {
+		return nil
+	}
+
+	res = New()
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if x != nil {
+		x.lock.RLock()
+		defer x.lock.RUnlock()
+	}
+
+	t.root.difference(x, res)
+	return res
+}
+
+// difference recursively adds all elements of tree with root `root` missing in `x` to `res`
+func (root *TreeNode) difference(x *Tree, res *Tree) {
+	if root == nil {
+		return
+	}
+
+	root.left.difference(x, res)
+	root.right.difference(x, res)
+	if x == nil || !x.root.exists(root.key) {
+		res.root, _ = res.root.insert(root.key, root.key, root.issmaller)
+		res.Count++
+	}
+}
+
 // Each can be used to traverse tree `t` and call function f with params vals...
 // for each node in the tree
 func (t *Tree) Each(f EachFunc, vals ...interface{}) {
@@ -79,6 +79,59 @@ func TestIntersection(t *testing.T) {
 
 }
 
+func TestUnion(t *testing.T) {
+	valuesA := [...]int{20, 100, 50, 150, 15}
+	valuesB := [...]int{101, 51, 150, 20, 1}
+	valuesUnion := [...]int{1, 15, 20, 50, 51, 100, 101, 150}
+
+	treeA := New()
+	treeB := New()
+
+	for _, val := range valuesA {
+		treeA.Insert(val, val, testIsSmaller)
+	}
+
+	for _, val := range valuesB {
+		treeB.Insert(val, val, testIsSmaller)
+	}
+
+	res := Union([]*Tree{treeA, nil, treeB})
+	if res.Count != len(valuesUnion) {
+		t.Errorf("Expected %d elements in union, got %d\n", len(valuesUnion), res.Count)
+	}
+
+	if !sliceEq(res.Dump(), valuesUnion[:]) {
+		t.Errorf("Unexpected union: %v\n", res.Dump())
+	}
+}
+
+func TestDifference(t *testing.T) {
+	valuesA := [...]int{20, 100, 50, 150, 15}
+	valuesB := [...]int{101, 51, 150, 20, 1}
+	valuesDifference := [...]int{15, 50, 100}
+
+	treeA := New()
+	treeB := New()
+
+	for _, val := range valuesA {
+		treeA.Insert(val, val, testIsSmaller)
+	}
+
+	for _, val := range valuesB {
+		treeB.Insert(val, val, testIsSmaller)
+	}
+
+	res := treeA.Difference(treeB)
+	if !sliceEq(res.Dump(), valuesDifference[:]) {
+		t.Errorf("Unexpected difference: %v\n", res.Dump())
+	}
+
+	res = treeA.Difference(nil)
+	if res.Count != len(valuesA) {
+		t.Errorf("Expected %d elements in difference, got %d\n", len(valuesA), res.Count)
+	}
+}
+
 func TestNodeExists(t *testing.T) {
 	tests := []struct {
 		input int
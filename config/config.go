@@ -2,6 +2,7 @@ package config
 
 import (
 	"io/ioutil"
+	"net"
 
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
@@ -17,16 +18,28 @@ type Config struct {
 	DataDir                      string `yaml:"data_dir"`
 	Anonymize                    bool   `yaml:"anonymize"`
 	CacheTime                    *int64 `yaml:"cache_time"`
+	TemplateTimeout              *int64 `yaml:"template_timeout"`
 
+	NetflowV5       *Server     `yaml:"netflow_v5"`
 	NetflowV9       *Server     `yaml:"netflow_v9"`
 	IPFIX           *Server     `yaml:"ipfix"`
+	IPFIXTCP        *Server     `yaml:"ipfix_tcp"`
 	Sflow           *Server     `yaml:"sflow"`
 	Frontend        *Server     `yaml:"frontend"`
 	BGPAugmentation *BGPAugment `yaml:"bgp_augmentation"`
 	Agents          []Agent     `yaml:"agents"`
 	Annotators      []Annotator `yaml:"annotators"`
 
+	// AgentGroups maps names of agent groups to the names of their agents
+	AgentGroups map[string][]string `yaml:"agent_groups"`
+
+	// IPFIXFieldMapping maps flow fields to the names of IPFIX information elements carrying them
+	IPFIXFieldMapping map[string][]string `yaml:"ipfix_field_mapping"`
+
+	PendingSets *PendingSets `yaml:"pending_sets"`
+
 	AgentsNameByIP map[string]string
+	AgentsByIP     map[string]*Agent
 }
 
 // Annotator represents annotator configuration
@@ -42,6 +55,16 @@ type BGPAugment struct {
 	BIRD6Socket string `yaml:"bird6_socket"`
 }
 
+// PendingSets represents the configuration of the queue holding NetFlow v9/IPFIX data sets
+// received before their template
+type PendingSets struct {
+	// MaxSets is the maximum number of data sets held per agent, source ID and template ID (0 = disabled)
+	MaxSets *int `yaml:"max_sets"`
+
+	// MaxAge is the maximum time in seconds a data set is held
+	MaxAge int64 `yaml:"max_age"`
+}
+
 // Server represents a server config
 type Server struct {
 	Enabled *bool  `yaml:"enabled"`
@@ -54,8 +77,58 @@ type Agent struct {
 	IPAddress     string `yaml:"ip_address"`
 	SNMPCommunity string `yaml:"snmp_community"`
 	SampleRate    uint64 `yaml:"sample_rate"`
+	TunnelMode    string `yaml:"tunnel_mode"`
+	SpreadFlows   bool   `yaml:"spread_flows"`
+
+	// CompensateLoss scales up volumes by the loss of export packets measured using sequence numbers
+	CompensateLoss bool `yaml:"compensate_loss"`
+
+	// InterfaceSampleRates are samplerates of individual interfaces (by ifIndex) overriding SampleRate
+	InterfaceSampleRates map[uint32]uint64 `yaml:"interface_sample_rates"`
+
+	// CountDirection selects the direction (ingress, egress or both) of the flows that are counted
+	CountDirection string `yaml:"count_direction"`
+
+	// InterfaceCountDirections select the direction of the flows counted on individual interfaces (by ifIndex)
+	// overriding CountDirection. Ingress flows belong to their input interface, egress flows to their output interface.
+	InterfaceCountDirections map[uint32]string `yaml:"interface_count_directions"`
+}
+
+// CountsFlow checks if a flow observed on interface `ifIndex` in direction `egress` is to be counted
+func (a *Agent) CountsFlow(ifIndex uint32, egress bool) bool {
+	direction := a.CountDirection
+	if d, ok := a.InterfaceCountDirections[ifIndex]; ok {
+		direction = d
+	}
+
+	switch direction {
+	case DirectionIngress:
+		return !egress
+	case DirectionEgress:
+		return egress
+	}
+	return true
 }
 
+const (
+	// TunnelModeOuter uses the outermost IP header of tunneled packets
+	TunnelModeOuter = "outer"
+
+	// TunnelModeInner uses the innermost IP header of tunneled packets
+	TunnelModeInner = "inner"
+)
+
+const (
+	// DirectionIngress counts flows exported on ingress only
+	DirectionIngress = "ingress"
+
+	// DirectionEgress counts flows exported on egress only
+	DirectionEgress = "egress"
+
+	// DirectionBoth counts flows exported on ingress and egress
+	DirectionBoth = "both"
+)
+
 var (
 	dfltAggregationPeriod       = int64(60)
 	dftlIntfMapperRefreshPeriod = int64(30)
@@ -64,6 +137,15 @@ var (
 	dfltCompressionLevel        = 6
 	dfltDataDir                 = "data"
 	dfltCacheTime               = int64(1800)
+	dfltTemplateTimeout         = int64(5400)
+	dfltPendingMaxSets          = 100
+	dfltPendingMaxAge           = int64(60)
+
+	dfltNetflowV5Listen = ":2056"
+	dfltNetflowV5       = Server{
+		Enabled: boolPtr(false),
+		Listen:  dfltNetflowV5Listen,
+	}
 
 	dfltNetflowV9Listen = ":2055"
 	dfltNetflowV9       = Server{
@@ -79,6 +161,12 @@ var (
 		Listen:  dfltIPFIXListen,
 	}
 
+	dfltIPFIXTCPListen = ":4739"
+	dfltIPFIXTCP       = Server{
+		Enabled: boolPtr(false),
+		Listen:  dfltIPFIXTCPListen,
+	}
+
 	dfltSflowListen = ":6343"
 	dfltSflow       = Server{
 		Enabled: boolPtr(true),
@@ -115,16 +203,62 @@ func New(filename string) (*Config, error) {
 	cfg.defaults()
 
 	cfg.AgentsNameByIP = make(map[string]string)
-	for _, agent := range cfg.Agents {
-		if _, ok := cfg.AgentsNameByIP[agent.IPAddress]; ok {
+	cfg.AgentsByIP = make(map[string]*Agent)
+	for i, agent := range cfg.Agents {
+		addr := normalizeIP(agent.IPAddress)
+		if _, ok := cfg.AgentsNameByIP[addr]; ok {
 			return nil, errors.Errorf("Duplicate agent: %s", agent.Name)
 		}
-		cfg.AgentsNameByIP[agent.IPAddress] = agent.Name
+
+		if agent.TunnelMode != TunnelModeOuter && agent.TunnelMode != TunnelModeInner {
+			return nil, errors.Errorf("Invalid tunnel mode %q for agent %s", agent.TunnelMode, agent.Name)
+		}
+
+		if !validDirection(agent.CountDirection) {
+			return nil, errors.Errorf("Invalid count direction %q for agent %s", agent.CountDirection, agent.Name)
+		}
+		for ifIndex, direction := range agent.InterfaceCountDirections {
+			if !validDirection(direction) {
+				return nil, errors.Errorf("Invalid count direction %q for interface %d of agent %s", direction, ifIndex, agent.Name)
+			}
+		}
+
+		cfg.AgentsNameByIP[addr] = agent.Name
+		cfg.AgentsByIP[addr] = &cfg.Agents[i]
+	}
+
+	agentNames := make(map[string]struct{})
+	for _, agent := range cfg.Agents {
+		agentNames[agent.Name] = struct{}{}
+	}
+	for group, agents := range cfg.AgentGroups {
+		if _, ok := agentNames[group]; ok {
+			return nil, errors.Errorf("Agent group %s has the name of an agent", group)
+		}
+		for _, agent := range agents {
+			if _, ok := agentNames[agent]; !ok {
+				return nil, errors.Errorf("Unknown agent %s in agent group %s", agent, group)
+			}
+		}
 	}
 
 	return cfg, nil
 }
 
+func validDirection(direction string) bool {
+	return direction == DirectionIngress || direction == DirectionEgress || direction == DirectionBoth
+}
+
+// normalizeIP returns the canonical string representation of `addr` so it matches net.IP.String()
+// of addresses learned from the network (e.g. 2001:DB8:0::1 becomes 2001:db8::1)
+func normalizeIP(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	return ip.String()
+}
+
 func (cfg *Config) defaults() {
 	if cfg.AggregationPeriod == 0 {
 		cfg.AggregationPeriod = dfltAggregationPeriod
@@ -144,6 +278,29 @@ func (cfg *Config) defaults() {
 	if cfg.CacheTime == nil {
 		cfg.CacheTime = int64Ptr(dfltCacheTime)
 	}
+	if cfg.TemplateTimeout == nil {
+		cfg.TemplateTimeout = int64Ptr(dfltTemplateTimeout)
+	}
+
+	if cfg.PendingSets == nil {
+		cfg.PendingSets = &PendingSets{}
+	}
+	if cfg.PendingSets.MaxSets == nil {
+		cfg.PendingSets.MaxSets = intPtr(dfltPendingMaxSets)
+	}
+	if cfg.PendingSets.MaxAge == 0 {
+		cfg.PendingSets.MaxAge = dfltPendingMaxAge
+	}
+
+	if cfg.NetflowV5 == nil {
+		cfg.NetflowV5 = srvPtr(dfltNetflowV5)
+	}
+	if cfg.NetflowV5.Listen == "" {
+		cfg.NetflowV5.Listen = dfltNetflowV5Listen
+	}
+	if cfg.NetflowV5.Enabled == nil {
+		cfg.NetflowV5.Enabled = boolPtr(false)
+	}
 
 	if cfg.NetflowV9 == nil {
 		cfg.NetflowV9 = srvPtr(dfltNetflowV9)
@@ -165,6 +322,16 @@ func (cfg *Config) defaults() {
 		cfg.IPFIX.Enabled = dfltServerEnabled
 	}
 
+	if cfg.IPFIXTCP == nil {
+		cfg.IPFIXTCP = srvPtr(dfltIPFIXTCP)
+	}
+	if cfg.IPFIXTCP.Listen == "" {
+		cfg.IPFIXTCP.Listen = dfltIPFIXTCPListen
+	}
+	if cfg.IPFIXTCP.Enabled == nil {
+		cfg.IPFIXTCP.Enabled = boolPtr(false)
+	}
+
 	if cfg.Sflow == nil {
 		cfg.Sflow = srvPtr(dfltSflow)
 	}
@@ -203,6 +370,12 @@ func (cfg *Config) defaults() {
 			if agent.SampleRate == 0 {
 				cfg.Agents[key].SampleRate = dfltSampleRate
 			}
+			if agent.TunnelMode == "" {
+				cfg.Agents[key].TunnelMode = TunnelModeOuter
+			}
+			if agent.CountDirection == "" {
+				cfg.Agents[key].CountDirection = DirectionBoth
+			}
 		}
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/intfmapper"
 	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/packet"
 	"github.com/pkg/errors"
 
 	log "github.com/sirupsen/logrus"
@@ -22,41 +23,85 @@ type BreakdownMap map[BreakdownKey]uint64
 
 // BreakdownFlags defines by what fields data should be broken down in a query
 type BreakdownFlags struct {
-	Family     bool
-	SrcAddr    bool
-	DstAddr    bool
-	Protocol   bool
-	IntIn      bool
-	IntOut     bool
-	NextHop    bool
-	SrcAsn     bool
-	DstAsn     bool
-	NextHopAsn bool
-	SrcPfx     bool
-	DstPfx     bool
-	SrcPort    bool
-	DstPort    bool
-	IntInName  bool
-	IntOutName bool
+	Family           bool
+	SrcAddr          bool
+	DstAddr          bool
+	Protocol         bool
+	IntIn            bool
+	IntOut           bool
+	NextHop          bool
+	SrcAsn           bool
+	DstAsn           bool
+	NextHopAsn       bool
+	SrcPfx           bool
+	DstPfx           bool
+	SrcPort          bool
+	DstPort          bool
+	IntInName        bool
+	IntOutName       bool
+	TCPFlags         bool
+	Tos              bool
+	Dscp             bool
+	IcmpType         bool
+	IcmpCode         bool
+	SrcVlan          bool
+	DstVlan          bool
+	SrcMac           bool
+	DstMac           bool
+	MplsLabel1       bool
+	MplsLabel2       bool
+	MplsLabel3       bool
+	MplsTopLabelAddr bool
+	FwdStatus        bool
+	DropReason       bool
+	PostNATSrcAddr   bool
+	PostNATDstAddr   bool
+	PostNAPTSrcPort  bool
+	PostNAPTDstPort  bool
+	NatEvent         bool
+	Application      bool
+	Agent            bool
 }
 
 var breakdownLabels = map[int]string{
-	FieldFamily:     "Family",
-	FieldSrcAddr:    "SrcAddr",
-	FieldDstAddr:    "DstAddr",
-	FieldProtocol:   "Protocol",
-	FieldIntIn:      "IntIn",
-	FieldIntOut:     "IntOut",
-	FieldNextHop:    "NextHop",
-	FieldSrcAs:      "SrcAsn",
-	FieldDstAs:      "DstAsn",
-	FieldNextHopAs:  "NextHopAsn",
-	FieldSrcPfx:     "SrcPfx",
-	FieldDstPfx:     "DstPfx",
-	FieldSrcPort:    "SrcPort",
-	FieldDstPort:    "DstPort",
-	FieldIntInName:  "IntInName",
-	FieldIntOutName: "IntOutName",
+	FieldFamily:           "Family",
+	FieldSrcAddr:          "SrcAddr",
+	FieldDstAddr:          "DstAddr",
+	FieldProtocol:         "Protocol",
+	FieldIntIn:            "IntIn",
+	FieldIntOut:           "IntOut",
+	FieldNextHop:          "NextHop",
+	FieldSrcAs:            "SrcAsn",
+	FieldDstAs:            "DstAsn",
+	FieldNextHopAs:        "NextHopAsn",
+	FieldSrcPfx:           "SrcPfx",
+	FieldDstPfx:           "DstPfx",
+	FieldSrcPort:          "SrcPort",
+	FieldDstPort:          "DstPort",
+	FieldIntInName:        "IntInName",
+	FieldIntOutName:       "IntOutName",
+	FieldTCPFlags:         "TCPFlags",
+	FieldTos:              "Tos",
+	FieldDscp:             "Dscp",
+	FieldIcmpType:         "IcmpType",
+	FieldIcmpCode:         "IcmpCode",
+	FieldSrcVlan:          "SrcVlan",
+	FieldDstVlan:          "DstVlan",
+	FieldSrcMac:           "SrcMac",
+	FieldDstMac:           "DstMac",
+	FieldMplsLabel1:       "MplsLabel1",
+	FieldMplsLabel2:       "MplsLabel2",
+	FieldMplsLabel3:       "MplsLabel3",
+	FieldMplsTopLabelAddr: "MplsTopLabelAddr",
+	FieldFwdStatus:        "FwdStatus",
+	FieldDropReason:       "DropReason",
+	FieldPostNATSrcAddr:   "PostNATSrcAddr",
+	FieldPostNATDstAddr:   "PostNATDstAddr",
+	FieldPostNAPTSrcPort:  "PostNAPTSrcPort",
+	FieldPostNAPTDstPort:  "PostNAPTDstPort",
+	FieldNatEvent:         "NatEvent",
+	FieldApplication:      "Application",
+	FieldAgent:            "Agent",
 }
 
 // GetBreakdownLabels returns a sorted list of known breakdown labels
@@ -78,6 +123,28 @@ func GetBreakdownLabels() []string {
 		breakdownLabels[FieldDstPort],
 		breakdownLabels[FieldIntInName],
 		breakdownLabels[FieldIntOutName],
+		breakdownLabels[FieldTCPFlags],
+		breakdownLabels[FieldTos],
+		breakdownLabels[FieldDscp],
+		breakdownLabels[FieldIcmpType],
+		breakdownLabels[FieldIcmpCode],
+		breakdownLabels[FieldSrcVlan],
+		breakdownLabels[FieldDstVlan],
+		breakdownLabels[FieldSrcMac],
+		breakdownLabels[FieldDstMac],
+		breakdownLabels[FieldMplsLabel1],
+		breakdownLabels[FieldMplsLabel2],
+		breakdownLabels[FieldMplsLabel3],
+		breakdownLabels[FieldMplsTopLabelAddr],
+		breakdownLabels[FieldFwdStatus],
+		breakdownLabels[FieldDropReason],
+		breakdownLabels[FieldPostNATSrcAddr],
+		breakdownLabels[FieldPostNATDstAddr],
+		breakdownLabels[FieldPostNAPTSrcPort],
+		breakdownLabels[FieldPostNAPTDstPort],
+		breakdownLabels[FieldNatEvent],
+		breakdownLabels[FieldApplication],
+		breakdownLabels[FieldAgent],
 	}
 }
 
@@ -133,6 +200,50 @@ func (bf *BreakdownFlags) Set(keys []string) error {
 			bf.IntInName = true
 		case breakdownLabels[FieldIntOutName]:
 			bf.IntOutName = true
+		case breakdownLabels[FieldTCPFlags]:
+			bf.TCPFlags = true
+		case breakdownLabels[FieldTos]:
+			bf.Tos = true
+		case breakdownLabels[FieldDscp]:
+			bf.Dscp = true
+		case breakdownLabels[FieldIcmpType]:
+			bf.IcmpType = true
+		case breakdownLabels[FieldIcmpCode]:
+			bf.IcmpCode = true
+		case breakdownLabels[FieldSrcVlan]:
+			bf.SrcVlan = true
+		case breakdownLabels[FieldDstVlan]:
+			bf.DstVlan = true
+		case breakdownLabels[FieldSrcMac]:
+			bf.SrcMac = true
+		case breakdownLabels[FieldDstMac]:
+			bf.DstMac = true
+		case breakdownLabels[FieldMplsLabel1]:
+			bf.MplsLabel1 = true
+		case breakdownLabels[FieldMplsLabel2]:
+			bf.MplsLabel2 = true
+		case breakdownLabels[FieldMplsLabel3]:
+			bf.MplsLabel3 = true
+		case breakdownLabels[FieldMplsTopLabelAddr]:
+			bf.MplsTopLabelAddr = true
+		case breakdownLabels[FieldFwdStatus]:
+			bf.FwdStatus = true
+		case breakdownLabels[FieldDropReason]:
+			bf.DropReason = true
+		case breakdownLabels[FieldPostNATSrcAddr]:
+			bf.PostNATSrcAddr = true
+		case breakdownLabels[FieldPostNATDstAddr]:
+			bf.PostNATDstAddr = true
+		case breakdownLabels[FieldPostNAPTSrcPort]:
+			bf.PostNAPTSrcPort = true
+		case breakdownLabels[FieldPostNAPTDstPort]:
+			bf.PostNAPTDstPort = true
+		case breakdownLabels[FieldNatEvent]:
+			bf.NatEvent = true
+		case breakdownLabels[FieldApplication]:
+			bf.Application = true
+		case breakdownLabels[FieldAgent]:
+			bf.Agent = true
 
 		default:
 			return errors.Errorf("invalid breakdown key: %s", key)
@@ -192,6 +303,72 @@ func (bf *BreakdownFlags) Count() (count int) {
 	if bf.IntOutName {
 		count++
 	}
+	if bf.TCPFlags {
+		count++
+	}
+	if bf.Tos {
+		count++
+	}
+	if bf.Dscp {
+		count++
+	}
+	if bf.IcmpType {
+		count++
+	}
+	if bf.IcmpCode {
+		count++
+	}
+	if bf.SrcVlan {
+		count++
+	}
+	if bf.DstVlan {
+		count++
+	}
+	if bf.SrcMac {
+		count++
+	}
+	if bf.DstMac {
+		count++
+	}
+	if bf.MplsLabel1 {
+		count++
+	}
+	if bf.MplsLabel2 {
+		count++
+	}
+	if bf.MplsLabel3 {
+		count++
+	}
+	if bf.MplsTopLabelAddr {
+		count++
+	}
+	if bf.FwdStatus {
+		count++
+	}
+	if bf.DropReason {
+		count++
+	}
+	if bf.PostNATSrcAddr {
+		count++
+	}
+	if bf.PostNATDstAddr {
+		count++
+	}
+	if bf.PostNAPTSrcPort {
+		count++
+	}
+	if bf.PostNAPTDstPort {
+		count++
+	}
+	if bf.NatEvent {
+		count++
+	}
+	if bf.Application {
+		count++
+	}
+	if bf.Agent {
+		count++
+	}
 
 	return
 }
@@ -207,8 +384,8 @@ func breakdown(node *avltree.TreeNode, vals ...interface{}) {
 	intfMap := vals[0].(intfmapper.InterfaceNameByID)
 	iana := vals[1].(*iana.IANA)
 	bd := vals[2].(BreakdownFlags)
-	sums := vals[3].(*concurrentResSum)
-	buckets := vals[4].(BreakdownMap)
+	agent := vals[3].(string)
+	buckets := vals[4].(counterMap)
 
 	for _, flow := range node.Values {
 		fl := flow.(*netflow.Flow)
@@ -286,13 +463,97 @@ func breakdown(node *avltree.TreeNode, vals ...interface{}) {
 		if bd.DstPort {
 			key[FieldDstPort] = fmt.Sprintf("%d", fl.DstPort)
 		}
+		if bd.TCPFlags {
+			key[FieldTCPFlags] = packet.TCPFlagsString(uint16(fl.TcpFlags))
+		}
+		if bd.Tos {
+			key[FieldTos] = fmt.Sprintf("%d", fl.Tos)
+		}
+		if bd.Dscp {
+			key[FieldDscp] = fmt.Sprintf("%d", fl.Tos>>2)
+		}
+		if bd.IcmpType {
+			key[FieldIcmpType] = fmt.Sprintf("%d", fl.IcmpType)
+		}
+		if bd.IcmpCode {
+			key[FieldIcmpCode] = fmt.Sprintf("%d", fl.IcmpCode)
+		}
+		if bd.SrcVlan {
+			key[FieldSrcVlan] = fmt.Sprintf("%d", fl.SrcVlan)
+		}
+		if bd.DstVlan {
+			key[FieldDstVlan] = fmt.Sprintf("%d", fl.DstVlan)
+		}
+		if bd.SrcMac {
+			key[FieldSrcMac] = net.HardwareAddr(fl.SrcMac).String()
+		}
+		if bd.DstMac {
+			key[FieldDstMac] = net.HardwareAddr(fl.DstMac).String()
+		}
+		if bd.MplsLabel1 {
+			key[FieldMplsLabel1] = fmt.Sprintf("%d", fl.MplsLabel1)
+		}
+		if bd.MplsLabel2 {
+			key[FieldMplsLabel2] = fmt.Sprintf("%d", fl.MplsLabel2)
+		}
+		if bd.MplsLabel3 {
+			key[FieldMplsLabel3] = fmt.Sprintf("%d", fl.MplsLabel3)
+		}
+		if bd.MplsTopLabelAddr {
+			key[FieldMplsTopLabelAddr] = net.IP(fl.MplsTopLabelAddr).String()
+		}
+		if bd.FwdStatus {
+			key[FieldFwdStatus] = fwdStatusKey(fl.ForwardingStatus)
+		}
+		if bd.DropReason {
+			key[FieldDropReason] = dropReasonKey(fl.ForwardingStatus)
+		}
+		if bd.PostNATSrcAddr {
+			key[FieldPostNATSrcAddr] = net.IP(fl.PostNatSrcAddr).String()
+		}
+		if bd.PostNATDstAddr {
+			key[FieldPostNATDstAddr] = net.IP(fl.PostNatDstAddr).String()
+		}
+		if bd.PostNAPTSrcPort {
+			key[FieldPostNAPTSrcPort] = fmt.Sprintf("%d", fl.PostNaptSrcPort)
+		}
+		if bd.PostNAPTDstPort {
+			key[FieldPostNAPTDstPort] = fmt.Sprintf("%d", fl.PostNaptDstPort)
+		}
+		if bd.NatEvent {
+			key[FieldNatEvent] = natEventKey(fl.NatEvent)
+		}
+		if bd.Application {
+			key[FieldApplication] = fl.Application()
+		}
 
-		// Build sum for key
-		buckets[key] += fl.Size * fl.Samplerate
+		if bd.Agent {
+			key[FieldAgent] = agent
+		}
 
-		// Build overall sum
-		sums.Lock.Lock()
-		sums.Values[key] += fl.Size * fl.Samplerate
-		sums.Lock.Unlock()
+		// Build sums for key
+		c := buckets[key]
+		c.bytes += fl.Size * fl.Samplerate
+		c.packets += fl.Packets * fl.Samplerate
+		c.flows++
+		buckets[key] = c
 	}
 }
+
+// fwdStatusKey returns the name of the class (forwarded, dropped, consumed) of forwarding status `status`
+func fwdStatusKey(status uint32) string {
+	return iana.FwdStatusClassName(iana.FwdStatusClass(uint8(status)))
+}
+
+// dropReasonKey returns the name of the reason code of forwarding status `status` if the flow was dropped
+func dropReasonKey(status uint32) string {
+	if iana.FwdStatusClass(uint8(status)) != iana.FwdStatusDropped {
+		return "Not dropped"
+	}
+	return iana.FwdStatusReasonName(uint8(status))
+}
+
+// natEventKey returns the name of NAT event `event`
+func natEventKey(event uint32) string {
+	return iana.NatEventName(uint8(event))
+}
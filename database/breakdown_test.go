@@ -23,7 +23,7 @@ func TestBreakdownKeyString(t *testing.T) {
 	for i := range breakdownLabels {
 		key[i] = strconv.Itoa(i)
 	}
-	assert.Equal("Family:2,SrcAddr:3,DstAddr:4,Protocol:5,IntIn:6,IntOut:7,NextHop:8,SrcAsn:9,DstAsn:10,NextHopAsn:11,SrcPfx:12,DstPfx:13,SrcPort:14,DstPort:15,IntInName:16,IntOutName:17", key.Join("%s:%s"))
+	assert.Equal("Agent:1,Family:2,SrcAddr:3,DstAddr:4,Protocol:5,IntIn:6,IntOut:7,NextHop:8,SrcAsn:9,DstAsn:10,NextHopAsn:11,SrcPfx:12,DstPfx:13,SrcPort:14,DstPort:15,IntInName:16,IntOutName:17,TCPFlags:18,Tos:19,Dscp:20,IcmpType:21,IcmpCode:22,SrcVlan:23,DstVlan:24,SrcMac:25,DstMac:26,MplsLabel1:27,MplsLabel2:28,MplsLabel3:29,MplsTopLabelAddr:30,FwdStatus:31,DropReason:32,PostNATSrcAddr:33,PostNATDstAddr:34,PostNAPTSrcPort:35,PostNAPTDstPort:36,NatEvent:37,Application:38", key.Join("%s:%s"))
 }
 
 func TestBreakdownFlags(t *testing.T) {
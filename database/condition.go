@@ -0,0 +1,195 @@
+package database
+
+import (
+	"net"
+
+	"github.com/bio-routing/tflow2/avltree"
+	"github.com/bio-routing/tflow2/iana"
+	"github.com/bio-routing/tflow2/intfmapper"
+	"github.com/bio-routing/tflow2/netflow"
+)
+
+// preparedCondition is a condition with its operand converted into the keys flows are indexed by
+type preparedCondition struct {
+	field    int
+	operator int
+	keys     []string
+	pfx      *net.IPNet
+}
+
+// prepareConditions prepares the conditions in `conds` that filter flows
+func prepareConditions(conds Conditions, interfaceIDByName intfmapper.InterfaceIDByName) []preparedCondition {
+	res := make([]preparedCondition, 0, len(conds))
+	for _, c := range conds {
+		if c.Field == FieldTimestamp || c.Field == FieldAgent {
+			continue
+		}
+		res = append(res, prepareCondition(c, interfaceIDByName))
+	}
+	return res
+}
+
+// prepareCondition converts the operand of condition `c` into index keys. Conditions on interface names
+// are converted into conditions on interface IDs.
+func prepareCondition(c Condition, interfaceIDByName intfmapper.InterfaceIDByName) preparedCondition {
+	pc := preparedCondition{
+		field:    c.Field,
+		operator: c.Operator,
+	}
+
+	switch c.Field {
+	case FieldIntInName:
+		pc.field = FieldIntIn
+	case FieldIntOutName:
+		pc.field = FieldIntOut
+	}
+
+	switch c.Operator {
+	case OpRange:
+		// Operand holds the lower and the upper bound of equal length
+		n := len(c.Operand) / 2
+		pc.keys = []string{
+			operandKey(c.Field, c.Operand[:n], interfaceIDByName),
+			operandKey(c.Field, c.Operand[n:], interfaceIDByName),
+		}
+	case OpWithin:
+		// Operand holds the address and the mask of a prefix of equal length
+		n := len(c.Operand) / 2
+		pc.pfx = &net.IPNet{
+			IP:   net.IP(c.Operand[:n]),
+			Mask: net.IPMask(c.Operand[n:]),
+		}
+	default:
+		pc.keys = []string{operandKey(c.Field, c.Operand, interfaceIDByName)}
+	}
+
+	return pc
+}
+
+// operandKey converts operand `operand` of a condition on field `field` into the key flows are indexed by
+func operandKey(field int, operand []byte, interfaceIDByName intfmapper.InterfaceIDByName) string {
+	switch field {
+	case FieldSrcAddr, FieldDstAddr, FieldNextHop, FieldMplsTopLabelAddr, FieldPostNATSrcAddr, FieldPostNATDstAddr:
+		return createKey(net.IP(operand))
+	case FieldIntInName, FieldIntOutName:
+		return createKey(interfaceIDByName[string(operand)])
+	}
+
+	// Numeric operands are encoded big endian in the width of the field like the keys
+	return string(operand)
+}
+
+// matches checks if index key `key` fulfills condition `pc`. Keys are compared bytewise, so
+// ordering operators only match keys of the same length (e.g. addresses of the same family).
+func (pc *preparedCondition) matches(key string) bool {
+	switch pc.operator {
+	case OpEqual:
+		return key == pc.keys[0]
+	case OpUnequal:
+		return key != pc.keys[0]
+	case OpSmaller:
+		return len(key) == len(pc.keys[0]) && key < pc.keys[0]
+	case OpGreater:
+		return len(key) == len(pc.keys[0]) && key > pc.keys[0]
+	case OpRange:
+		return len(key) == len(pc.keys[0]) && pc.keys[0] <= key && key <= pc.keys[1]
+	case OpWithin:
+		return len(key) > 0 && pc.pfx.Contains(net.IP(key))
+	}
+	return false
+}
+
+// lookup returns a tree of all flows in index `index` fulfilling condition `pc`. Equality conditions are
+// looked up directly, others are matched against all keys of the index.
+func (pc *preparedCondition) lookup(index *mapTree) *avltree.Tree {
+	if pc.operator == OpEqual {
+		return index.Get(pc.keys[0])
+	}
+	return index.Filter(pc.matches)
+}
+
+// indexKey returns the key flow `fl` is indexed by for field `field`.
+// It returns false if the field is not indexed.
+func indexKey(fl *netflow.Flow, field int) (string, bool) {
+	switch field {
+	case FieldFamily:
+		return createKey(uint16(fl.Family)), true
+	case FieldSrcAddr:
+		return createKey(net.IP(fl.SrcAddr)), true
+	case FieldDstAddr:
+		return createKey(net.IP(fl.DstAddr)), true
+	case FieldProtocol:
+		return createKey(byte(fl.Protocol)), true
+	case FieldIntIn:
+		return createKey(uint16(fl.IntIn)), true
+	case FieldIntOut:
+		return createKey(uint16(fl.IntOut)), true
+	case FieldNextHop:
+		return createKey(net.IP(fl.NextHop)), true
+	case FieldSrcAs:
+		return createKey(fl.SrcAs), true
+	case FieldDstAs:
+		return createKey(fl.DstAs), true
+	case FieldNextHopAs:
+		return createKey(fl.NextHopAs), true
+	case FieldSrcPfx:
+		return pfxKey(fl.SrcPfx), true
+	case FieldDstPfx:
+		return pfxKey(fl.DstPfx), true
+	case FieldSrcPort:
+		return createKey(uint16(fl.SrcPort)), true
+	case FieldDstPort:
+		return createKey(uint16(fl.DstPort)), true
+	case FieldTCPFlags:
+		return createKey(uint16(fl.TcpFlags)), true
+	case FieldTos:
+		return createKey(byte(fl.Tos)), true
+	case FieldDscp:
+		return createKey(byte(fl.Tos >> 2)), true
+	case FieldIcmpType:
+		return createKey(byte(fl.IcmpType)), true
+	case FieldIcmpCode:
+		return createKey(byte(fl.IcmpCode)), true
+	case FieldSrcVlan:
+		return createKey(uint16(fl.SrcVlan)), true
+	case FieldDstVlan:
+		return createKey(uint16(fl.DstVlan)), true
+	case FieldSrcMac:
+		return createKey(fl.SrcMac), true
+	case FieldDstMac:
+		return createKey(fl.DstMac), true
+	case FieldMplsLabel1:
+		return createKey(fl.MplsLabel1), true
+	case FieldMplsLabel2:
+		return createKey(fl.MplsLabel2), true
+	case FieldMplsLabel3:
+		return createKey(fl.MplsLabel3), true
+	case FieldMplsTopLabelAddr:
+		return createKey(net.IP(fl.MplsTopLabelAddr)), true
+	case FieldFwdStatus:
+		return createKey(iana.FwdStatusClass(uint8(fl.ForwardingStatus))), true
+	case FieldDropReason:
+		return createKey(uint8(fl.ForwardingStatus)), true
+	case FieldPostNATSrcAddr:
+		return createKey(net.IP(fl.PostNatSrcAddr)), true
+	case FieldPostNATDstAddr:
+		return createKey(net.IP(fl.PostNatDstAddr)), true
+	case FieldPostNAPTSrcPort:
+		return createKey(uint16(fl.PostNaptSrcPort)), true
+	case FieldPostNAPTDstPort:
+		return createKey(uint16(fl.PostNaptDstPort)), true
+	case FieldNatEvent:
+		return createKey(uint8(fl.NatEvent)), true
+	case FieldApplication:
+		return fl.Application(), true
+	}
+	return "", false
+}
+
+// pfxKey returns the key flows are indexed by for prefix `pfx`
+func pfxKey(pfx *netflow.Pfx) string {
+	if pfx == nil {
+		return "0.0.0.0/0"
+	}
+	return pfx.ToIPNet().String()
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/intfmapper"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFlow(t *testing.T) {
+	fl := &netflow.Flow{
+		SrcAddr:  []byte{10, 1, 2, 3},
+		DstAddr:  net.ParseIP("2001:db8::1"),
+		Protocol: 6,
+		IntIn:    2,
+		SrcPort:  12345,
+		DstPort:  443,
+		SrcAs:    100,
+		SrcPfx: &netflow.Pfx{
+			IP:   []byte{10, 0, 0, 0},
+			Mask: []byte{255, 0, 0, 0},
+		},
+	}
+	interfaceIDByName := intfmapper.InterfaceIDByName{
+		"xe-0/0/1": 1,
+		"xe-0/0/2": 2,
+	}
+
+	tests := []struct {
+		name     string
+		cond     Condition
+		expected bool
+	}{
+		{
+			name:     "Equal",
+			cond:     Condition{Field: FieldDstPort, Operator: OpEqual, Operand: convert.Uint16Byte(443)},
+			expected: true,
+		},
+		{
+			name:     "Unequal",
+			cond:     Condition{Field: FieldDstPort, Operator: OpUnequal, Operand: convert.Uint16Byte(443)},
+			expected: false,
+		},
+		{
+			name:     "Greater",
+			cond:     Condition{Field: FieldSrcPort, Operator: OpGreater, Operand: convert.Uint16Byte(1023)},
+			expected: true,
+		},
+		{
+			name:     "Smaller",
+			cond:     Condition{Field: FieldSrcAs, Operator: OpSmaller, Operand: convert.Uint32Byte(100)},
+			expected: false,
+		},
+		{
+			name:     "Range",
+			cond:     Condition{Field: FieldSrcPort, Operator: OpRange, Operand: append(convert.Uint16Byte(1024), convert.Uint16Byte(65535)...)},
+			expected: true,
+		},
+		{
+			name:     "Range excluded",
+			cond:     Condition{Field: FieldDstPort, Operator: OpRange, Operand: append(convert.Uint16Byte(1024), convert.Uint16Byte(65535)...)},
+			expected: false,
+		},
+		{
+			name:     "Within",
+			cond:     Condition{Field: FieldSrcAddr, Operator: OpWithin, Operand: []byte{10, 0, 0, 0, 255, 0, 0, 0}},
+			expected: true,
+		},
+		{
+			name:     "Not within",
+			cond:     Condition{Field: FieldSrcAddr, Operator: OpWithin, Operand: []byte{192, 168, 0, 0, 255, 255, 0, 0}},
+			expected: false,
+		},
+		{
+			name:     "Address family mismatch",
+			cond:     Condition{Field: FieldDstAddr, Operator: OpGreater, Operand: []byte{1, 2, 3, 4}},
+			expected: false,
+		},
+		{
+			name:     "Interface name",
+			cond:     Condition{Field: FieldIntInName, Operator: OpEqual, Operand: []byte("xe-0/0/2")},
+			expected: true,
+		},
+		{
+			name:     "Prefix",
+			cond:     Condition{Field: FieldSrcPfx, Operator: OpEqual, Operand: []byte("10.0.0.0/8")},
+			expected: true,
+		},
+		{
+			name:     "Timestamp and agent are ignored",
+			cond:     Condition{Field: FieldAgent, Operator: OpEqual, Operand: []byte("foo")},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		conds := prepareConditions(Conditions{test.cond}, interfaceIDByName)
+		assert.Equal(t, test.expected, validateFlow(fl, conds), test.name)
+	}
+}
@@ -42,6 +42,9 @@ type FlowDatabase struct {
 	maxAge         int64
 	aggregation    int64
 	lastDump       int64
+	dumpedUntil    int64
+	redump         map[int64]map[string]struct{}
+	redumpLock     sync.Mutex
 	compLevel      int
 	samplerate     int
 	storage        string
@@ -66,6 +69,7 @@ func New(aggregation int64, maxAge int64, numAddWorker int, debug int, compLevel
 		storage:        storage,
 		debug:          debug,
 		flows:          make(FlowsByTimeRtr),
+		redump:         make(map[int64]map[string]struct{}),
 		anonymize:      anonymize,
 		intfMapper:     intfMapper,
 		agentsNameByIP: agentsNameByIP,
@@ -119,6 +123,7 @@ func (fdb *FlowDatabase) getTimeGroup(fl *netflow.Flow, rtr string) *TimeGroup {
 	if !ok {
 		timeGroup = &TimeGroup{
 			Any:               newMapTree(),
+			Family:            newMapTree(),
 			SrcAddr:           newMapTree(),
 			DstAddr:           newMapTree(),
 			Protocol:          newMapTree(),
@@ -132,6 +137,27 @@ func (fdb *FlowDatabase) getTimeGroup(fl *netflow.Flow, rtr string) *TimeGroup {
 			DstPfx:            newMapTree(),
 			SrcPort:           newMapTree(),
 			DstPort:           newMapTree(),
+			TCPFlags:          newMapTree(),
+			Tos:               newMapTree(),
+			Dscp:              newMapTree(),
+			IcmpType:          newMapTree(),
+			IcmpCode:          newMapTree(),
+			SrcVlan:           newMapTree(),
+			DstVlan:           newMapTree(),
+			SrcMac:            newMapTree(),
+			DstMac:            newMapTree(),
+			MplsLabel1:        newMapTree(),
+			MplsLabel2:        newMapTree(),
+			MplsLabel3:        newMapTree(),
+			MplsTopLabelAddr:  newMapTree(),
+			FwdStatus:         newMapTree(),
+			DropReason:        newMapTree(),
+			PostNATSrcAddr:    newMapTree(),
+			PostNATDstAddr:    newMapTree(),
+			PostNAPTSrcPort:   newMapTree(),
+			PostNAPTDstPort:   newMapTree(),
+			NatEvent:          newMapTree(),
+			Application:       newMapTree(),
 			InterfaceIDByName: fdb.intfMapper.GetInterfaceIDByName(rtr),
 		}
 		flows[rtr] = timeGroup
@@ -162,19 +188,31 @@ func (fdb *FlowDatabase) Add(fl *netflow.Flow) {
 
 	// Insert into indices
 	timeGroup.Any.Insert(anyIndex, fl)
-	timeGroup.SrcAddr.Insert(net.IP(fl.SrcAddr), fl)
-	timeGroup.DstAddr.Insert(net.IP(fl.DstAddr), fl)
-	timeGroup.Protocol.Insert(byte(fl.Protocol), fl)
-	timeGroup.IntIn.Insert(uint16(fl.IntIn), fl)
-	timeGroup.IntOut.Insert(uint16(fl.IntOut), fl)
-	timeGroup.NextHop.Insert(net.IP(fl.NextHop), fl)
-	timeGroup.SrcAs.Insert(fl.SrcAs, fl)
-	timeGroup.DstAs.Insert(fl.DstAs, fl)
-	timeGroup.NextHopAs.Insert(fl.NextHopAs, fl)
-	timeGroup.SrcPfx.Insert(fl.SrcPfx.String(), fl)
-	timeGroup.DstPfx.Insert(fl.DstPfx.String(), fl)
-	timeGroup.SrcPort.Insert(fl.SrcPort, fl)
-	timeGroup.DstPort.Insert(fl.DstPort, fl)
+	for field := 0; field < FieldMax; field++ {
+		index := timeGroup.index(field)
+		if index == nil {
+			continue
+		}
+
+		key, _ := indexKey(fl, field)
+		index.Insert(key, fl)
+	}
+
+	// Flows arriving late (e.g. parts of spread flows) must not get lost for time slots already on disk
+	if fdb.storage != "" && fl.Timestamp <= atomic.LoadInt64(&fdb.dumpedUntil) {
+		fdb.markRedump(fl.Timestamp, rtrName)
+	}
+}
+
+// markRedump marks the time group of `router` at `ts` to be dumped to disk again
+func (fdb *FlowDatabase) markRedump(ts int64, router string) {
+	fdb.redumpLock.Lock()
+	defer fdb.redumpLock.Unlock()
+
+	if _, ok := fdb.redump[ts]; !ok {
+		fdb.redump[ts] = make(map[string]struct{})
+	}
+	fdb.redump[ts][router] = struct{}{}
 }
 
 // CurrentTimeslot returns the beginning of the current timeslot
@@ -209,6 +247,27 @@ func (fdb *FlowDatabase) Dumper() {
 	min := atomic.LoadInt64(&fdb.lastDump)
 	max := fdb.CurrentTimeslot() - 2*fdb.aggregation
 	atomic.StoreInt64(&fdb.lastDump, max)
+	if max > atomic.LoadInt64(&fdb.dumpedUntil) {
+		atomic.StoreInt64(&fdb.dumpedUntil, max)
+	}
+
+	// Dump time groups again that received flows after they had been dumped
+	fdb.redumpLock.Lock()
+	redump := fdb.redump
+	fdb.redump = make(map[int64]map[string]struct{})
+	fdb.redumpLock.Unlock()
+
+	for ts, routers := range redump {
+		if ts >= min && ts <= max {
+			continue
+		}
+		for router := range routers {
+			if fdb.flows[ts][router] == nil {
+				continue
+			}
+			go fdb.dumpToDisk(ts, router)
+		}
+	}
 
 	for ts := range fdb.flows {
 		if ts < min || ts > max {
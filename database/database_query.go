@@ -37,6 +37,14 @@ const (
 	OpUnequal = 1
 	OpSmaller = 2
 	OpGreater = 3
+
+	// OpRange matches values between two bounds (both included). The operand
+	// holds the lower and the upper bound of equal length.
+	OpRange = 4
+
+	// OpWithin matches addresses contained in a prefix. The operand holds the
+	// address and the mask of the prefix of equal length.
+	OpWithin = 5
 )
 
 // These constants are only used internally
@@ -59,30 +67,85 @@ const (
 	FieldDstPort
 	FieldIntInName
 	FieldIntOutName
+	FieldTCPFlags
+	FieldTos
+	FieldDscp
+	FieldIcmpType
+	FieldIcmpCode
+	FieldSrcVlan
+	FieldDstVlan
+	FieldSrcMac
+	FieldDstMac
+	FieldMplsLabel1
+	FieldMplsLabel2
+	FieldMplsLabel3
+	FieldMplsTopLabelAddr
+	FieldFwdStatus
+	FieldDropReason
+	FieldPostNATSrcAddr
+	FieldPostNATDstAddr
+	FieldPostNAPTSrcPort
+	FieldPostNAPTDstPort
+	FieldNatEvent
+	FieldApplication
 	FieldMax
 )
 
 var fieldNames = map[string]int{
-	"Timestamp":  FieldTimestamp,
-	"Agent":      FieldAgent,
-	"Family":     FieldFamily,
-	"SrcAddr":    FieldSrcAddr,
-	"DstAddr":    FieldDstAddr,
-	"Protocol":   FieldProtocol,
-	"IntIn":      FieldIntIn,
-	"IntOut":     FieldIntOut,
-	"NextHop":    FieldNextHop,
-	"SrcAs":      FieldSrcAs,
-	"DstAs":      FieldDstAs,
-	"NextHopAs":  FieldNextHopAs,
-	"SrcPfx":     FieldSrcPfx,
-	"DstPfx":     FieldDstPfx,
-	"SrcPort":    FieldSrcPort,
-	"DstPort":    FieldDstPort,
-	"IntInName":  FieldIntInName,
-	"IntOutName": FieldIntOutName,
+	"Timestamp":        FieldTimestamp,
+	"Agent":            FieldAgent,
+	"Family":           FieldFamily,
+	"SrcAddr":          FieldSrcAddr,
+	"DstAddr":          FieldDstAddr,
+	"Protocol":         FieldProtocol,
+	"IntIn":            FieldIntIn,
+	"IntOut":           FieldIntOut,
+	"NextHop":          FieldNextHop,
+	"SrcAs":            FieldSrcAs,
+	"DstAs":            FieldDstAs,
+	"NextHopAs":        FieldNextHopAs,
+	"SrcPfx":           FieldSrcPfx,
+	"DstPfx":           FieldDstPfx,
+	"SrcPort":          FieldSrcPort,
+	"DstPort":          FieldDstPort,
+	"IntInName":        FieldIntInName,
+	"IntOutName":       FieldIntOutName,
+	"TCPFlags":         FieldTCPFlags,
+	"Tos":              FieldTos,
+	"Dscp":             FieldDscp,
+	"IcmpType":         FieldIcmpType,
+	"IcmpCode":         FieldIcmpCode,
+	"SrcVlan":          FieldSrcVlan,
+	"DstVlan":          FieldDstVlan,
+	"SrcMac":           FieldSrcMac,
+	"DstMac":           FieldDstMac,
+	"MplsLabel1":       FieldMplsLabel1,
+	"MplsLabel2":       FieldMplsLabel2,
+	"MplsLabel3":       FieldMplsLabel3,
+	"MplsTopLabelAddr": FieldMplsTopLabelAddr,
+	"FwdStatus":        FieldFwdStatus,
+	"DropReason":       FieldDropReason,
+	"PostNATSrcAddr":   FieldPostNATSrcAddr,
+	"PostNATDstAddr":   FieldPostNATDstAddr,
+	"PostNAPTSrcPort":  FieldPostNAPTSrcPort,
+	"PostNAPTDstPort":  FieldPostNAPTDstPort,
+	"NatEvent":         FieldNatEvent,
+	"Application":      FieldApplication,
 }
 
+// De-duplication modes of queries over several agents
+const (
+	// DedupNone sums up the traffic of all agents
+	DedupNone = iota
+
+	// DedupMax counts the traffic of each breakdown key as seen by the agent seeing most of it
+	DedupMax
+
+	// DedupFlow counts flows of the same addresses, protocol and ports seen by several agents
+	// in the same time slot once (as seen by the first agent of the query)
+	DedupFlow
+)
+
 type void struct{}
 
 // Condition represents a query condition
@@ -98,12 +161,15 @@ type Conditions []Condition
 // Query is the internal representation of a query
 type Query struct {
 	Cond      Conditions
+	Filter    *Expression
 	Breakdown BreakdownFlags
 	TopN      int
+	Dedup     int
+	Metric    int
 }
 
 type concurrentResSum struct {
-	Values BreakdownMap
+	Values counterMap
 	Lock   sync.Mutex
 }
 
@@ -125,13 +191,42 @@ func (conditions Conditions) Includes(field int, operator int) bool {
 	return false
 }
 
-// loadFromDisc loads netflow data from disk into in memory data structure
-func (fdb *FlowDatabase) loadFromDisc(ts int64, agent string, query Query, resSum *concurrentResSum) (BreakdownMap, error) {
+// loadFromDisc loads the flows of `agent` in time slot `ts` fulfilling query `query` from disk
+func (fdb *FlowDatabase) loadFromDisc(ts int64, agent string, query Query) (*avltree.Tree, error) {
+	flows, err := fdb.readFromDisc(ts, agent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create interface mapping
+	interfaceIDByName := make(intfmapper.InterfaceIDByName)
+	for _, m := range flows.InterfaceMapping {
+		interfaceIDByName[m.Name] = uint16(m.Id)
+	}
+
+	// Validate flows and add them to res tree
+	conds := prepareConditions(query.Cond, interfaceIDByName)
+	var filter *preparedExpression
+	if query.Filter != nil {
+		filter = prepareExpression(query.Filter, interfaceIDByName)
+	}
+
+	res := avltree.New()
+	for _, fl := range flows.Flows {
+		if validateFlow(fl, conds) && (filter == nil || filter.matches(fl)) {
+			res.Insert(fl, fl, ptrIsSmaller)
+		}
+	}
+
+	return res, nil
+}
+
+// readFromDisc reads the flows of `agent` in time slot `ts` from disk
+func (fdb *FlowDatabase) readFromDisc(ts int64, agent string) (*netflow.Flows, error) {
 	if fdb.storage == "" {
 		return nil, errors.Errorf("Disk storage is disabled")
 	}
 
-	res := avltree.New()
 	ymd := fmt.Sprintf("%04d-%02d-%02d", time.Unix(ts, 0).Year(), time.Unix(ts, 0).Month(), time.Unix(ts, 0).Day())
 	filename := fmt.Sprintf("%s/%s/nf-%d-%s.tflow2.pb.gzip", fdb.storage, ymd, ts, agent)
 	fh, err := os.Open(filename)
@@ -160,143 +255,57 @@ func (fdb *FlowDatabase) loadFromDisc(ts int64, agent string, query Query, resSu
 	}
 
 	// Unmarshal protobuf
-	flows := netflow.Flows{}
-	err = proto.Unmarshal(buffer, &flows)
+	flows := &netflow.Flows{}
+	err = proto.Unmarshal(buffer, flows)
 	if err != nil {
 		log.Errorf("unable to unmarshal protobuf: %v", err)
 		return nil, err
 	}
 
-	// Create interface mapping
-	interfaceIDByName := make(intfmapper.InterfaceIDByName)
-	for _, m := range flows.InterfaceMapping {
-		interfaceIDByName[m.Name] = uint16(m.Id)
-	}
-
 	if fdb.debug > 1 {
 		log.Infof("file %s contains %d flows", filename, len(flows.Flows))
 	}
 
-	// Validate flows and add them to res tree
-	for _, fl := range flows.Flows {
-		if validateFlow(fl, query, interfaceIDByName) {
-			res.Insert(fl, fl, ptrIsSmaller)
-		}
-	}
-
-	// Breakdown
-	resTime := make(BreakdownMap)
-	res.Each(breakdown, fdb.intfMapper.GetInterfaceNameByID(agent), fdb.iana, query.Breakdown, resSum, resTime)
-
-	return resTime, err
+	return flows, nil
 }
 
-func validateFlow(fl *netflow.Flow, query Query, interfaceIDByName intfmapper.InterfaceIDByName) bool {
-	for _, c := range query.Cond {
-		switch c.Field {
-		case FieldTimestamp:
-			continue
-		case FieldAgent:
-			continue
-		case FieldFamily:
-			if fl.Family != uint32(convert.Uint16b(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldProtocol:
-			if fl.Protocol != uint32(convert.Uint16b(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldSrcAddr:
-			if !net.IP(fl.SrcAddr).Equal(net.IP(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldDstAddr:
-			if !net.IP(fl.DstAddr).Equal(net.IP(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldIntIn:
-			if fl.IntIn != uint32(convert.Uint16b(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldIntOut:
-			if fl.IntOut != uint32(convert.Uint16b(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldNextHop:
-			if !net.IP(fl.NextHop).Equal(net.IP(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldSrcAs:
-			if fl.SrcAs != convert.Uint32b(c.Operand) {
-				return false
-			}
-			continue
-		case FieldDstAs:
-			if fl.DstAs != convert.Uint32b(c.Operand) {
-				return false
-			}
-			continue
-		case FieldNextHopAs:
-			if fl.NextHopAs != convert.Uint32b(c.Operand) {
-				return false
-			}
-		case FieldSrcPort:
-			if fl.SrcPort != uint32(convert.Uint16b(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldDstPort:
-			if fl.DstPort != uint32(convert.Uint16b(c.Operand)) {
-				return false
-			}
-			continue
-		case FieldSrcPfx:
-			if fl.SrcPfx.String() != string(c.Operand) {
-				return false
-			}
-			continue
-		case FieldDstPfx:
-			if fl.DstPfx.String() != string(c.Operand) {
-				return false
-			}
-			continue
-		case FieldIntInName:
-			id := interfaceIDByName[string(c.Operand)]
-			if uint16(fl.IntIn) != id {
-				return false
-			}
-			continue
-		case FieldIntOutName:
-			id := interfaceIDByName[string(c.Operand)]
-			if uint16(fl.IntOut) != id {
-				return false
-			}
+// validateFlow checks if flow `fl` fulfills all conditions in `conds`
+func validateFlow(fl *netflow.Flow, conds []preparedCondition) bool {
+	for i := range conds {
+		key, ok := indexKey(fl, conds[i].field)
+		if !ok {
 			continue
 		}
+
+		if !conds[i].matches(key) {
+			return false
+		}
 	}
 	return true
 }
 
-func (fdb *FlowDatabase) getAgent(q *Query) (string, error) {
-	rtr := ""
+// getAgents returns the agents of all agent conditions of query `q` without duplicates
+func (fdb *FlowDatabase) getAgents(q *Query) ([]string, error) {
+	agents := make([]string, 0)
+	seen := make(map[string]struct{})
 	for _, c := range q.Cond {
-		if c.Field == FieldAgent {
-			rtr = string(c.Operand)
+		if c.Field != FieldAgent {
+			continue
+		}
+
+		rtr := string(c.Operand)
+		if _, ok := seen[rtr]; ok {
+			continue
 		}
+		seen[rtr] = struct{}{}
+		agents = append(agents, rtr)
 	}
-	if rtr == "" {
+	if len(agents) == 0 {
 		log.Warningf("Agent is mandatory cirteria")
-		return "", errors.Errorf("Agent criteria not found")
+		return nil, errors.Errorf("Agent criteria not found")
 	}
 
-	return rtr, nil
+	return agents, nil
 }
 
 func (fdb *FlowDatabase) getStartEndTimes(q *Query) (start int64, end int64, err error) {
@@ -313,6 +322,10 @@ func (fdb *FlowDatabase) getStartEndTimes(q *Query) (start int64, end int64, err
 		case OpEqual:
 			start = int64(convert.Uint64b(c.Operand))
 			end = start
+		case OpRange:
+			n := len(c.Operand) / 2
+			start = int64(convert.Uint64b(c.Operand[:n]))
+			end = int64(convert.Uint64b(c.Operand[n:]))
 		}
 	}
 
@@ -322,7 +335,9 @@ func (fdb *FlowDatabase) getStartEndTimes(q *Query) (start int64, end int64, err
 	return
 }
 
-func (fdb *FlowDatabase) getResultByTS(resSum *concurrentResSum, ts int64, q *Query, rtr string) BreakdownMap {
+// getFlowsByTS returns the flows of `rtr` in time slot `ts` fulfilling query `q`.
+// It returns false if there is no data of the time slot.
+func (fdb *FlowDatabase) getFlowsByTS(ts int64, q *Query, rtr string) (*avltree.Tree, bool) {
 	// timeslot in memory?
 	fdb.lock.RLock()
 	timeGroups, ok := fdb.flows[ts]
@@ -330,22 +345,97 @@ func (fdb *FlowDatabase) getResultByTS(resSum *concurrentResSum, ts int64, q *Qu
 
 	if !ok {
 		// not in memory, try to load from disk
-		result, _ := fdb.loadFromDisc(ts, rtr, *q, resSum)
-		return result
+		res, err := fdb.loadFromDisc(ts, rtr, *q)
+		if err != nil {
+			return nil, false
+		}
+		return res, true
 	}
 
 	if timeGroups[rtr] == nil {
 		log.Infof("TG of %s is nil", rtr)
-		return map[BreakdownKey]uint64{}
+		return nil, true
+	}
+
+	return timeGroups[rtr].filter(q), true
+}
+
+// getResultByTS breaks down the flows of `agents` in time slot `ts` fulfilling query `q`
+// and adds the result to `resSum`. It returns nil if there is no data of the time slot.
+func (fdb *FlowDatabase) getResultByTS(resSum *concurrentResSum, ts int64, q *Query, agents []string) counterMap {
+	var resTime counterMap
+	seen := make(map[string]struct{})
+	for _, rtr := range agents {
+		flows, ok := fdb.getFlowsByTS(ts, q, rtr)
+		if !ok {
+			continue
+		}
+
+		if resTime == nil {
+			resTime = make(counterMap)
+		}
+
+		if q.Dedup == DedupFlow {
+			flows = dedupFlows(flows, seen)
+		}
+
+		res := make(counterMap)
+		flows.Each(breakdown, fdb.intfMapper.GetInterfaceNameByID(rtr), fdb.iana, q.Breakdown, rtr, res)
+		for k, v := range res {
+			c := resTime[k]
+			if q.Dedup == DedupMax {
+				c.max(v)
+			} else {
+				c.add(v)
+			}
+			resTime[k] = c
+		}
+	}
+
+	// Build overall sums
+	resSum.Lock.Lock()
+	for k, v := range resTime {
+		c := resSum.Values[k]
+		c.add(v)
+		resSum.Values[k] = c
 	}
+	resSum.Lock.Unlock()
+
+	return resTime
+}
+
+// dedupFlows returns a tree of the flows in tree `flows` whose addresses, protocol and ports are not in `seen`.
+// Their keys are added to `seen` afterwards, so flows of the same agent are never dropped.
+func dedupFlows(flows *avltree.Tree, seen map[string]struct{}) *avltree.Tree {
+	res := avltree.New()
+	keys := make([]string, 0)
+	flows.Each(func(node *avltree.TreeNode, vals ...interface{}) {
+		for _, v := range node.Values {
+			fl := v.(*netflow.Flow)
+			key := flowKey(fl)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			keys = append(keys, key)
+			res.Insert(fl, fl, ptrIsSmaller)
+		}
+	})
+
+	for _, key := range keys {
+		seen[key] = struct{}{}
+	}
+	return res
+}
 
-	return timeGroups[rtr].filterAndBreakdown(resSum, q, fdb.iana, fdb.intfMapper.GetInterfaceNameByID(rtr))
+// flowKey identifies flow `fl` by its addresses, protocol and ports
+func flowKey(fl *netflow.Flow) string {
+	return fmt.Sprintf("%s|%s|%d|%d|%d", net.IP(fl.SrcAddr), net.IP(fl.DstAddr), fl.Protocol, fl.SrcPort, fl.DstPort)
 }
 
-func (fdb *FlowDatabase) getTopKeys(resSum *concurrentResSum, topN int) map[BreakdownKey]void {
-	// Build Tree Bytes -> Key to allow efficient finding of top n flows
+func (fdb *FlowDatabase) getTopKeys(resSum *concurrentResSum, topN int, metric int) map[BreakdownKey]void {
+	// Build Tree Value -> Key to allow efficient finding of top n flows
 	var btree = avltree.New()
-	for k, b := range resSum.Values {
+	for k, b := range resSum.Values.values(metric) {
 		btree.Insert(b, k, uint64IsSmaller)
 	}
 
@@ -369,14 +459,14 @@ func (fdb *FlowDatabase) RunQuery(q *Query) (*Result, error) {
 		return nil, errors.Wrap(err, "Failed to Start/End times")
 	}
 
-	rtr, err := fdb.getAgent(q)
+	agents, err := fdb.getAgents(q)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to get router")
 	}
 
 	// resSum holds a sum per breakdown key over all timestamps
 	resSum := &concurrentResSum{
-		Values: make(BreakdownMap),
+		Values: make(counterMap),
 	}
 
 	// resTime holds individual sums per breakdown key and ts
@@ -388,12 +478,12 @@ func (fdb *FlowDatabase) RunQuery(q *Query) (*Result, error) {
 		log.Infof("RunQuery: start timeslot %d", ts)
 		resWg.Add(1)
 		go func(ts int64) {
-			result := fdb.getResultByTS(resSum, ts, q, rtr)
+			result := fdb.getResultByTS(resSum, ts, q, agents)
 
 			if result != nil {
 				log.Infof("RunQuery: data in timeslot %d", ts)
 				resMtx.Lock()
-				resTime[ts] = result
+				resTime[ts] = result.values(q.Metric)
 				resMtx.Unlock()
 			}
 			resWg.Done()
@@ -411,7 +501,7 @@ func (fdb *FlowDatabase) RunQuery(q *Query) (*Result, error) {
 	// Generate topKeys if required
 	var topKeys map[BreakdownKey]void
 	if q.TopN > 0 {
-		topKeys = fdb.getTopKeys(resSum, q.TopN)
+		topKeys = fdb.getTopKeys(resSum, q.TopN, q.Metric)
 	}
 
 	timestamps := make([]int64, 0)
@@ -426,5 +516,6 @@ func (fdb *FlowDatabase) RunQuery(q *Query) (*Result, error) {
 		Timestamps:  timestamps,
 		Data:        resTime,
 		Aggregation: fdb.aggregation,
+		Metric:      q.Metric,
 	}, nil
 }
@@ -2,7 +2,9 @@ package database
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/intfmapper"
 	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/packet"
 )
 
 type intfMapper struct {
@@ -463,6 +466,534 @@ func TestQuery(t *testing.T) {
 				Aggregation: minute,
 			},
 		},
+
+		{
+			// Testcase: SYN packets of two sources and an established session, DSCP breakdown
+			name: "Test 4",
+			flows: []*netflow.Flow{
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 1},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					TcpFlags:   packet.TCPFlagSYN,
+					Tos:        46 << 2,
+					SrcMac:     []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55},
+					Packets:    2,
+					Size:       80,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 2},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					TcpFlags:   packet.TCPFlagSYN,
+					Packets:    1,
+					Size:       40,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 3},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					TcpFlags:   packet.TCPFlagSYN | packet.TCPFlagACK,
+					Packets:    10,
+					Size:       10000,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+			},
+			query: &Query{
+				Cond: []Condition{
+					{
+						Field:    FieldAgent,
+						Operator: OpEqual,
+						Operand:  []byte("test01.pop01"),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpGreater,
+						Operand:  convert.Uint64Byte(uint64(ts1 - 3*minute)),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpSmaller,
+						Operand:  convert.Uint64Byte(uint64(ts1 + minute)),
+					},
+					{
+						Field:    FieldTCPFlags,
+						Operator: OpEqual,
+						Operand:  convert.Uint16Byte(packet.TCPFlagSYN),
+					},
+				},
+				Breakdown: BreakdownFlags{
+					TCPFlags: true,
+					Dscp:     true,
+					SrcMac:   true,
+				},
+				TopN: 1,
+			},
+			expectedResult: Result{
+				TopKeys: map[BreakdownKey]void{
+					{
+						FieldTCPFlags: "SYN",
+						FieldDscp:     "46",
+						FieldSrcMac:   "00:11:22:33:44:55",
+					}: {},
+				},
+				Timestamps: []int64{
+					ts1,
+				},
+				Data: map[int64]BreakdownMap{
+					ts1: {
+						BreakdownKey{
+							FieldTCPFlags: "SYN",
+							FieldDscp:     "46",
+							FieldSrcMac:   "00:11:22:33:44:55",
+						}: 80,
+						BreakdownKey{
+							FieldTCPFlags: "SYN",
+							FieldDscp:     "0",
+						}: 40,
+					},
+				},
+				Aggregation: minute,
+			},
+		},
+
+		{
+			// Testcase: forwarded and dropped flows of an MPLS LSP
+			name: "Test 5",
+			flows: []*netflow.Flow{
+				{
+					Router:           []byte{1, 2, 3, 4},
+					Family:           4,
+					SrcAddr:          []byte{10, 0, 0, 1},
+					DstAddr:          []byte{30, 0, 0, 1},
+					MplsLabel1:       16001,
+					ForwardingStatus: 66, // forwarded, not fragmented
+					Packets:          10,
+					Size:             10000,
+					Samplerate:       1,
+					Timestamp:        ts1,
+				},
+				{
+					Router:           []byte{1, 2, 3, 4},
+					Family:           4,
+					SrcAddr:          []byte{10, 0, 0, 1},
+					DstAddr:          []byte{30, 0, 0, 2},
+					MplsLabel1:       16001,
+					ForwardingStatus: 129, // dropped, ACL deny
+					Packets:          2,
+					Size:             200,
+					Samplerate:       1,
+					Timestamp:        ts1,
+				},
+				{
+					Router:           []byte{1, 2, 3, 4},
+					Family:           4,
+					SrcAddr:          []byte{10, 0, 0, 2},
+					DstAddr:          []byte{30, 0, 0, 3},
+					MplsLabel1:       16002,
+					ForwardingStatus: 131, // dropped, unroutable
+					Packets:          1,
+					Size:             100,
+					Samplerate:       1,
+					Timestamp:        ts1,
+				},
+			},
+			query: &Query{
+				Cond: []Condition{
+					{
+						Field:    FieldAgent,
+						Operator: OpEqual,
+						Operand:  []byte("test01.pop01"),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpGreater,
+						Operand:  convert.Uint64Byte(uint64(ts1 - 3*minute)),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpSmaller,
+						Operand:  convert.Uint64Byte(uint64(ts1 + minute)),
+					},
+					{
+						Field:    FieldFwdStatus,
+						Operator: OpEqual,
+						Operand:  convert.Uint8Byte(iana.FwdStatusDropped),
+					},
+				},
+				Breakdown: BreakdownFlags{
+					MplsLabel1: true,
+					DropReason: true,
+				},
+				TopN: 1,
+			},
+			expectedResult: Result{
+				TopKeys: map[BreakdownKey]void{
+					{
+						FieldMplsLabel1: "16001",
+						FieldDropReason: "ACL deny",
+					}: {},
+				},
+				Timestamps: []int64{
+					ts1,
+				},
+				Data: map[int64]BreakdownMap{
+					ts1: {
+						BreakdownKey{
+							FieldMplsLabel1: "16001",
+							FieldDropReason: "ACL deny",
+						}: 200,
+						BreakdownKey{
+							FieldMplsLabel1: "16002",
+							FieldDropReason: "Unroutable",
+						}: 100,
+					},
+				},
+				Aggregation: minute,
+			},
+		},
+		{
+			// Testcase: flows of a host broken down by application
+			name: "Test 6",
+			flows: []*netflow.Flow{
+				{
+					Router:          []byte{1, 2, 3, 4},
+					Family:          4,
+					SrcAddr:         []byte{10, 0, 0, 1},
+					DstAddr:         []byte{30, 0, 0, 1},
+					ApplicationId:   []byte{3, 0, 0, 80},
+					ApplicationName: "http",
+					Packets:         10,
+					Size:            1000,
+					Samplerate:      1,
+					Timestamp:       ts1,
+				},
+				{
+					Router:        []byte{1, 2, 3, 4},
+					Family:        4,
+					SrcAddr:       []byte{10, 0, 0, 1},
+					DstAddr:       []byte{30, 0, 0, 2},
+					ApplicationId: []byte{3, 0, 1, 187},
+					Packets:       5,
+					Size:          500,
+					Samplerate:    1,
+					Timestamp:     ts1,
+				},
+				{
+					Router:          []byte{1, 2, 3, 4},
+					Family:          4,
+					SrcAddr:         []byte{10, 0, 0, 2},
+					DstAddr:         []byte{30, 0, 0, 1},
+					ApplicationId:   []byte{3, 0, 0, 80},
+					ApplicationName: "http",
+					Packets:         3,
+					Size:            300,
+					Samplerate:      1,
+					Timestamp:       ts1,
+				},
+			},
+			query: &Query{
+				Cond: []Condition{
+					{
+						Field:    FieldAgent,
+						Operator: OpEqual,
+						Operand:  []byte("test01.pop01"),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpGreater,
+						Operand:  convert.Uint64Byte(uint64(ts1 - 3*minute)),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpSmaller,
+						Operand:  convert.Uint64Byte(uint64(ts1 + minute)),
+					},
+					{
+						Field:    FieldSrcAddr,
+						Operator: OpEqual,
+						Operand:  []byte{10, 0, 0, 1},
+					},
+				},
+				Breakdown: BreakdownFlags{
+					Application: true,
+				},
+				TopN: 1,
+			},
+			expectedResult: Result{
+				TopKeys: map[BreakdownKey]void{
+					{
+						FieldApplication: "http",
+					}: {},
+				},
+				Timestamps: []int64{
+					ts1,
+				},
+				Data: map[int64]BreakdownMap{
+					ts1: {
+						BreakdownKey{
+							FieldApplication: "http",
+						}: 1000,
+						BreakdownKey{
+							FieldApplication: "3:443",
+						}: 500,
+					},
+				},
+				Aggregation: minute,
+			},
+		},
+		{
+			// Testcase: range, containment and inequality conditions
+			name: "Test 7",
+			flows: []*netflow.Flow{
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 1},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    8080,
+					Packets:    1,
+					Size:       1000,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 2},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    50000,
+					Packets:    1,
+					Size:       500,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 3},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    443,
+					Packets:    1,
+					Size:       700,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{192, 168, 0, 1},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    8080,
+					Packets:    1,
+					Size:       300,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 4},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   17,
+					DstPort:    9000,
+					Packets:    1,
+					Size:       200,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+			},
+			query: &Query{
+				Cond: []Condition{
+					{
+						Field:    FieldAgent,
+						Operator: OpEqual,
+						Operand:  []byte("test01.pop01"),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpGreater,
+						Operand:  convert.Uint64Byte(uint64(ts1 - 3*minute)),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpSmaller,
+						Operand:  convert.Uint64Byte(uint64(ts1 + minute)),
+					},
+					{
+						Field:    FieldDstPort,
+						Operator: OpRange,
+						Operand:  append(convert.Uint16Byte(1024), convert.Uint16Byte(65535)...),
+					},
+					{
+						Field:    FieldSrcAddr,
+						Operator: OpWithin,
+						Operand:  []byte{10, 0, 0, 0, 255, 0, 0, 0},
+					},
+					{
+						Field:    FieldProtocol,
+						Operator: OpUnequal,
+						Operand:  convert.Uint8Byte(17),
+					},
+				},
+				Breakdown: BreakdownFlags{
+					DstPort: true,
+				},
+				TopN: 2,
+			},
+			expectedResult: Result{
+				TopKeys: map[BreakdownKey]void{
+					{
+						FieldDstPort: "8080",
+					}: {},
+					{
+						FieldDstPort: "50000",
+					}: {},
+				},
+				Timestamps: []int64{
+					ts1,
+				},
+				Data: map[int64]BreakdownMap{
+					ts1: {
+						BreakdownKey{
+							FieldDstPort: "8080",
+						}: 1000,
+						BreakdownKey{
+							FieldDstPort: "50000",
+						}: 500,
+					},
+				},
+				Aggregation: minute,
+			},
+		},
+		{
+			// Test 8: traffic to port 80 or 443 excluding AS 65000
+			name: "Test 8",
+			flows: []*netflow.Flow{
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 4},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    80,
+					SrcAs:      100,
+					Packets:    1,
+					Size:       1000,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 5},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    443,
+					SrcAs:      100,
+					Packets:    1,
+					Size:       700,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 6},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    80,
+					SrcAs:      65000,
+					Packets:    1,
+					Size:       300,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+				{
+					Router:     []byte{1, 2, 3, 4},
+					Family:     4,
+					SrcAddr:    []byte{10, 0, 0, 7},
+					DstAddr:    []byte{30, 0, 0, 1},
+					Protocol:   6,
+					DstPort:    22,
+					SrcAs:      100,
+					Packets:    1,
+					Size:       200,
+					Samplerate: 1,
+					Timestamp:  ts1,
+				},
+			},
+			query: &Query{
+				Cond: []Condition{
+					{
+						Field:    FieldAgent,
+						Operator: OpEqual,
+						Operand:  []byte("test01.pop01"),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpGreater,
+						Operand:  convert.Uint64Byte(uint64(ts1 - 3*minute)),
+					},
+					{
+						Field:    FieldTimestamp,
+						Operator: OpSmaller,
+						Operand:  convert.Uint64Byte(uint64(ts1 + minute)),
+					},
+				},
+				Filter: And(
+					In(FieldDstPort, convert.Uint16Byte(80), convert.Uint16Byte(443)),
+					Not(Cond(Condition{
+						Field:    FieldSrcAs,
+						Operator: OpEqual,
+						Operand:  convert.Uint32Byte(65000),
+					})),
+				),
+				Breakdown: BreakdownFlags{
+					DstPort: true,
+				},
+				TopN: 3,
+			},
+			expectedResult: Result{
+				TopKeys: map[BreakdownKey]void{
+					{
+						FieldDstPort: "80",
+					}: {},
+					{
+						FieldDstPort: "443",
+					}: {},
+				},
+				Timestamps: []int64{
+					ts1,
+				},
+				Data: map[int64]BreakdownMap{
+					ts1: {
+						BreakdownKey{
+							FieldDstPort: "80",
+						}: 1000,
+						BreakdownKey{
+							FieldDstPort: "443",
+						}: 700,
+					},
+				},
+				Aggregation: minute,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -485,6 +1016,130 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestRunNATQuery(t *testing.T) {
+	minute := int64(60)
+	hour := int64(3600)
+
+	ts1 := int64(3600)
+	ms1 := uint64(ts1 * 1000)
+
+	flows := []*netflow.Flow{
+		{
+			Router:          []byte{1, 2, 3, 4},
+			Family:          4,
+			SrcAddr:         []byte{10, 0, 0, 1},
+			SrcPort:         1000,
+			PostNatSrcAddr:  []byte{198, 51, 100, 1},
+			PostNaptSrcPort: 40000,
+			NatEvent:        4,
+			FlowStart:       ms1 + 1000,
+			FlowEnd:         ms1 + 1000,
+			Timestamp:       ts1,
+		},
+		{
+			Router:          []byte{1, 2, 3, 4},
+			Family:          4,
+			SrcAddr:         []byte{10, 0, 0, 1},
+			SrcPort:         1000,
+			PostNatSrcAddr:  []byte{198, 51, 100, 1},
+			PostNaptSrcPort: 40000,
+			NatEvent:        5,
+			FlowStart:       ms1 + 20000,
+			FlowEnd:         ms1 + 20000,
+			Timestamp:       ts1,
+		},
+		{
+			Router:          []byte{1, 2, 3, 4},
+			Family:          4,
+			SrcAddr:         []byte{10, 0, 0, 2},
+			SrcPort:         2000,
+			PostNatSrcAddr:  []byte{198, 51, 100, 1},
+			PostNaptSrcPort: 40000,
+			NatEvent:        4,
+			FlowStart:       ms1 + 30000,
+			FlowEnd:         ms1 + 30000,
+			Timestamp:       ts1,
+		},
+		{
+			Router:          []byte{1, 2, 3, 4},
+			Family:          4,
+			SrcAddr:         []byte{10, 0, 0, 3},
+			SrcPort:         3000,
+			PostNatSrcAddr:  []byte{198, 51, 100, 1},
+			PostNaptSrcPort: 40001,
+			NatEvent:        4,
+			FlowStart:       ms1 + 5000,
+			FlowEnd:         ms1 + 5000,
+			Timestamp:       ts1,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		ts       int64
+		expected []NATBinding
+	}{
+		{
+			name: "Deleted later",
+			ts:   ts1 + 10,
+			expected: []NATBinding{
+				{
+					InsideAddr:  net.IP{10, 0, 0, 1},
+					InsidePort:  1000,
+					OutsideAddr: net.IP{198, 51, 100, 1},
+					OutsidePort: 40000,
+					Event:       "NAT44 session create",
+					Created:     int64(ms1) + 1000,
+					Deleted:     int64(ms1) + 20000,
+				},
+			},
+		},
+		{
+			name:     "Between bindings",
+			ts:       ts1 + 25,
+			expected: []NATBinding{},
+		},
+		{
+			name: "Still active",
+			ts:   ts1 + 40,
+			expected: []NATBinding{
+				{
+					InsideAddr:  net.IP{10, 0, 0, 2},
+					InsidePort:  2000,
+					OutsideAddr: net.IP{198, 51, 100, 1},
+					OutsidePort: 40000,
+					Event:       "NAT44 session create",
+					Created:     int64(ms1) + 30000,
+				},
+			},
+		},
+	}
+
+	fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, map[string]string{
+		net.IP([]byte{1, 2, 3, 4}).String(): "test01.pop01",
+	}, iana.New())
+
+	for _, flow := range flows {
+		fdb.Input <- flow
+	}
+
+	time.Sleep(time.Second)
+
+	for _, test := range tests {
+		res, err := fdb.RunNATQuery(&NATQuery{
+			Agent:     "test01.pop01",
+			Addr:      net.IP{198, 51, 100, 1},
+			Port:      40000,
+			Timestamp: test.ts,
+		})
+		if err != nil {
+			t.Errorf("Unexpected error on RunNATQuery: %v", err)
+		}
+
+		assert.Equal(t, test.expected, res, test.name)
+	}
+}
+
 func dumpRes(res Result) {
 	for ts := range res.Data {
 		for k, v := range res.Data[ts] {
@@ -492,3 +1147,229 @@ func dumpRes(res Result) {
 		}
 	}
 }
+
+func TestQueryMultipleAgents(t *testing.T) {
+	minute := int64(60)
+	hour := int64(3600)
+	ts1 := int64(3600)
+
+	// The flow to port 80 is seen by both agents
+	flows := []*netflow.Flow{
+		{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 1},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Protocol:   6,
+			SrcPort:    12345,
+			DstPort:    80,
+			Packets:    2,
+			Size:       1000,
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		{
+			Router:     []byte{5, 6, 7, 8},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 1},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Protocol:   6,
+			SrcPort:    12345,
+			DstPort:    80,
+			Packets:    3,
+			Size:       1200,
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		{
+			Router:     []byte{5, 6, 7, 8},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 2},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Protocol:   6,
+			SrcPort:    12345,
+			DstPort:    443,
+			Packets:    1,
+			Size:       500,
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		{
+			Router:     []byte{9, 9, 9, 9},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 3},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Protocol:   6,
+			SrcPort:    12345,
+			DstPort:    22,
+			Packets:    1,
+			Size:       100,
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+	}
+
+	fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, map[string]string{
+		net.IP([]byte{1, 2, 3, 4}).String(): "test01.pop01",
+		net.IP([]byte{5, 6, 7, 8}).String(): "test02.pop01",
+		net.IP([]byte{9, 9, 9, 9}).String(): "test03.pop01",
+	}, iana.New())
+
+	for _, flow := range flows {
+		fdb.Input <- flow
+	}
+
+	time.Sleep(time.Second)
+
+	tests := []struct {
+		name      string
+		breakdown BreakdownFlags
+		dedup     int
+		metric    int
+		expected  BreakdownMap
+	}{
+		{
+			name:      "Agent breakdown",
+			breakdown: BreakdownFlags{Agent: true},
+			expected: BreakdownMap{
+				BreakdownKey{FieldAgent: "test01.pop01"}: 1000,
+				BreakdownKey{FieldAgent: "test02.pop01"}: 1700,
+			},
+		},
+		{
+			name:      "No de-duplication",
+			breakdown: BreakdownFlags{DstPort: true},
+			expected: BreakdownMap{
+				BreakdownKey{FieldDstPort: "80"}:  2200,
+				BreakdownKey{FieldDstPort: "443"}: 500,
+			},
+		},
+		{
+			name:      "Maximum",
+			breakdown: BreakdownFlags{DstPort: true},
+			dedup:     DedupMax,
+			expected: BreakdownMap{
+				BreakdownKey{FieldDstPort: "80"}:  1200,
+				BreakdownKey{FieldDstPort: "443"}: 500,
+			},
+		},
+		{
+			name:      "Flow de-duplication",
+			breakdown: BreakdownFlags{DstPort: true},
+			dedup:     DedupFlow,
+			expected: BreakdownMap{
+				BreakdownKey{FieldDstPort: "80"}:  1000,
+				BreakdownKey{FieldDstPort: "443"}: 500,
+			},
+		},
+		{
+			name:      "Flows",
+			breakdown: BreakdownFlags{Agent: true},
+			metric:    MetricFlows,
+			expected: BreakdownMap{
+				BreakdownKey{FieldAgent: "test01.pop01"}: 1,
+				BreakdownKey{FieldAgent: "test02.pop01"}: 2,
+			},
+		},
+		{
+			name:      "Packets",
+			breakdown: BreakdownFlags{Agent: true},
+			metric:    MetricPackets,
+			expected: BreakdownMap{
+				BreakdownKey{FieldAgent: "test01.pop01"}: 2,
+				BreakdownKey{FieldAgent: "test02.pop01"}: 4,
+			},
+		},
+		{
+			name:      "Average packet size",
+			breakdown: BreakdownFlags{Agent: true},
+			metric:    MetricAvgPacketSize,
+			expected: BreakdownMap{
+				BreakdownKey{FieldAgent: "test01.pop01"}: 500,
+				BreakdownKey{FieldAgent: "test02.pop01"}: 425,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := fdb.RunQuery(&Query{
+			Cond: []Condition{
+				{
+					Field:    FieldAgent,
+					Operator: OpEqual,
+					Operand:  []byte("test01.pop01"),
+				},
+				{
+					Field:    FieldAgent,
+					Operator: OpEqual,
+					Operand:  []byte("test02.pop01"),
+				},
+				{
+					Field:    FieldTimestamp,
+					Operator: OpEqual,
+					Operand:  convert.Uint64Byte(uint64(ts1)),
+				},
+			},
+			Breakdown: test.breakdown,
+			Dedup:     test.dedup,
+			Metric:    test.metric,
+		})
+		if err != nil {
+			t.Errorf("Unexpected error on RunQuery: %v", err)
+			continue
+		}
+
+		assert.Equal(t, test.expected, result.Data[ts1], test.name)
+	}
+}
+
+func TestDumperRedump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tflow2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fdb := New(60, 3600, 1, 0, 6, dir, false, &intfMapper{}, map[string]string{
+		net.IP([]byte{1, 2, 3, 4}).String(): "test01.pop01",
+	}, iana.New())
+
+	// The most recent time slot the dumper writes to disk
+	ts := fdb.CurrentTimeslot() - 2*fdb.AggregationPeriod()
+	fdb.lastDump = ts - fdb.AggregationPeriod()
+
+	newFlow := func(size uint64) *netflow.Flow {
+		return &netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 1},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Size:       size,
+			Samplerate: 1,
+			Timestamp:  ts,
+		}
+	}
+
+	fdb.Add(newFlow(1000))
+	fdb.Dumper()
+	time.Sleep(100 * time.Millisecond)
+
+	flows, err := fdb.readFromDisc(ts, "test01.pop01")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, len(flows.Flows))
+
+	// A part of a spread flow arriving after the time slot has been dumped. The next run of the
+	// dumper starts after the time slot.
+	fdb.Add(newFlow(500))
+	fdb.lastDump = ts + fdb.AggregationPeriod()
+	fdb.Dumper()
+	time.Sleep(100 * time.Millisecond)
+
+	flows, err = fdb.readFromDisc(ts, "test01.pop01")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, len(flows.Flows))
+}
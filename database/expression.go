@@ -0,0 +1,179 @@
+package database
+
+import (
+	"github.com/bio-routing/tflow2/avltree"
+	"github.com/bio-routing/tflow2/intfmapper"
+	"github.com/bio-routing/tflow2/netflow"
+)
+
+// Types of expressions
+const (
+	// ExprCondition is a single condition
+	ExprCondition = iota
+
+	// ExprAnd matches flows matching all operands
+	ExprAnd
+
+	// ExprOr matches flows matching any operand
+	ExprOr
+
+	// ExprNot matches flows not matching its only operand
+	ExprNot
+)
+
+// Expression is a boolean expression of conditions flows are filtered by
+type Expression struct {
+	Type      int
+	Condition Condition
+	Operands  []*Expression
+}
+
+// Cond creates an expression consisting of condition `c`
+func Cond(c Condition) *Expression {
+	return &Expression{
+		Type:      ExprCondition,
+		Condition: c,
+	}
+}
+
+// And creates an expression matching flows matching all of `operands`
+func And(operands ...*Expression) *Expression {
+	return &Expression{
+		Type:     ExprAnd,
+		Operands: operands,
+	}
+}
+
+// Or creates an expression matching flows matching any of `operands`
+func Or(operands ...*Expression) *Expression {
+	return &Expression{
+		Type:     ExprOr,
+		Operands: operands,
+	}
+}
+
+// Not creates an expression matching flows not matching `operand`
+func Not(operand *Expression) *Expression {
+	return &Expression{
+		Type:     ExprNot,
+		Operands: []*Expression{operand},
+	}
+}
+
+// In creates an expression matching flows whose field `field` equals any of `operands`
+func In(field int, operands ...[]byte) *Expression {
+	e := Or()
+	for _, operand := range operands {
+		e.Operands = append(e.Operands, Cond(Condition{
+			Field:    field,
+			Operator: OpEqual,
+			Operand:  operand,
+		}))
+	}
+	return e
+}
+
+// preparedExpression is an expression with its conditions prepared
+type preparedExpression struct {
+	typ      int
+	cond     preparedCondition
+	operands []*preparedExpression
+}
+
+// prepareExpression prepares all conditions of expression `e`. Conditions on the timestamp
+// or the agent are handled by the query itself and match all flows.
+func prepareExpression(e *Expression, interfaceIDByName intfmapper.InterfaceIDByName) *preparedExpression {
+	pe := &preparedExpression{
+		typ: e.Type,
+	}
+
+	if e.Type == ExprCondition {
+		if e.Condition.Field == FieldTimestamp || e.Condition.Field == FieldAgent {
+			pe.typ = ExprAnd
+			return pe
+		}
+		pe.cond = prepareCondition(e.Condition, interfaceIDByName)
+		return pe
+	}
+
+	pe.operands = make([]*preparedExpression, 0, len(e.Operands))
+	for _, o := range e.Operands {
+		pe.operands = append(pe.operands, prepareExpression(o, interfaceIDByName))
+	}
+	return pe
+}
+
+// matches checks if flow `fl` fulfills expression `pe`
+func (pe *preparedExpression) matches(fl *netflow.Flow) bool {
+	switch pe.typ {
+	case ExprCondition:
+		key, ok := indexKey(fl, pe.cond.field)
+		if !ok {
+			return true
+		}
+		return pe.cond.matches(key)
+	case ExprAnd:
+		for _, o := range pe.operands {
+			if !o.matches(fl) {
+				return false
+			}
+		}
+		return true
+	case ExprOr:
+		for _, o := range pe.operands {
+			if o.matches(fl) {
+				return true
+			}
+		}
+		return false
+	case ExprNot:
+		return !pe.operands[0].matches(fl)
+	}
+	return false
+}
+
+// evaluate returns a tree of all flows of `tg` fulfilling expression `pe`. Conditions on indexed fields
+// are looked up in the indices and combined by intersection and union, other conditions are matched
+// against every flow.
+func (tg *TimeGroup) evaluate(pe *preparedExpression) *avltree.Tree {
+	switch pe.typ {
+	case ExprCondition:
+		index := tg.index(pe.cond.field)
+		if index == nil {
+			return filterTree(tg.Any.Get(anyIndex), pe)
+		}
+		return pe.cond.lookup(index)
+	case ExprAnd:
+		if len(pe.operands) == 0 {
+			return tg.Any.Get(anyIndex)
+		}
+		trees := make([]*avltree.Tree, 0, len(pe.operands))
+		for _, o := range pe.operands {
+			trees = append(trees, tg.evaluate(o))
+		}
+		return avltree.Intersection(trees)
+	case ExprOr:
+		trees := make([]*avltree.Tree, 0, len(pe.operands))
+		for _, o := range pe.operands {
+			trees = append(trees, tg.evaluate(o))
+		}
+		return avltree.Union(trees)
+	case ExprNot:
+		return tg.Any.Get(anyIndex).Difference(tg.evaluate(pe.operands[0]))
+	}
+	return nil
+}
+
+// filterTree builds a tree of all flows in tree `t` fulfilling expression `pe`
+func filterTree(t *avltree.Tree, pe *preparedExpression) *avltree.Tree {
+	res := avltree.New()
+	t.Each(func(node *avltree.TreeNode, vals ...interface{}) {
+		for _, v := range node.Values {
+			fl := v.(*netflow.Flow)
+			if pe.matches(fl) {
+				res.Insert(fl, fl, ptrIsSmaller)
+			}
+		}
+	})
+	return res
+}
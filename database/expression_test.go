@@ -0,0 +1,77 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpressionMatches(t *testing.T) {
+	fl := &netflow.Flow{
+		SrcAddr:  []byte{10, 1, 2, 3},
+		Protocol: 6,
+		DstPort:  443,
+		SrcAs:    65000,
+	}
+
+	port := func(p uint16) *Expression {
+		return Cond(Condition{Field: FieldDstPort, Operator: OpEqual, Operand: convert.Uint16Byte(p)})
+	}
+	as := func(asn uint32) *Expression {
+		return Cond(Condition{Field: FieldSrcAs, Operator: OpEqual, Operand: convert.Uint32Byte(asn)})
+	}
+
+	tests := []struct {
+		name     string
+		expr     *Expression
+		expected bool
+	}{
+		{
+			name:     "Condition",
+			expr:     port(443),
+			expected: true,
+		},
+		{
+			name:     "And",
+			expr:     And(port(443), as(100)),
+			expected: false,
+		},
+		{
+			name:     "Or",
+			expr:     Or(port(80), as(65000)),
+			expected: true,
+		},
+		{
+			name:     "Not",
+			expr:     Not(as(65000)),
+			expected: false,
+		},
+		{
+			name:     "In",
+			expr:     In(FieldDstPort, convert.Uint16Byte(80), convert.Uint16Byte(443)),
+			expected: true,
+		},
+		{
+			name:     "Not in",
+			expr:     In(FieldDstPort, convert.Uint16Byte(80), convert.Uint16Byte(8080)),
+			expected: false,
+		},
+		{
+			name:     "Nested",
+			expr:     And(Or(port(80), port(443)), Not(as(100))),
+			expected: true,
+		},
+		{
+			name:     "Agent is ignored",
+			expr:     Not(Cond(Condition{Field: FieldAgent, Operator: OpEqual, Operand: []byte("foo")})),
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		pe := prepareExpression(test.expr, nil)
+		assert.Equal(t, test.expected, pe.matches(fl), test.name)
+	}
+}
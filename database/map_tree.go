@@ -59,3 +59,17 @@ func (m *mapTree) Insert(key interface{}, value interface{}) {
 func (m *mapTree) Get(key interface{}) *avltree.Tree {
 	return m.entries[createKey(key)]
 }
+
+// Filter returns a tree of all elements stored under keys `match` returns true for
+func (m *mapTree) Filter(match func(key string) bool) *avltree.Tree {
+	m.RLock()
+	trees := make([]*avltree.Tree, 0)
+	for key, tree := range m.entries {
+		if match(key) {
+			trees = append(trees, tree)
+		}
+	}
+	m.RUnlock()
+
+	return avltree.Union(trees)
+}
@@ -0,0 +1,93 @@
+package database
+
+// Metrics the traffic of a query can be measured in
+const (
+	// MetricBytes is the number of bytes
+	MetricBytes = iota
+
+	// MetricPackets is the number of packets
+	MetricPackets
+
+	// MetricFlows is the number of flow records
+	MetricFlows
+
+	// MetricAvgPacketSize is the average size of packets in bytes (derived from bytes and packets)
+	MetricAvgPacketSize
+)
+
+var metricNames = map[int]string{
+	MetricBytes:         "bytes",
+	MetricPackets:       "packets",
+	MetricFlows:         "flows",
+	MetricAvgPacketSize: "avg_packet_size",
+}
+
+// GetMetricByName returns the internal number of a metric
+func GetMetricByName(name string) int {
+	for metric, n := range metricNames {
+		if n == name {
+			return metric
+		}
+	}
+	return -1
+}
+
+// MetricName returns the name of metric `metric`
+func MetricName(metric int) string {
+	return metricNames[metric]
+}
+
+// counters are the volumes of the traffic of a breakdown key
+type counters struct {
+	bytes   uint64
+	packets uint64
+	flows   uint64
+}
+
+// counterMap maps breakdown keys to counters
+type counterMap map[BreakdownKey]counters
+
+// add adds counters `o` to `c`
+func (c *counters) add(o counters) {
+	c.bytes += o.bytes
+	c.packets += o.packets
+	c.flows += o.flows
+}
+
+// max sets each counter of `c` to the maximum of itself and the counter of `o`
+func (c *counters) max(o counters) {
+	if o.bytes > c.bytes {
+		c.bytes = o.bytes
+	}
+	if o.packets > c.packets {
+		c.packets = o.packets
+	}
+	if o.flows > c.flows {
+		c.flows = o.flows
+	}
+}
+
+// value returns the value of metric `metric`
+func (c counters) value(metric int) uint64 {
+	switch metric {
+	case MetricPackets:
+		return c.packets
+	case MetricFlows:
+		return c.flows
+	case MetricAvgPacketSize:
+		if c.packets == 0 {
+			return 0
+		}
+		return c.bytes / c.packets
+	}
+	return c.bytes
+}
+
+// values returns the values of metric `metric` of all breakdown keys
+func (m counterMap) values(metric int) BreakdownMap {
+	res := make(BreakdownMap, len(m))
+	for k, c := range m {
+		res[k] = c.value(metric)
+	}
+	return res
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounters(t *testing.T) {
+	assert := assert.New(t)
+
+	c := counters{bytes: 3000, packets: 4, flows: 2}
+	c.add(counters{bytes: 1000, packets: 4, flows: 1})
+	assert.Equal(uint64(4000), c.value(MetricBytes))
+	assert.Equal(uint64(8), c.value(MetricPackets))
+	assert.Equal(uint64(3), c.value(MetricFlows))
+	assert.Equal(uint64(500), c.value(MetricAvgPacketSize))
+
+	c.max(counters{bytes: 5000, packets: 1, flows: 1})
+	assert.Equal(counters{bytes: 5000, packets: 8, flows: 3}, c)
+
+	assert.Equal(uint64(0), counters{bytes: 100}.value(MetricAvgPacketSize))
+}
+
+func TestGetMetricByName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(MetricPackets, GetMetricByName("packets"))
+	assert.Equal("avg_packet_size", MetricName(MetricAvgPacketSize))
+	assert.Equal(-1, GetMetricByName("foo"))
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"bytes"
+	"net"
+	"sort"
+
+	"github.com/bio-routing/tflow2/avltree"
+	"github.com/bio-routing/tflow2/iana"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/pkg/errors"
+)
+
+// DefaultNATLookback is the default number of seconds before the time of a NAT query to look for NAT events in
+const DefaultNATLookback = 3600
+
+// NATQuery asks which inside address and port used the public address `Addr` and port `Port`
+// of `Agent` at unix time `Timestamp`. A `Port` of 0 matches bindings of any port.
+type NATQuery struct {
+	Agent     string
+	Addr      net.IP
+	Port      uint16
+	Timestamp int64
+	Lookback  int64
+}
+
+// NATBinding is a translation between an inside and an outside address and port
+type NATBinding struct {
+	InsideAddr  net.IP
+	InsidePort  uint32
+	OutsideAddr net.IP
+	OutsidePort uint32
+	Event       string
+	Created     int64 // ms since epoch
+	Deleted     int64 // ms since epoch, 0 if not deleted (yet)
+}
+
+// natKey identifies the inside side of a translation
+type natKey struct {
+	addr string
+	port uint32
+}
+
+// RunNATQuery returns the NAT bindings matching `q` that were active at the time of `q`
+func (fdb *FlowDatabase) RunNATQuery(q *NATQuery) ([]NATBinding, error) {
+	stats.GlobalStats.Queries++
+
+	if q.Agent == "" {
+		return nil, errors.Errorf("Agent criteria not found")
+	}
+	if q.Addr == nil {
+		return nil, errors.Errorf("Address criteria not found")
+	}
+
+	lookback := q.Lookback
+	if lookback <= 0 {
+		lookback = DefaultNATLookback
+	}
+	start := q.Timestamp - lookback
+	start -= start % fdb.aggregation
+
+	flows := make([]*netflow.Flow, 0)
+	for ts := start; ts <= q.Timestamp; ts += fdb.aggregation {
+		flows = append(flows, fdb.getNATFlowsByTS(ts, q)...)
+	}
+
+	return fdb.natBindings(flows, q), nil
+}
+
+// getNATFlowsByTS returns the flows in time slot `ts` translated to the outside address and port of `q`
+func (fdb *FlowDatabase) getNATFlowsByTS(ts int64, q *NATQuery) []*netflow.Flow {
+	// timeslot in memory?
+	fdb.lock.RLock()
+	timeGroups, ok := fdb.flows[ts]
+	fdb.lock.RUnlock()
+
+	res := make([]*netflow.Flow, 0)
+	if !ok {
+		// not in memory, try to load from disk
+		flows, err := fdb.readFromDisc(ts, q.Agent)
+		if err != nil {
+			return res
+		}
+
+		for _, fl := range flows.Flows {
+			if !net.IP(fl.PostNatSrcAddr).Equal(q.Addr) {
+				continue
+			}
+			if q.Port != 0 && fl.PostNaptSrcPort != uint32(q.Port) {
+				continue
+			}
+			res = append(res, fl)
+		}
+		return res
+	}
+
+	tg := timeGroups[q.Agent]
+	if tg == nil {
+		return res
+	}
+
+	candidates := []*avltree.Tree{tg.PostNATSrcAddr.Get(q.Addr)}
+	if q.Port != 0 {
+		candidates = append(candidates, tg.PostNAPTSrcPort.Get(q.Port))
+	}
+
+	tree := avltree.Intersection(candidates)
+	if tree == nil {
+		return res
+	}
+
+	for _, fl := range tree.Dump() {
+		res = append(res, fl.(*netflow.Flow))
+	}
+	return res
+}
+
+// natBindings replays the NAT events in `flows` per inside address and port and
+// returns the bindings that were active at the time of `q`
+func (fdb *FlowDatabase) natBindings(flows []*netflow.Flow, q *NATQuery) []NATBinding {
+	sort.SliceStable(flows, func(i, j int) bool {
+		return fdb.natEventTime(flows[i]) < fdb.natEventTime(flows[j])
+	})
+
+	t := q.Timestamp * 1000
+	bindings := make(map[natKey]*NATBinding)
+	for _, fl := range flows {
+		k := natKey{addr: string(net.IP(fl.SrcAddr).To16()), port: fl.SrcPort}
+		evTime := fdb.natEventTime(fl)
+		event := uint8(fl.NatEvent)
+
+		switch {
+		case iana.NatEventCreates(event):
+			if evTime > t {
+				continue
+			}
+			bindings[k] = newNATBinding(fl, evTime)
+		case iana.NatEventDeletes(event):
+			b := bindings[k]
+			if b == nil || b.Deleted != 0 {
+				continue
+			}
+			if evTime < t {
+				delete(bindings, k)
+				continue
+			}
+			b.Deleted = evTime
+		case event == 0:
+			// Regular flow records of translated traffic prove the binding for their duration
+			if !fdb.flowActiveAt(fl, q.Timestamp) {
+				continue
+			}
+			if bindings[k] == nil {
+				bindings[k] = newNATBinding(fl, evTime)
+			}
+		}
+	}
+
+	res := make([]NATBinding, 0, len(bindings))
+	for _, b := range bindings {
+		res = append(res, *b)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Created != res[j].Created {
+			return res[i].Created < res[j].Created
+		}
+		if c := bytes.Compare(res[i].InsideAddr.To16(), res[j].InsideAddr.To16()); c != 0 {
+			return c < 0
+		}
+		return res[i].InsidePort < res[j].InsidePort
+	})
+
+	return res
+}
+
+func newNATBinding(fl *netflow.Flow, created int64) *NATBinding {
+	b := &NATBinding{
+		InsideAddr:  net.IP(fl.SrcAddr),
+		InsidePort:  fl.SrcPort,
+		OutsideAddr: net.IP(fl.PostNatSrcAddr),
+		OutsidePort: fl.PostNaptSrcPort,
+		Created:     created,
+	}
+	if fl.NatEvent != 0 {
+		b.Event = iana.NatEventName(uint8(fl.NatEvent))
+	}
+	return b
+}
+
+// natEventTime returns the time of the event reported by `fl` in ms since epoch
+func (fdb *FlowDatabase) natEventTime(fl *netflow.Flow) int64 {
+	if fl.FlowStart != 0 {
+		return int64(fl.FlowStart)
+	}
+	return fl.Timestamp * 1000
+}
+
+// flowActiveAt checks if flow `fl` was active at unix time `ts`
+func (fdb *FlowDatabase) flowActiveAt(fl *netflow.Flow, ts int64) bool {
+	if fl.FlowStart == 0 || fl.FlowEnd == 0 {
+		return fl.Timestamp <= ts && ts < fl.Timestamp+fdb.aggregation
+	}
+	return int64(fl.FlowStart) <= ts*1000 && ts*1000 <= int64(fl.FlowEnd)
+}
@@ -13,6 +13,7 @@ type Result struct {
 	Timestamps  []int64                // sorted timestamps
 	Data        map[int64]BreakdownMap // timestamps -> keys -> values
 	Aggregation int64
+	Metric      int
 }
 
 // WriteCSV writes the result as CSV into the writer
@@ -29,7 +30,11 @@ func (res *Result) WriteCSV(writer io.Writer) {
 		topKeys = append(topKeys, k)
 		headLine = append(headLine, k.Join("%s:%s"))
 	}
-	headLine = append(headLine, "Rest")
+	// Averages of the remaining flows can't be derived from the averages of their keys
+	withRest := res.Metric != MetricAvgPacketSize
+	if withRest {
+		headLine = append(headLine, "Rest")
+	}
 	w.Write(headLine)
 
 	for _, ts := range res.Timestamps {
@@ -43,10 +48,15 @@ func (res *Result) WriteCSV(writer io.Writer) {
 			if _, ok := buckets[k]; !ok {
 				line = append(line, "0")
 			} else {
-				line = append(line, fmt.Sprintf("%d", buckets[k]/uint64(res.Aggregation)*8))
+				line = append(line, fmt.Sprintf("%d", res.rate(buckets[k])))
 			}
 		}
 
+		if !withRest {
+			w.Write(line)
+			continue
+		}
+
 		// Remaining flows
 		var rest uint64
 		for k, v := range buckets {
@@ -54,6 +64,18 @@ func (res *Result) WriteCSV(writer io.Writer) {
 				rest += v
 			}
 		}
-		w.Write(append(line, fmt.Sprintf("%d", rest)))
+		w.Write(append(line, fmt.Sprintf("%d", res.rate(rest))))
+	}
+}
+
+// rate converts value `v` of a time slot to bits per second for bytes, packets per second for packets
+// and leaves flows per time slot and average packet sizes as they are
+func (res *Result) rate(v uint64) uint64 {
+	switch res.Metric {
+	case MetricBytes:
+		return v / uint64(res.Aggregation) * 8
+	case MetricPackets:
+		return v / uint64(res.Aggregation)
 	}
+	return v
 }
@@ -1,11 +1,7 @@
 package database
 
 import (
-	"net"
-
 	"github.com/bio-routing/tflow2/avltree"
-	"github.com/bio-routing/tflow2/convert"
-	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/intfmapper"
 
 	log "github.com/sirupsen/logrus"
@@ -15,6 +11,7 @@ import (
 // time into one object
 type TimeGroup struct {
 	Any               *mapTree // Workaround: Why a map? Because: cannot assign to flows[fl.Timestamp][rtr].Any
+	Family            *mapTree
 	SrcAddr           *mapTree
 	DstAddr           *mapTree
 	Protocol          *mapTree
@@ -28,51 +25,44 @@ type TimeGroup struct {
 	DstPfx            *mapTree
 	SrcPort           *mapTree
 	DstPort           *mapTree
+	TCPFlags          *mapTree
+	Tos               *mapTree
+	Dscp              *mapTree
+	IcmpType          *mapTree
+	IcmpCode          *mapTree
+	SrcVlan           *mapTree
+	DstVlan           *mapTree
+	SrcMac            *mapTree
+	DstMac            *mapTree
+	MplsLabel1        *mapTree
+	MplsLabel2        *mapTree
+	MplsLabel3        *mapTree
+	MplsTopLabelAddr  *mapTree
+	FwdStatus         *mapTree
+	DropReason        *mapTree
+	PostNATSrcAddr    *mapTree
+	PostNATDstAddr    *mapTree
+	PostNAPTSrcPort   *mapTree
+	PostNAPTDstPort   *mapTree
+	NatEvent          *mapTree
+	Application       *mapTree
 	InterfaceIDByName intfmapper.InterfaceIDByName
 }
 
-func (tg *TimeGroup) filterAndBreakdown(resSum *concurrentResSum, q *Query, iana *iana.IANA, intfMap intfmapper.InterfaceNameByID) BreakdownMap {
+// filter returns a tree of all flows of `tg` fulfilling the conditions and the filter of query `q`
+func (tg *TimeGroup) filter(q *Query) *avltree.Tree {
 	// candidates keeps a list of all trees that fulfill the queries criteria
 	candidates := make([]*avltree.Tree, 0)
-	for _, c := range q.Cond {
-		switch c.Field {
-		case FieldTimestamp:
-			continue
-		case FieldAgent:
+	for _, c := range prepareConditions(q.Cond, tg.InterfaceIDByName) {
+		index := tg.index(c.field)
+		if index == nil {
 			continue
-		case FieldProtocol:
-			candidates = append(candidates, tg.Protocol.Get(c.Operand[0]))
-		case FieldSrcAddr:
-			candidates = append(candidates, tg.SrcAddr.Get(net.IP(c.Operand)))
-		case FieldDstAddr:
-			candidates = append(candidates, tg.DstAddr.Get(net.IP(c.Operand)))
-		case FieldIntIn:
-			candidates = append(candidates, tg.IntIn.Get(convert.Uint16b(c.Operand)))
-		case FieldIntOut:
-			candidates = append(candidates, tg.IntOut.Get(convert.Uint16b(c.Operand)))
-		case FieldNextHop:
-			candidates = append(candidates, tg.NextHop.Get(net.IP(c.Operand)))
-		case FieldSrcAs:
-			candidates = append(candidates, tg.SrcAs.Get(convert.Uint32b(c.Operand)))
-		case FieldDstAs:
-			candidates = append(candidates, tg.DstAs.Get(convert.Uint32b(c.Operand)))
-		case FieldNextHopAs:
-			candidates = append(candidates, tg.NextHopAs.Get(convert.Uint32b(c.Operand)))
-		case FieldSrcPort:
-			candidates = append(candidates, tg.SrcPort.Get(c.Operand))
-		case FieldDstPort:
-			candidates = append(candidates, tg.DstPort.Get(c.Operand))
-		case FieldSrcPfx:
-			candidates = append(candidates, tg.SrcPfx.Get(c.Operand))
-		case FieldDstPfx:
-			candidates = append(candidates, tg.DstPfx.Get(c.Operand))
-		case FieldIntInName:
-			intID := tg.InterfaceIDByName[string(c.Operand)]
-			candidates = append(candidates, tg.IntIn.Get(intID))
-		case FieldIntOutName:
-			intID := tg.InterfaceIDByName[string(c.Operand)]
-			candidates = append(candidates, tg.IntOut.Get(intID))
 		}
+		candidates = append(candidates, c.lookup(index))
+	}
+
+	if q.Filter != nil {
+		candidates = append(candidates, tg.evaluate(prepareExpression(q.Filter, tg.InterfaceIDByName)))
 	}
 
 	if len(candidates) == 0 {
@@ -85,8 +75,82 @@ func (tg *TimeGroup) filterAndBreakdown(resSum *concurrentResSum, q *Query, iana
 		log.Warningf("Intersection result was empty!")
 	}
 
-	// Breakdown
-	resTime := make(BreakdownMap)
-	res.Each(breakdown, intfMap, iana, q.Breakdown, resSum, resTime)
-	return resTime
+	return res
+}
+
+// index returns the index of field `field` or nil if the field is not indexed
+func (tg *TimeGroup) index(field int) *mapTree {
+	switch field {
+	case FieldFamily:
+		return tg.Family
+	case FieldSrcAddr:
+		return tg.SrcAddr
+	case FieldDstAddr:
+		return tg.DstAddr
+	case FieldProtocol:
+		return tg.Protocol
+	case FieldIntIn:
+		return tg.IntIn
+	case FieldIntOut:
+		return tg.IntOut
+	case FieldNextHop:
+		return tg.NextHop
+	case FieldSrcAs:
+		return tg.SrcAs
+	case FieldDstAs:
+		return tg.DstAs
+	case FieldNextHopAs:
+		return tg.NextHopAs
+	case FieldSrcPfx:
+		return tg.SrcPfx
+	case FieldDstPfx:
+		return tg.DstPfx
+	case FieldSrcPort:
+		return tg.SrcPort
+	case FieldDstPort:
+		return tg.DstPort
+	case FieldTCPFlags:
+		return tg.TCPFlags
+	case FieldTos:
+		return tg.Tos
+	case FieldDscp:
+		return tg.Dscp
+	case FieldIcmpType:
+		return tg.IcmpType
+	case FieldIcmpCode:
+		return tg.IcmpCode
+	case FieldSrcVlan:
+		return tg.SrcVlan
+	case FieldDstVlan:
+		return tg.DstVlan
+	case FieldSrcMac:
+		return tg.SrcMac
+	case FieldDstMac:
+		return tg.DstMac
+	case FieldMplsLabel1:
+		return tg.MplsLabel1
+	case FieldMplsLabel2:
+		return tg.MplsLabel2
+	case FieldMplsLabel3:
+		return tg.MplsLabel3
+	case FieldMplsTopLabelAddr:
+		return tg.MplsTopLabelAddr
+	case FieldFwdStatus:
+		return tg.FwdStatus
+	case FieldDropReason:
+		return tg.DropReason
+	case FieldPostNATSrcAddr:
+		return tg.PostNATSrcAddr
+	case FieldPostNATDstAddr:
+		return tg.PostNATDstAddr
+	case FieldPostNAPTSrcPort:
+		return tg.PostNAPTSrcPort
+	case FieldPostNAPTDstPort:
+		return tg.PostNAPTDstPort
+	case FieldNatEvent:
+		return tg.NatEvent
+	case FieldApplication:
+		return tg.Application
+	}
+	return nil
 }
@@ -0,0 +1,274 @@
+package frontend
+
+import (
+	"strings"
+
+	"github.com/bio-routing/tflow2/database"
+	"github.com/pkg/errors"
+)
+
+// filterParser parses filter expressions like
+// (DstPort=80 OR DstPort=443) AND NOT SrcAs=65000 or DstPort IN (80, 443).
+// Conditions use the same field names, operators and values as URL parameters.
+type filterParser struct {
+	fe     *Frontend
+	tokens []string
+	pos    int
+}
+
+// translateFilter translates filter expression `filter` to the internal representation of expressions
+func (fe *Frontend) translateFilter(filter string) (*database.Expression, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.Errorf("empty filter")
+	}
+
+	p := &filterParser{
+		fe:     fe,
+		tokens: tokens,
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, errors.Errorf("unexpected %q in filter", p.tokens[p.pos])
+	}
+
+	return e, nil
+}
+
+// tokenizeFilter splits filter expression `filter` into parentheses, commas, comparison operators,
+// words and double quoted values
+func tokenizeFilter(filter string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '=':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '!':
+			if i+1 >= len(filter) || filter[i+1] != '=' {
+				return nil, errors.Errorf("unexpected ! in filter")
+			}
+			tokens = append(tokens, "!=")
+			i += 2
+		case c == '"':
+			j := strings.IndexByte(filter[i+1:], '"')
+			if j < 0 {
+				return nil, errors.Errorf("unterminated quote in filter")
+			}
+			tokens = append(tokens, filter[i:i+j+2])
+			i += j + 2
+		default:
+			j := i
+			for j < len(filter) && !strings.ContainsRune(" \t\n()=,!\"", rune(filter[j])) {
+				j++
+			}
+			tokens = append(tokens, filter[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// peek returns the current token or an empty string at the end of the filter
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// next returns the current token and advances to the next one
+func (p *filterParser) next() string {
+	t := p.peek()
+	if t != "" {
+		p.pos++
+	}
+	return t
+}
+
+// keyword checks if the current token is keyword `kw` (case insensitive) and consumes it if so
+func (p *filterParser) keyword(kw string) bool {
+	if strings.EqualFold(p.peek(), kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes token `t` or fails
+func (p *filterParser) expect(t string) error {
+	if got := p.next(); got != t {
+		return errors.Errorf("expected %q in filter, got %q", t, got)
+	}
+	return nil
+}
+
+// parseOr parses expressions joined by OR
+func (p *filterParser) parseOr() (*database.Expression, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []*database.Expression{e}
+	for p.keyword("OR") {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, e)
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return database.Or(operands...), nil
+}
+
+// parseAnd parses expressions joined by AND
+func (p *filterParser) parseAnd() (*database.Expression, error) {
+	e, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []*database.Expression{e}
+	for p.keyword("AND") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, e)
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return database.And(operands...), nil
+}
+
+// parseNot parses negated expressions, parenthesized expressions and conditions
+func (p *filterParser) parseNot() (*database.Expression, error) {
+	if p.keyword("NOT") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return database.Not(e), nil
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	return p.parseCondition()
+}
+
+// parseCondition parses conditions of the form <field>[.<operator>]=<value>, <field>!=<value>
+// and <field> IN (<value>, ...)
+func (p *filterParser) parseCondition() (*database.Expression, error) {
+	field := p.next()
+	if field == "" || strings.ContainsAny(field, "(),=!\"") {
+		return nil, errors.Errorf("expected field in filter, got %q", field)
+	}
+
+	name := field
+	if i := strings.IndexRune(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if fieldNum := database.GetFieldByName(name); fieldNum == database.FieldTimestamp || fieldNum == database.FieldAgent {
+		return nil, errors.Errorf("field %s is not supported in filters", name)
+	}
+
+	if p.keyword("IN") {
+		if name != field {
+			return nil, errors.Errorf("operator is not supported with IN: %s", field)
+		}
+		return p.parseIn(field)
+	}
+
+	switch op := p.next(); op {
+	case "=":
+	case "!=":
+		if name != field {
+			return nil, errors.Errorf("operator is not supported with !=: %s", field)
+		}
+		field += ".ne"
+	default:
+		return nil, errors.Errorf("expected = or != after %s in filter, got %q", field, op)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	cond, err := p.fe.translateCondition(field, value)
+	if err != nil {
+		return nil, err
+	}
+	return database.Cond(*cond), nil
+}
+
+// parseIn parses the list of values of an IN condition on field `field`
+func (p *filterParser) parseIn(field string) (*database.Expression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	operands := make([][]byte, 0)
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		cond, err := p.fe.translateCondition(field, value)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, cond.Operand)
+
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	return database.In(database.GetFieldByName(field), operands...), nil
+}
+
+// parseValue parses a plain or double quoted value
+func (p *filterParser) parseValue() (string, error) {
+	value := p.next()
+	switch {
+	case value == "" || strings.ContainsAny(value[:1], "(),=!"):
+		return "", errors.Errorf("expected value in filter, got %q", value)
+	case value[0] == '"':
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
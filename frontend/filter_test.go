@@ -0,0 +1,96 @@
+package frontend
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateFilter(t *testing.T) {
+	assert := assert.New(t)
+	fe := Frontend{}
+
+	port := func(p uint16) *database.Expression {
+		return database.Cond(database.Condition{Field: database.FieldDstPort, Operator: database.OpEqual, Operand: convert.Uint16Byte(p)})
+	}
+	as := func(op int, asn uint32) *database.Expression {
+		return database.Cond(database.Condition{Field: database.FieldSrcAs, Operator: op, Operand: convert.Uint32Byte(asn)})
+	}
+
+	tests := []struct {
+		Filter        string
+		Expected      *database.Expression
+		ExpectedError string
+	}{
+		{
+			Filter:   "DstPort=80",
+			Expected: port(80),
+		},
+		{
+			Filter:   "(DstPort=80 OR DstPort=443) AND NOT SrcAs=65000",
+			Expected: database.And(database.Or(port(80), port(443)), database.Not(as(database.OpEqual, 65000))),
+		},
+		{
+			Filter:   "DstPort=80 or DstPort=443 and SrcAs!=65000",
+			Expected: database.Or(port(80), database.And(port(443), as(database.OpUnequal, 65000))),
+		},
+		{
+			Filter:   "DstPort IN (80, 443)",
+			Expected: database.In(database.FieldDstPort, convert.Uint16Byte(80), convert.Uint16Byte(443)),
+		},
+		{
+			Filter:   "SrcAs.gt=64511",
+			Expected: as(database.OpGreater, 64511),
+		},
+		{
+			Filter: `IntInName="xe-0/0/1"`,
+			Expected: database.Cond(database.Condition{
+				Field:    database.FieldIntInName,
+				Operator: database.OpEqual,
+				Operand:  []byte("xe-0/0/1"),
+			}),
+		},
+		{
+			Filter:        "(DstPort=80",
+			ExpectedError: `expected ")" in filter, got ""`,
+		},
+		{
+			Filter:        "DstPort=80 DstPort=443",
+			ExpectedError: `unexpected "DstPort" in filter`,
+		},
+		{
+			Filter:        "DstPort.gt IN (80)",
+			ExpectedError: "operator is not supported with IN: DstPort.gt",
+		},
+		{
+			Filter:        "Agent=test01.pop01",
+			ExpectedError: "field Agent is not supported in filters",
+		},
+		{
+			Filter:        "Foo=bar",
+			ExpectedError: "unknown field: Foo",
+		},
+		{
+			Filter:        "",
+			ExpectedError: "empty filter",
+		},
+	}
+
+	for _, test := range tests {
+		e, err := fe.translateFilter(test.Filter)
+		if test.ExpectedError != "" {
+			assert.EqualError(err, test.ExpectedError, test.Filter)
+			continue
+		}
+
+		assert.NoError(err, test.Filter)
+		assert.Equal(test.Expected, e, test.Filter)
+	}
+
+	query, errors := fe.translateQuery(url.Values{"Filter": []string{"DstPort IN (80, 443)"}})
+	assert.Nil(errors)
+	assert.NotNil(query.Filter)
+}
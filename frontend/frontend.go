@@ -16,6 +16,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	_ "net/http/pprof" // Needed for profiling only
 	"strings"
@@ -23,29 +24,39 @@ import (
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/database"
 	"github.com/bio-routing/tflow2/iana"
+	"github.com/bio-routing/tflow2/ifcounters"
 	"github.com/bio-routing/tflow2/intfmapper"
 	"github.com/bio-routing/tflow2/stats"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// TemplateSource provides the contents of a NetFlow v9/IPFIX template cache
+type TemplateSource interface {
+	Templates() interface{}
+}
+
 // Frontend represents the web interface
 type Frontend struct {
-	protocols  map[string]string
-	indexHTML  string
-	flowDB     *database.FlowDatabase
-	intfMapper *intfmapper.Mapper
-	iana       *iana.IANA
-	config     *config.Config
+	protocols       map[string]string
+	indexHTML       string
+	flowDB          *database.FlowDatabase
+	intfMapper      *intfmapper.Mapper
+	iana            *iana.IANA
+	ifCounters      *ifcounters.Cache
+	templateSources map[string]TemplateSource
+	config          *config.Config
 }
 
 // New creates a new `Frontend`
-func New(fdb *database.FlowDatabase, intfMapper *intfmapper.Mapper, iana *iana.IANA, config *config.Config) *Frontend {
+func New(fdb *database.FlowDatabase, intfMapper *intfmapper.Mapper, iana *iana.IANA, ifCounters *ifcounters.Cache, templateSources map[string]TemplateSource, config *config.Config) *Frontend {
 	fe := &Frontend{
-		flowDB:     fdb,
-		intfMapper: intfMapper,
-		iana:       iana,
-		config:     config,
+		flowDB:          fdb,
+		intfMapper:      intfMapper,
+		iana:            iana,
+		ifCounters:      ifCounters,
+		templateSources: templateSources,
+		config:          config,
 	}
 	fe.populateIndexHTML()
 	http.HandleFunc("/", fe.httpHandler)
@@ -71,10 +82,12 @@ func (fe *Frontend) agentsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	type routersJSON struct {
 		Agents []routerJSON
+		Groups map[string][]string
 	}
 
 	data := routersJSON{
 		Agents: make([]routerJSON, 0),
+		Groups: fe.config.AgentGroups,
 	}
 
 	for _, agent := range fe.config.Agents {
@@ -99,6 +112,65 @@ func (fe *Frontend) agentsHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s", string(b))
 }
 
+func (fe *Frontend) countersHandler(w http.ResponseWriter, r *http.Request) {
+	type interfaceJSON struct {
+		Name string
+		ifcounters.Counters
+	}
+	type agentJSON struct {
+		Name       string
+		Interfaces []interfaceJSON
+	}
+	type agentsJSON struct {
+		Agents []agentJSON
+	}
+
+	data := agentsJSON{
+		Agents: make([]agentJSON, 0),
+	}
+
+	for _, agent := range fe.config.Agents {
+		a := agentJSON{
+			Name:       agent.Name,
+			Interfaces: make([]interfaceJSON, 0),
+		}
+
+		intfmap := fe.intfMapper.GetInterfaceNameByID(agent.Name)
+		for _, c := range fe.ifCounters.Get(net.ParseIP(agent.IPAddress)) {
+			a.Interfaces = append(a.Interfaces, interfaceJSON{
+				Name:     intfmap[uint16(c.IfIndex)],
+				Counters: c,
+			})
+		}
+
+		data.Agents = append(data.Agents, a)
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Marshal failed: %v", err), 500)
+	}
+
+	fmt.Fprintf(w, "%s", string(b))
+}
+
+// templatesHandler dumps the contents of the template caches for debugging
+func (fe *Frontend) templatesHandler(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	for name, src := range fe.templateSources {
+		data[name] = src.Templates()
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Marshal failed: %v", err), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s", string(b))
+}
+
 func (fe *Frontend) httpHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -111,12 +183,19 @@ func (fe *Frontend) httpHandler(w http.ResponseWriter, r *http.Request) {
 		fe.queryHandler(w, r)
 	case "/metrics":
 		stats.Metrics(w)
+		fe.ifCounters.Metrics(w, fe.config.AgentsNameByIP)
 	case "/protocols":
 		fe.getProtocols(w, r)
 	case "/promquery":
 		fe.prometheusHandler(w, r)
+	case "/natquery":
+		fe.natQueryHandler(w, r)
 	case "/agents":
 		fe.agentsHandler(w, r)
+	case "/counters":
+		fe.countersHandler(w, r)
+	case "/templates":
+		fe.templatesHandler(w, r)
 	case "/tflow2.css":
 		fileHandler(w, r, "tflow2.css")
 	case "/tflow2.js":
@@ -180,3 +259,27 @@ func (fe *Frontend) queryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/csv")
 	result.WriteCSV(w)
 }
+
+// natQueryHandler answers which inside address and port used a public address and port at a given time
+func (fe *Frontend) natQueryHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := translateNATQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to parse query: %v", err), 422)
+		return
+	}
+
+	bindings, err := fe.flowDB.RunNATQuery(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query failed: %v", err), 500)
+		return
+	}
+
+	b, err := json.Marshal(bindings)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Marshal failed: %v", err), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s", string(b))
+}
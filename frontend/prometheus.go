@@ -8,6 +8,17 @@ import (
 	"github.com/bio-routing/tflow2/database"
 )
 
+// prometheusMetrics are the names and descriptions of the Prometheus metrics of query metrics
+var prometheusMetrics = map[int]struct {
+	name string
+	help string
+}{
+	database.MetricBytes:         {"tflow_bytes", "Bytes transmitted"},
+	database.MetricPackets:       {"tflow_packets", "Packets transmitted"},
+	database.MetricFlows:         {"tflow_flows", "Flow records received"},
+	database.MetricAvgPacketSize: {"tflow_avg_packet_size_bytes", "Average size of packets transmitted"},
+}
+
 func (fe *Frontend) prometheusHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("r.URL.Query(): %s\n", r.URL.Query())
 	query, errors := fe.translateQuery(r.URL.Query())
@@ -51,37 +62,29 @@ func (fe *Frontend) prometheusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Hints for Prometheus
-	fmt.Fprintln(w, "# HELP tflow_bytes Bytes transmitted")
-	fmt.Fprintln(w, "# TYPE tflow_bytes gauge")
+	metric := prometheusMetrics[query.Metric]
+	fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", metric.name)
 
 	ts := result.Timestamps[0]
 
+	// Label the series with the agents, agent groups or AllAgents as requested
+	agent := r.URL.Query().Get("Agent")
+
 	// Print the data
 	if len(result.TopKeys) > 0 {
 		for key := range result.TopKeys {
 			if _, ok := result.Data[ts][key]; ok {
-				fmt.Fprintf(w, "tflow_bytes{agent=%q,%s} %d\n", getAgent(query), formatBreakdownKey(&key), result.Data[ts][key])
+				fmt.Fprintf(w, "%s{agent=%q,%s} %d\n", metric.name, agent, formatBreakdownKey(&key), result.Data[ts][key])
 			}
 		}
 	} else {
 		for key, val := range result.Data[ts] {
-			fmt.Fprintf(w, "tflow_bytes{agent=%q,%s} %d\n", getAgent(query), formatBreakdownKey(&key), val)
+			fmt.Fprintf(w, "%s{agent=%q,%s} %d\n", metric.name, agent, formatBreakdownKey(&key), val)
 		}
 	}
 }
 
-func getAgent(q database.Query) string {
-	for _, c := range q.Cond {
-		if c.Field != database.FieldAgent {
-			continue
-		}
-
-		return string(c.Operand)
-	}
-
-	return ""
-}
-
 // formats a breakdown key for prometheus
 // see tests for examples
 func formatBreakdownKey(key *database.BreakdownKey) string {
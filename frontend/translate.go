@@ -8,23 +8,14 @@ import (
 
 	"github.com/bio-routing/tflow2/convert"
 	"github.com/bio-routing/tflow2/database"
+	"github.com/bio-routing/tflow2/iana"
+	"github.com/bio-routing/tflow2/packet"
 	"github.com/pkg/errors"
 )
 
-func (fe *Frontend) translateCondition(field, value string) (*database.Condition, error) {
-	var operatorStr string
-
-	// Extract operator if included in field name
-	i := strings.IndexRune(field, '.')
-	if i > 0 {
-		operatorStr = field[i+1:]
-		field = field[:i]
-	}
-
+// translateOperand translates value `value` of field `field` to the internal representation of operands
+func (fe *Frontend) translateOperand(fieldNum int, field string, value string) ([]byte, error) {
 	var operand []byte
-	var operator int
-	fieldNum := database.GetFieldByName(field)
-
 	switch fieldNum {
 	case database.FieldTimestamp:
 		op, err := strconv.Atoi(value)
@@ -48,7 +39,8 @@ func (fe *Frontend) translateCondition(field, value string) (*database.Condition
 		}
 		operand = convert.Uint16Byte(uint16(op))
 
-	case database.FieldSrcAddr, database.FieldDstAddr, database.FieldNextHop:
+	case database.FieldSrcAddr, database.FieldDstAddr, database.FieldNextHop, database.FieldMplsTopLabelAddr,
+		database.FieldPostNATSrcAddr, database.FieldPostNATDstAddr:
 		operand = convert.IPByteSlice(value)
 
 	case database.FieldSrcAs, database.FieldDstAs, database.FieldNextHopAs:
@@ -65,13 +57,90 @@ func (fe *Frontend) translateCondition(field, value string) (*database.Condition
 		}
 		operand = []byte(pfx.String())
 
-	case database.FieldIntInName, database.FieldIntOutName, database.FieldAgent:
+	case database.FieldIntInName, database.FieldIntOutName, database.FieldAgent, database.FieldApplication:
 		operand = []byte(value)
 
+	case database.FieldTCPFlags:
+		flags, err := packet.ParseTCPFlags(value)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint16Byte(flags)
+
+	case database.FieldTos, database.FieldDscp, database.FieldIcmpType, database.FieldIcmpCode:
+		op, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint8Byte(uint8(op))
+
+	case database.FieldSrcVlan, database.FieldDstVlan:
+		op, err := strconv.ParseUint(value, 10, 12)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint16Byte(uint16(op))
+
+	case database.FieldSrcMac, database.FieldDstMac:
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			return nil, err
+		}
+		operand = []byte(mac)
+
+	case database.FieldMplsLabel1, database.FieldMplsLabel2, database.FieldMplsLabel3:
+		op, err := strconv.ParseUint(value, 10, 20)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint32Byte(uint32(op))
+
+	case database.FieldFwdStatus:
+		class, err := iana.ParseFwdStatusClass(value)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint8Byte(class)
+
+	case database.FieldDropReason:
+		status, err := iana.ParseDropReason(value)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint8Byte(status)
+
+	case database.FieldPostNAPTSrcPort, database.FieldPostNAPTDstPort:
+		op, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint16Byte(uint16(op))
+
+	case database.FieldNatEvent:
+		event, err := iana.ParseNatEvent(value)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint8Byte(event)
+
 	default:
 		return nil, errors.Errorf("unknown field: %s", field)
 	}
 
+	return operand, nil
+}
+
+func (fe *Frontend) translateCondition(field, value string) (*database.Condition, error) {
+	var operatorStr string
+
+	// Extract operator if included in field name
+	i := strings.IndexRune(field, '.')
+	if i > 0 {
+		operatorStr = field[i+1:]
+		field = field[:i]
+	}
+
+	var operator int
 	switch operatorStr {
 	case "eq", "":
 		operator = database.OpEqual
@@ -81,10 +150,66 @@ func (fe *Frontend) translateCondition(field, value string) (*database.Condition
 		operator = database.OpGreater
 	case "lt":
 		operator = database.OpSmaller
+	case "range":
+		operator = database.OpRange
+	case "within":
+		operator = database.OpWithin
 	default:
 		return nil, errors.Errorf("invalid operator: %s", operatorStr)
 	}
 
+	fieldNum := database.GetFieldByName(field)
+	if fieldNum < 0 {
+		return nil, errors.Errorf("unknown field: %s", field)
+	}
+
+	if !operatorSupported(fieldNum, operator) {
+		return nil, errors.Errorf("operator %s is not supported for field %s", operatorStr, field)
+	}
+
+	var operand []byte
+	var err error
+	switch operator {
+	case database.OpRange:
+		bounds := strings.Split(value, "-")
+		if len(bounds) != 2 {
+			return nil, errors.Errorf("invalid range: %s", value)
+		}
+
+		lower, err := fe.translateOperand(fieldNum, field, bounds[0])
+		if err != nil {
+			return nil, err
+		}
+
+		upper, err := fe.translateOperand(fieldNum, field, bounds[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(lower) != len(upper) {
+			return nil, errors.Errorf("invalid range: %s", value)
+		}
+		operand = append(lower, upper...)
+
+	case database.OpWithin:
+		_, pfx, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+
+		addr := pfx.IP
+		if len(pfx.Mask) == net.IPv4len {
+			addr = addr.To4()
+		}
+		operand = append([]byte(addr), pfx.Mask...)
+
+	default:
+		operand, err = fe.translateOperand(fieldNum, field, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &database.Condition{
 		Field:    fieldNum,
 		Operator: operator,
@@ -92,6 +217,23 @@ func (fe *Frontend) translateCondition(field, value string) (*database.Condition
 	}, nil
 }
 
+// operatorSupported checks if operator `operator` can be applied to field `field`
+func operatorSupported(field int, operator int) bool {
+	switch field {
+	case database.FieldAgent:
+		return operator == database.OpEqual
+	case database.FieldTimestamp:
+		return operator != database.OpUnequal && operator != database.OpWithin
+	case database.FieldSrcPfx, database.FieldDstPfx, database.FieldIntInName, database.FieldIntOutName, database.FieldApplication:
+		// Names and prefixes have no order
+		return operator == database.OpEqual || operator == database.OpUnequal
+	case database.FieldSrcAddr, database.FieldDstAddr, database.FieldNextHop, database.FieldMplsTopLabelAddr,
+		database.FieldPostNATSrcAddr, database.FieldPostNATDstAddr:
+		return true
+	}
+	return operator != database.OpWithin
+}
+
 // translateQuery translates URL parameters to the internal representation of a query
 func (fe *Frontend) translateQuery(params url.Values) (q database.Query, errors []error) {
 	for key, values := range params {
@@ -102,6 +244,16 @@ func (fe *Frontend) translateQuery(params url.Values) (q database.Query, errors
 			q.TopN, err = strconv.Atoi(value)
 		case "Breakdown":
 			err = q.Breakdown.Set(strings.Split(value, ","))
+		case "Filter":
+			q.Filter, err = fe.translateFilter(value)
+		case "Agent":
+			var conds database.Conditions
+			conds, err = fe.translateAgents(value)
+			q.Cond = append(q.Cond, conds...)
+		case "Dedup":
+			q.Dedup, err = translateDedup(value)
+		case "Metric":
+			q.Metric, err = translateMetric(value)
 		default:
 			var cond *database.Condition
 			cond, err = fe.translateCondition(key, value)
@@ -116,3 +268,105 @@ func (fe *Frontend) translateQuery(params url.Values) (q database.Query, errors
 
 	return
 }
+
+// AllAgents selects all agents in queries
+const AllAgents = "*"
+
+// translateAgents translates a comma separated list of agents, agent groups or AllAgents
+// to one condition per agent
+func (fe *Frontend) translateAgents(value string) (database.Conditions, error) {
+	agents := make([]string, 0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			return nil, errors.Errorf("empty agent name: %s", value)
+		case name == AllAgents && fe.config != nil:
+			for _, agent := range fe.config.Agents {
+				agents = append(agents, agent.Name)
+			}
+		case fe.config != nil && fe.config.AgentGroups[name] != nil:
+			agents = append(agents, fe.config.AgentGroups[name]...)
+		default:
+			agents = append(agents, name)
+		}
+	}
+
+	conds := make(database.Conditions, 0, len(agents))
+	seen := make(map[string]struct{})
+	for _, agent := range agents {
+		if _, ok := seen[agent]; ok {
+			continue
+		}
+		seen[agent] = struct{}{}
+
+		conds = append(conds, database.Condition{
+			Field:    database.FieldAgent,
+			Operator: database.OpEqual,
+			Operand:  []byte(agent),
+		})
+	}
+
+	return conds, nil
+}
+
+// translateDedup translates the name of a de-duplication mode
+func translateDedup(value string) (int, error) {
+	switch value {
+	case "none", "":
+		return database.DedupNone, nil
+	case "max":
+		return database.DedupMax, nil
+	case "flow":
+		return database.DedupFlow, nil
+	}
+	return 0, errors.Errorf("invalid de-duplication mode: %s", value)
+}
+
+// translateMetric translates the name of a metric
+func translateMetric(value string) (int, error) {
+	metric := database.GetMetricByName(value)
+	if metric < 0 {
+		return 0, errors.Errorf("invalid metric: %s", value)
+	}
+	return metric, nil
+}
+
+// translateNATQuery translates URL parameters to a NAT binding query
+func translateNATQuery(params url.Values) (*database.NATQuery, error) {
+	q := &database.NATQuery{
+		Agent: params.Get("Agent"),
+	}
+
+	if q.Agent == "" {
+		return nil, errors.Errorf("Agent is mandatory")
+	}
+
+	q.Addr = net.ParseIP(params.Get("Addr"))
+	if q.Addr == nil {
+		return nil, errors.Errorf("invalid address: %s", params.Get("Addr"))
+	}
+
+	if value := params.Get("Port"); value != "" {
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid port")
+		}
+		q.Port = uint16(port)
+	}
+
+	ts, err := strconv.ParseInt(params.Get("Timestamp"), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid timestamp")
+	}
+	q.Timestamp = ts
+
+	if value := params.Get("Lookback"); value != "" {
+		q.Lookback, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid lookback")
+		}
+	}
+
+	return q, nil
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/database"
 	"github.com/stretchr/testify/assert"
 )
@@ -29,6 +30,24 @@ func TestTranslateCondition(t *testing.T) {
 			ExpectedField:    database.FieldTimestamp,
 			ExpectedOperator: database.OpSmaller,
 		},
+		{
+			Key:              "DstPort.range",
+			Value:            "1024-65535",
+			ExpectedField:    database.FieldDstPort,
+			ExpectedOperator: database.OpRange,
+		},
+		{
+			Key:              "SrcAddr.within",
+			Value:            "10.0.0.0/8",
+			ExpectedField:    database.FieldSrcAddr,
+			ExpectedOperator: database.OpWithin,
+		},
+		{
+			Key:              "Protocol.ne",
+			Value:            "17",
+			ExpectedField:    database.FieldProtocol,
+			ExpectedOperator: database.OpUnequal,
+		},
 		{
 			Key:              "Protocol.eq",
 			Value:            "6",
@@ -53,6 +72,72 @@ func TestTranslateCondition(t *testing.T) {
 			ExpectedField:    database.FieldSrcPfx,
 			ExpectedOperator: database.OpEqual,
 		},
+		{
+			Key:              "TCPFlags",
+			Value:            "SYN",
+			ExpectedField:    database.FieldTCPFlags,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "Dscp",
+			Value:            "46",
+			ExpectedField:    database.FieldDscp,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "SrcVlan",
+			Value:            "100",
+			ExpectedField:    database.FieldSrcVlan,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "SrcMac",
+			Value:            "00:11:22:33:44:55",
+			ExpectedField:    database.FieldSrcMac,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "MplsLabel1",
+			Value:            "16001",
+			ExpectedField:    database.FieldMplsLabel1,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "FwdStatus",
+			Value:            "Dropped",
+			ExpectedField:    database.FieldFwdStatus,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "DropReason",
+			Value:            "ACL deny",
+			ExpectedField:    database.FieldDropReason,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "PostNATSrcAddr",
+			Value:            "198.51.100.1",
+			ExpectedField:    database.FieldPostNATSrcAddr,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "PostNAPTSrcPort",
+			Value:            "40000",
+			ExpectedField:    database.FieldPostNAPTSrcPort,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "NatEvent",
+			Value:            "NAT44 session create",
+			ExpectedField:    database.FieldNatEvent,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "Application",
+			Value:            "http",
+			ExpectedField:    database.FieldApplication,
+			ExpectedOperator: database.OpEqual,
+		},
 	}
 
 	fe := Frontend{}
@@ -66,6 +151,70 @@ func TestTranslateCondition(t *testing.T) {
 
 }
 
+func TestTranslateConditionOperand(t *testing.T) {
+	assert := assert.New(t)
+	fe := Frontend{}
+
+	tests := []struct {
+		Key             string
+		Value           string
+		ExpectedOperand []byte
+		ExpectedError   string
+	}{
+		{
+			Key:             "DstPort.range",
+			Value:           "1024-65535",
+			ExpectedOperand: []byte{4, 0, 255, 255},
+		},
+		{
+			Key:             "SrcAddr.range",
+			Value:           "10.0.0.1-10.0.0.50",
+			ExpectedOperand: []byte{10, 0, 0, 1, 10, 0, 0, 50},
+		},
+		{
+			Key:             "SrcAddr.within",
+			Value:           "10.0.0.0/8",
+			ExpectedOperand: []byte{10, 0, 0, 0, 255, 0, 0, 0},
+		},
+		{
+			Key:           "DstPort.range",
+			Value:         "1024",
+			ExpectedError: "invalid range: 1024",
+		},
+		{
+			Key:           "SrcAddr.range",
+			Value:         "10.0.0.1-2001:db8::1",
+			ExpectedError: "invalid range: 10.0.0.1-2001:db8::1",
+		},
+		{
+			Key:           "DstPort.within",
+			Value:         "10.0.0.0/8",
+			ExpectedError: "operator within is not supported for field DstPort",
+		},
+		{
+			Key:           "Application.gt",
+			Value:         "http",
+			ExpectedError: "operator gt is not supported for field Application",
+		},
+		{
+			Key:           "DstPort.foo",
+			Value:         "80",
+			ExpectedError: "invalid operator: foo",
+		},
+	}
+
+	for _, test := range tests {
+		cond, err := fe.translateCondition(test.Key, test.Value)
+		if test.ExpectedError != "" {
+			assert.EqualError(err, test.ExpectedError, test.Key)
+			continue
+		}
+
+		assert.NoError(err, test.Key)
+		assert.Equal(test.ExpectedOperand, cond.Operand, test.Key)
+	}
+}
+
 func TestTranslateQuery(t *testing.T) {
 	assert := assert.New(t)
 	fe := Frontend{}
@@ -80,4 +229,107 @@ func TestTranslateQuery(t *testing.T) {
 
 	query, errors = fe.translateQuery(url.Values{"Unknown": []string{"foo"}})
 	assert.EqualError(errors[0], "unknown field: Unknown")
+
+	query, errors = fe.translateQuery(url.Values{"Metric": []string{"packets"}})
+	assert.Nil(errors)
+	assert.Equal(database.MetricPackets, query.Metric)
+
+	query, errors = fe.translateQuery(url.Values{"Metric": []string{"foo"}})
+	assert.EqualError(errors[0], "invalid metric: foo")
+}
+
+func TestTranslateAgents(t *testing.T) {
+	assert := assert.New(t)
+	fe := Frontend{
+		config: &config.Config{
+			Agents: []config.Agent{
+				{Name: "bb01.fra01"},
+				{Name: "bb01.ams01"},
+				{Name: "core01.fra01"},
+			},
+			AgentGroups: map[string][]string{
+				"border": {"bb01.fra01", "bb01.ams01"},
+			},
+		},
+	}
+
+	agents := func(conds database.Conditions) []string {
+		res := make([]string, 0)
+		for _, c := range conds {
+			assert.Equal(database.FieldAgent, c.Field)
+			assert.Equal(database.OpEqual, c.Operator)
+			res = append(res, string(c.Operand))
+		}
+		return res
+	}
+
+	tests := []struct {
+		Value         string
+		Expected      []string
+		ExpectedError string
+	}{
+		{
+			Value:    "core01.fra01",
+			Expected: []string{"core01.fra01"},
+		},
+		{
+			Value:    "core01.fra01, bb01.ams01",
+			Expected: []string{"core01.fra01", "bb01.ams01"},
+		},
+		{
+			Value:    "border,bb01.fra01",
+			Expected: []string{"bb01.fra01", "bb01.ams01"},
+		},
+		{
+			Value:    "*",
+			Expected: []string{"bb01.fra01", "bb01.ams01", "core01.fra01"},
+		},
+		{
+			Value:         "bb01.fra01,",
+			ExpectedError: "empty agent name: bb01.fra01,",
+		},
+	}
+
+	for _, test := range tests {
+		conds, err := fe.translateAgents(test.Value)
+		if test.ExpectedError != "" {
+			assert.EqualError(err, test.ExpectedError, test.Value)
+			continue
+		}
+
+		assert.NoError(err, test.Value)
+		assert.Equal(test.Expected, agents(conds), test.Value)
+	}
+
+	query, errors := fe.translateQuery(url.Values{"Agent": []string{"border"}, "Dedup": []string{"flow"}})
+	assert.Nil(errors)
+	assert.Len(query.Cond, 2)
+	assert.Equal(database.DedupFlow, query.Dedup)
+
+	query, errors = fe.translateQuery(url.Values{"Dedup": []string{"foo"}})
+	assert.EqualError(errors[0], "invalid de-duplication mode: foo")
+}
+
+func TestTranslateNATQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	q, err := translateNATQuery(url.Values{
+		"Agent":     []string{"test01.pop01"},
+		"Addr":      []string{"198.51.100.1"},
+		"Port":      []string{"40000"},
+		"Timestamp": []string{"1503432000"},
+	})
+	assert.NoError(err)
+	assert.Equal("test01.pop01", q.Agent)
+	assert.Equal("198.51.100.1", q.Addr.String())
+	assert.Equal(uint16(40000), q.Port)
+	assert.Equal(int64(1503432000), q.Timestamp)
+	assert.Equal(int64(0), q.Lookback)
+
+	_, err = translateNATQuery(url.Values{
+		"Agent":     []string{"test01.pop01"},
+		"Addr":      []string{"foo"},
+		"Timestamp": []string{"1503432000"},
+	})
+	assert.EqualError(err, "invalid address: foo")
 }
@@ -0,0 +1,103 @@
+package iana
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Forwarding status classes as encoded in the two most significant bits of forwardingStatus (RFC 7270)
+const (
+	FwdStatusUnknown   = 0
+	FwdStatusForwarded = 1
+	FwdStatusDropped   = 2
+	FwdStatusConsumed  = 3
+)
+
+var fwdStatusClasses = map[uint8]string{
+	FwdStatusUnknown:   "Unknown",
+	FwdStatusForwarded: "Forwarded",
+	FwdStatusDropped:   "Dropped",
+	FwdStatusConsumed:  "Consumed",
+}
+
+// fwdStatusReasons maps forwarding status values to the names of their reason codes
+var fwdStatusReasons = map[uint8]string{
+	0:   "Unknown",
+	64:  "Unknown",
+	65:  "Fragmented",
+	66:  "Not Fragmented",
+	128: "Unknown",
+	129: "ACL deny",
+	130: "ACL drop",
+	131: "Unroutable",
+	132: "Adjacency",
+	133: "Fragmentation and DF set",
+	134: "Bad header checksum",
+	135: "Bad total Length",
+	136: "Bad header length",
+	137: "bad TTL",
+	138: "Policer",
+	139: "WRED",
+	140: "RPF",
+	141: "For us",
+	142: "Bad output interface",
+	143: "Hardware",
+	192: "Unknown",
+	193: "Punt Adjacency",
+	194: "Incomplete Adjacency",
+	195: "For us",
+}
+
+// FwdStatusClass returns the class (forwarded, dropped, consumed) of forwarding status `status`
+func FwdStatusClass(status uint8) uint8 {
+	return status >> 6
+}
+
+// FwdStatusClassName returns the name of forwarding status class `class`
+func FwdStatusClassName(class uint8) string {
+	if name, ok := fwdStatusClasses[class]; ok {
+		return name
+	}
+	return strconv.Itoa(int(class))
+}
+
+// FwdStatusReasonName returns the name of the reason code of forwarding status `status`
+func FwdStatusReasonName(status uint8) string {
+	if name, ok := fwdStatusReasons[status]; ok {
+		return name
+	}
+	return strconv.Itoa(int(status & 0x3f))
+}
+
+// ParseFwdStatusClass parses a forwarding status class given either by number or by name
+func ParseFwdStatusClass(s string) (uint8, error) {
+	if v, err := strconv.ParseUint(s, 10, 2); err == nil {
+		return uint8(v), nil
+	}
+
+	for class, name := range fwdStatusClasses {
+		if strings.EqualFold(name, s) {
+			return class, nil
+		}
+	}
+
+	return 0, errors.Errorf("invalid forwarding status: %s", s)
+}
+
+// ParseDropReason parses the reason a flow was dropped for given either by reason code or by name
+// and returns the according forwarding status
+func ParseDropReason(s string) (uint8, error) {
+	if v, err := strconv.ParseUint(s, 10, 6); err == nil {
+		return FwdStatusDropped<<6 | uint8(v), nil
+	}
+
+	for status, name := range fwdStatusReasons {
+		if FwdStatusClass(status) == FwdStatusDropped && strings.EqualFold(name, s) {
+			return status, nil
+		}
+	}
+
+	return 0, errors.Errorf("invalid drop reason: %s", s)
+}
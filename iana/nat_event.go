@@ -0,0 +1,69 @@
+package iana
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// natEvents maps natEvent values (RFC 8158) to their names
+var natEvents = map[uint8]string{
+	1:  "NAT translation create",
+	2:  "NAT translation delete",
+	3:  "NAT Addresses exhausted",
+	4:  "NAT44 session create",
+	5:  "NAT44 session delete",
+	6:  "NAT64 session create",
+	7:  "NAT64 session delete",
+	8:  "NAT44 BIB create",
+	9:  "NAT44 BIB delete",
+	10: "NAT64 BIB create",
+	11: "NAT64 BIB delete",
+	12: "NAT ports exhausted",
+	13: "Quota Exceeded",
+	14: "Address binding create",
+	15: "Address binding delete",
+	16: "Port block allocation",
+	17: "Port block de-allocation",
+	18: "Threshold Reached",
+}
+
+// natEventsCreate and natEventsDelete are the events starting and ending a translation
+var (
+	natEventsCreate = map[uint8]bool{1: true, 4: true, 6: true, 8: true, 10: true, 14: true, 16: true}
+	natEventsDelete = map[uint8]bool{2: true, 5: true, 7: true, 9: true, 11: true, 15: true, 17: true}
+)
+
+// NatEventName returns the name of NAT event `event`
+func NatEventName(event uint8) string {
+	if name, ok := natEvents[event]; ok {
+		return name
+	}
+	return strconv.Itoa(int(event))
+}
+
+// NatEventCreates checks if NAT event `event` starts a translation
+func NatEventCreates(event uint8) bool {
+	return natEventsCreate[event]
+}
+
+// NatEventDeletes checks if NAT event `event` ends a translation
+func NatEventDeletes(event uint8) bool {
+	return natEventsDelete[event]
+}
+
+// ParseNatEvent parses a NAT event given either by number or by name
+func ParseNatEvent(s string) (uint8, error) {
+	if v, err := strconv.ParseUint(s, 10, 8); err == nil {
+		return uint8(v), nil
+	}
+
+	for event, name := range natEvents {
+		if strings.EqualFold(name, s) {
+			return event, nil
+		}
+	}
+
+	return 0, errors.Errorf("invalid NAT event: %s", s)
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ifcounters keeps track of interface counters reported by agents
+package ifcounters
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+)
+
+// Counters represents the generic interface counters of an interface
+type Counters struct {
+	IfIndex      uint32
+	IfType       uint32
+	IfSpeed      uint64
+	IfDirection  uint32
+	IfStatus     uint32
+	InOctets     uint64
+	InUcastPkts  uint32
+	InMcastPkts  uint32
+	InBcastPkts  uint32
+	InDiscards   uint32
+	InErrors     uint32
+	OutOctets    uint64
+	OutUcastPkts uint32
+	OutMcastPkts uint32
+	OutBcastPkts uint32
+	OutDiscards  uint32
+	OutErrors    uint32
+	Timestamp    int64
+}
+
+// Cache holds the most recent counters per agent and interface index
+type Cache struct {
+	cache map[string]map[uint32]Counters
+	mu    sync.RWMutex
+}
+
+// New creates a new Cache
+func New() *Cache {
+	return &Cache{
+		cache: make(map[string]map[uint32]Counters),
+	}
+}
+
+// Set updates the counters of an interface of agent `rtr`
+func (c *Cache) Set(rtr net.IP, counters Counters) {
+	k := key(rtr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.cache[k]; !ok {
+		c.cache[k] = make(map[uint32]Counters)
+	}
+	c.cache[k][counters.IfIndex] = counters
+}
+
+// Get returns the counters of all interfaces of agent `rtr` sorted by interface index
+func (c *Cache) Get(rtr net.IP) []Counters {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	k := key(rtr)
+	ret := make([]Counters, 0, len(c.cache[k]))
+	for _, counters := range c.cache[k] {
+		ret = append(ret, counters)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].IfIndex < ret[j].IfIndex
+	})
+
+	return ret
+}
+
+// key normalizes `rtr` so IPv4 addresses in 4 and 16 byte representation map to the same entry
+func key(rtr net.IP) string {
+	if addr := rtr.To4(); addr != nil {
+		return string(addr)
+	}
+	return string(rtr.To16())
+}
+
+// Metrics writes the counters of all agents in prometheus compatible format. `names` maps agent IP addresses to names.
+func (c *Cache) Metrics(w io.Writer, names map[string]string) {
+	metrics := []struct {
+		name  string
+		help  string
+		typ   string
+		value func(c *Counters) uint64
+	}{
+		{"netflow_collector_interface_speed", "Interface speed in bits per second", "gauge", func(c *Counters) uint64 { return c.IfSpeed }},
+		{"netflow_collector_interface_in_octets", "Octets received on the interface", "counter", func(c *Counters) uint64 { return c.InOctets }},
+		{"netflow_collector_interface_in_ucast_packets", "Unicast packets received on the interface", "counter", func(c *Counters) uint64 { return uint64(c.InUcastPkts) }},
+		{"netflow_collector_interface_in_discards", "Inbound packets discarded", "counter", func(c *Counters) uint64 { return uint64(c.InDiscards) }},
+		{"netflow_collector_interface_in_errors", "Inbound packets with errors", "counter", func(c *Counters) uint64 { return uint64(c.InErrors) }},
+		{"netflow_collector_interface_out_octets", "Octets transmitted on the interface", "counter", func(c *Counters) uint64 { return c.OutOctets }},
+		{"netflow_collector_interface_out_ucast_packets", "Unicast packets transmitted on the interface", "counter", func(c *Counters) uint64 { return uint64(c.OutUcastPkts) }},
+		{"netflow_collector_interface_out_discards", "Outbound packets discarded", "counter", func(c *Counters) uint64 { return uint64(c.OutDiscards) }},
+		{"netflow_collector_interface_out_errors", "Outbound packets with errors", "counter", func(c *Counters) uint64 { return uint64(c.OutErrors) }},
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		for rtr, intfs := range c.cache {
+			agent := net.IP(rtr).String()
+			if name, ok := names[agent]; ok {
+				agent = name
+			}
+
+			for ifIndex, counters := range intfs {
+				fmt.Fprintf(w, "%s{agent=%q,ifindex=\"%d\"} %d\n", m.name, agent, ifIndex, m.value(&counters))
+			}
+		}
+	}
+}
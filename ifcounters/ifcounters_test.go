@@ -0,0 +1,43 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifcounters
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+
+	c := New()
+	rtr := net.IP([]byte{10, 0, 0, 1})
+	c.Set(rtr, Counters{IfIndex: 2, InOctets: 100})
+	c.Set(rtr, Counters{IfIndex: 1, InOctets: 200})
+	c.Set(rtr, Counters{IfIndex: 2, InOctets: 300})
+
+	res := c.Get(rtr)
+	assert.Len(res, 2)
+	assert.Equal(uint32(1), res[0].IfIndex)
+	assert.Equal(uint64(300), res[1].InOctets)
+	assert.Len(c.Get(net.IP([]byte{10, 0, 0, 2})), 0)
+	assert.Len(c.Get(net.ParseIP("10.0.0.1")), 2)
+
+	buf := &bytes.Buffer{}
+	c.Metrics(buf, map[string]string{"10.0.0.1": "rtr01"})
+	assert.Contains(buf.String(), `netflow_collector_interface_in_octets{agent="rtr01",ifindex="2"} 300`)
+	assert.Contains(buf.String(), "# TYPE netflow_collector_interface_speed gauge\n")
+	assert.Contains(buf.String(), "# TYPE netflow_collector_interface_in_octets counter\n")
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifserver
+
+import (
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/pkg/errors"
+)
+
+// Flow fields information elements can be mapped to
+const (
+	fieldSrcAddr                = "src_addr"
+	fieldDstAddr                = "dst_addr"
+	fieldProtocol               = "protocol"
+	fieldPackets                = "packets"
+	fieldSize                   = "size"
+	fieldOutPackets             = "out_packets"
+	fieldOutSize                = "out_size"
+	fieldFlowStart              = "flow_start"
+	fieldFlowEnd                = "flow_end"
+	fieldIntIn                  = "int_in"
+	fieldIntOut                 = "int_out"
+	fieldNextHop                = "next_hop"
+	fieldSrcAsn                 = "src_asn"
+	fieldDstAsn                 = "dst_asn"
+	fieldSrcPort                = "src_port"
+	fieldDstPort                = "dst_port"
+	fieldSamplingPacketInterval = "sampling_packet_interval"
+	fieldSamplerID              = "sampler_id"
+	fieldTCPFlags               = "tcp_flags"
+	fieldTos                    = "tos"
+	fieldIcmpTypeCode           = "icmp_type_code"
+	fieldIcmpType               = "icmp_type"
+	fieldIcmpCode               = "icmp_code"
+	fieldSrcVlan                = "src_vlan"
+	fieldDstVlan                = "dst_vlan"
+	fieldSrcMac                 = "src_mac"
+	fieldDstMac                 = "dst_mac"
+	fieldMplsLabel1             = "mpls_label1"
+	fieldMplsLabel2             = "mpls_label2"
+	fieldMplsLabel3             = "mpls_label3"
+	fieldMplsTopLabelAddr       = "mpls_top_label_addr"
+	fieldForwardingStatus       = "forwarding_status"
+	fieldDirection              = "direction"
+	fieldPostNATSrcAddr         = "post_nat_src_addr"
+	fieldPostNATDstAddr         = "post_nat_dst_addr"
+	fieldPostNAPTSrcPort        = "post_napt_src_port"
+	fieldPostNAPTDstPort        = "post_napt_dst_port"
+	fieldNatEvent               = "nat_event"
+	fieldApplicationID          = "application_id"
+	fieldApplicationName        = "application_name"
+)
+
+// defaultFieldMapping maps flow fields to the names of the information elements carrying them.
+// If a template contains more than one of the elements the first one listed wins.
+var defaultFieldMapping = map[string][]string{
+	fieldSrcAddr:                {"sourceIPv4Address", "sourceIPv6Address"},
+	fieldDstAddr:                {"destinationIPv4Address", "destinationIPv6Address"},
+	fieldProtocol:               {"protocolIdentifier"},
+	fieldPackets:                {"packetDeltaCount"},
+	fieldSize:                   {"octetDeltaCount"},
+	fieldOutPackets:             {"postPacketDeltaCount"},
+	fieldOutSize:                {"postOctetDeltaCount"},
+	fieldFlowStart:              {"flowStartMilliseconds", "flowStartSeconds", "observationTimeMilliseconds"},
+	fieldFlowEnd:                {"flowEndMilliseconds", "flowEndSeconds", "observationTimeMilliseconds"},
+	fieldIntIn:                  {"ingressInterface"},
+	fieldIntOut:                 {"egressInterface"},
+	fieldNextHop:                {"ipNextHopIPv4Address", "ipNextHopIPv6Address"},
+	fieldSrcAsn:                 {"bgpSourceAsNumber"},
+	fieldDstAsn:                 {"bgpDestinationAsNumber"},
+	fieldSrcPort:                {"sourceTransportPort"},
+	fieldDstPort:                {"destinationTransportPort"},
+	fieldSamplingPacketInterval: {"samplingPacketInterval", "samplingInterval", "samplerRandomInterval"},
+	fieldSamplerID:              {"selectorId", "samplerId"},
+	fieldTCPFlags:               {"tcpControlBits"},
+	fieldTos:                    {"ipClassOfService"},
+	fieldIcmpTypeCode:           {"icmpTypeCodeIPv4", "icmpTypeCodeIPv6"},
+	fieldIcmpType:               {"icmpTypeIPv4", "icmpTypeIPv6"},
+	fieldIcmpCode:               {"icmpCodeIPv4", "icmpCodeIPv6"},
+	fieldSrcVlan:                {"vlanId", "dot1qVlanId"},
+	fieldDstVlan:                {"postVlanId", "postDot1qVlanId"},
+	fieldSrcMac:                 {"sourceMacAddress", "postSourceMacAddress"},
+	fieldDstMac:                 {"destinationMacAddress", "postDestinationMacAddress"},
+	fieldMplsLabel1:             {"mplsTopLabelStackSection"},
+	fieldMplsLabel2:             {"mplsLabelStackSection2"},
+	fieldMplsLabel3:             {"mplsLabelStackSection3"},
+	fieldMplsTopLabelAddr:       {"mplsTopLabelIPv4Address", "mplsTopLabelIPv6Address"},
+	fieldForwardingStatus:       {"forwardingStatus"},
+	fieldDirection:              {"flowDirection"},
+	fieldPostNATSrcAddr:         {"postNATSourceIPv4Address", "postNATSourceIPv6Address"},
+	fieldPostNATDstAddr:         {"postNATDestinationIPv4Address", "postNATDestinationIPv6Address"},
+	fieldPostNAPTSrcPort:        {"postNAPTSourceTransportPort"},
+	fieldPostNAPTDstPort:        {"postNAPTDestinationTransportPort"},
+	fieldNatEvent:               {"natEvent"},
+	fieldApplicationID:          {"applicationId"},
+	fieldApplicationName:        {"applicationName"},
+}
+
+// fieldRef references a flow field an information element is mapped to
+type fieldRef struct {
+	field    string
+	priority int
+	ie       *ipfix.InformationElement
+}
+
+// ieKey identifies an information element in a template
+type ieKey struct {
+	enterpriseNumber uint32
+	id               uint16
+}
+
+// fieldMapping maps information elements to flow fields
+type fieldMapping map[ieKey][]fieldRef
+
+// newFieldMapping creates a fieldMapping from the default mapping overridden by `custom`
+func newFieldMapping(reg *ipfix.Registry, custom map[string][]string) (fieldMapping, error) {
+	mapping := make(map[string][]string)
+	for field, names := range defaultFieldMapping {
+		mapping[field] = names
+	}
+
+	for field, names := range custom {
+		if _, ok := defaultFieldMapping[field]; !ok {
+			return nil, errors.Errorf("Unknown flow field %q", field)
+		}
+		mapping[field] = names
+	}
+
+	fm := make(fieldMapping)
+	for field, names := range mapping {
+		for prio, name := range names {
+			ie := reg.GetByName(name)
+			if ie == nil {
+				return nil, errors.Errorf("Unknown information element %q mapped to %s", name, field)
+			}
+
+			key := ieKey{enterpriseNumber: ie.EnterpriseNumber, id: ie.ID}
+			fm[key] = append(fm[key], fieldRef{
+				field:    field,
+				priority: prio,
+				ie:       ie,
+			})
+		}
+	}
+
+	return fm, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifserver
+
+import (
+	"testing"
+
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateFieldMap(t *testing.T) {
+	reg, err := ipfix.LoadRegistry("../ipfix_information_elements.csv")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	records := []*ipfix.TemplateRecord{
+		{Type: 12236, Length: 4, EnterpriseNumber: 9},
+		{Type: ipfix.IPv4SrcAddr, Length: 4},
+		{Type: ipfix.FlowStartSeconds, Length: 4},
+		{Type: ipfix.FlowStartMilliseconds, Length: 8},
+		{Type: ipfix.InBytes, Length: 8},
+		{Type: 12236, Length: 4},
+	}
+
+	tests := []struct {
+		name        string
+		custom      map[string][]string
+		wantErr     bool
+		wantSrcAddr int
+		wantFamily  int
+	}{
+		{
+			name:        "Defaults",
+			wantSrcAddr: 1,
+			wantFamily:  4,
+		},
+		{
+			name: "Enterprise element preferred",
+			custom: map[string][]string{
+				fieldSrcAddr: {"ciscoClientIPv4Address", "sourceIPv4Address"},
+			},
+			wantSrcAddr: 0,
+			wantFamily:  4,
+		},
+		{
+			name: "Unknown element",
+			custom: map[string][]string{
+				fieldSrcAddr: {"fooAddress"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown field",
+			custom: map[string][]string{
+				"foo": {"sourceIPv4Address"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		mapping, err := newFieldMapping(reg, test.custom)
+		if test.wantErr {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		if !assert.NoError(t, err, test.name) {
+			continue
+		}
+
+		fm := mapping.generateFieldMap(&ipfix.TemplateRecords{Records: records})
+		assert.Equal(t, test.wantSrcAddr, fm.srcAddr, test.name)
+		assert.Equal(t, test.wantFamily, fm.family, test.name)
+		assert.Equal(t, 3, fm.flowStartMs, test.name)
+		assert.Equal(t, -1, fm.flowStart, test.name)
+		assert.Equal(t, 4, fm.size, test.name)
+		assert.Equal(t, -1, fm.dstAddr, test.name)
+	}
+}
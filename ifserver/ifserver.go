@@ -9,28 +9,44 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package ifserver provides IPFIX collection services via UDP and passes flows into annotator layer
+// Package ifserver provides IPFIX collection services via UDP and TCP and passes flows into annotator layer
 package ifserver
 
 import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/bio-routing/tflow2/appcache"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/convert"
 	"github.com/bio-routing/tflow2/ipfix"
 	"github.com/bio-routing/tflow2/netflow"
+	ippacket "github.com/bio-routing/tflow2/packet"
+	"github.com/bio-routing/tflow2/pending"
+	"github.com/bio-routing/tflow2/seqtrack"
 	"github.com/bio-routing/tflow2/srcache"
 	"github.com/bio-routing/tflow2/stats"
+	"github.com/pkg/errors"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// templateFileName is the name of the file in the data directory UDP templates are persisted in
+	templateFileName = "templates_ipfix.json"
+
+	// templateMaintenanceInterval is the interval in which templates are expired and persisted
+	templateMaintenanceInterval = 10 * time.Second
+)
+
 // fieldMap describes what information is at what index in the slice
 // that we get from decoding a netflow packet
 type fieldMap struct {
@@ -39,6 +55,12 @@ type fieldMap struct {
 	protocol               int
 	packets                int
 	size                   int
+	outPackets             int
+	outSize                int
+	flowStart              int
+	flowEnd                int
+	flowStartMs            int
+	flowEndMs              int
 	intIn                  int
 	intOut                 int
 	nextHop                int
@@ -50,6 +72,29 @@ type fieldMap struct {
 	srcPort                int
 	dstPort                int
 	samplingPacketInterval int
+	samplerID              int
+	tcpFlags               int
+	tos                    int
+	icmpTypeCode           int
+	icmpType               int
+	icmpCode               int
+	srcVlan                int
+	dstVlan                int
+	srcMac                 int
+	dstMac                 int
+	mplsLabel1             int
+	mplsLabel2             int
+	mplsLabel3             int
+	mplsTopLabelAddr       int
+	forwardingStatus       int
+	direction              int
+	postNATSrcAddr         int
+	postNATDstAddr         int
+	postNAPTSrcPort        int
+	postNAPTDstPort        int
+	natEvent               int
+	applicationID          int
+	applicationName        int
 }
 
 // IPFIXServer represents a Netflow Collector instance
@@ -58,28 +103,77 @@ type IPFIXServer struct {
 	// for later lookup in order to decode netflow packets
 	tmplCache *templateCache
 
+	// sessions holds the template caches of IPFIX over TCP sessions by remote address
+	sessions     map[string]*templateCache
+	sessionsLock sync.RWMutex
+
 	// receiver is the channel used to receive flows from the annotator layer
 	Output chan *netflow.Flow
 
 	// con is the UDP socket
 	conn *net.UDPConn
 
+	// tcpLn is the IPFIX over TCP listener
+	tcpLn net.Listener
+
 	wg sync.WaitGroup
 
 	sampleRateCache *srcache.SamplerateCache
 
+	// seqTracker tracks sequence numbers of export packets
+	seqTracker *seqtrack.Tracker
+
+	// appCache holds the application tables of the agents
+	appCache *appcache.AppCache
+
+	// fieldMapping maps information elements to flow fields
+	fieldMapping fieldMapping
+
 	config *config.Config
 }
 
 // New creates and starts a new `IPFIXServer` instance
-func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *IPFIXServer {
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache, seqTracker *seqtrack.Tracker, appCache *appcache.AppCache, registry *ipfix.Registry) *IPFIXServer {
+	mapping, err := newFieldMapping(registry, config.IPFIXFieldMapping)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid IPFIX field mapping: %v", err))
+	}
+
 	ifs := &IPFIXServer{
-		tmplCache:       newTemplateCache(),
+		fieldMapping:    mapping,
+		tmplCache:       newTemplateCache(time.Duration(*config.TemplateTimeout) * time.Second),
+		sessions:        make(map[string]*templateCache),
 		Output:          make(chan *netflow.Flow),
 		sampleRateCache: sampleRateCache,
+		seqTracker:      seqTracker,
+		appCache:        appCache,
 		config:          config,
 	}
 
+	// Only data received via UDP is held until its template arrives
+	ifs.tmplCache.pending = pending.New(*config.PendingSets.MaxSets, time.Duration(config.PendingSets.MaxAge)*time.Second)
+
+	if *ifs.config.IPFIX.Enabled {
+		ifs.loadTemplates()
+		go ifs.templateMaintenance()
+		ifs.listenUDP(numReaders)
+	}
+
+	if *ifs.config.IPFIXTCP.Enabled {
+		ln, err := net.Listen("tcp", ifs.config.IPFIXTCP.Listen)
+		if err != nil {
+			panic(fmt.Sprintf("Listen: %v", err))
+		}
+
+		ifs.tcpLn = ln
+		go ifs.tcpListener(ln)
+	}
+
+	return ifs
+}
+
+// listenUDP opens the UDP socket and starts `numReaders` workers reading from it
+func (ifs *IPFIXServer) listenUDP(numReaders int) {
 	addr, err := net.ResolveUDPAddr("udp", ifs.config.IPFIX.Listen)
 	if err != nil {
 		panic(fmt.Sprintf("ResolveUDPAddr: %v", err))
@@ -89,24 +183,90 @@ func New(numReaders int, config *config.Config, sampleRateCache *srcache.Sampler
 	if err != nil {
 		panic(fmt.Sprintf("Listen: %v", err))
 	}
+	ifs.conn = con
 
 	// Create goroutines that read netflow packet and process it
 	for i := 0; i < numReaders; i++ {
-		ifs.wg.Add(numReaders)
+		ifs.wg.Add(1)
 		go func(num int) {
 			ifs.packetWorker(num, con)
 		}(i)
 	}
-
-	return ifs
 }
 
-// Close closes the socket and stops the workers
+// Close closes the sockets and stops the workers
 func (ifs *IPFIXServer) Close() {
-	ifs.conn.Close()
+	if ifs.tcpLn != nil {
+		ifs.tcpLn.Close()
+	}
+	if ifs.conn != nil {
+		ifs.conn.Close()
+	}
 	ifs.wg.Wait()
 }
 
+// templateFile returns the path of the file UDP templates are persisted in
+func (ifs *IPFIXServer) templateFile() string {
+	return filepath.Join(ifs.config.DataDir, templateFileName)
+}
+
+// loadTemplates restores the persisted template cache
+func (ifs *IPFIXServer) loadTemplates() {
+	if ifs.config.DataDir == "" {
+		return
+	}
+
+	err := ifs.tmplCache.load(ifs.templateFile())
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			log.Errorf("Unable to load IPFIX templates: %v", err)
+		}
+		return
+	}
+
+	log.Infof("Loaded %d IPFIX templates", len(ifs.tmplCache.templates()))
+}
+
+// templateMaintenance periodically removes expired templates and persists the template cache
+func (ifs *IPFIXServer) templateMaintenance() {
+	for range time.Tick(templateMaintenanceInterval) {
+		n := ifs.tmplCache.expire()
+		if n > 0 && ifs.config.Debug > 0 {
+			log.Infof("%d IPFIX templates expired", n)
+		}
+
+		n = ifs.tmplCache.pending.Expire()
+		if n > 0 && ifs.config.Debug > 0 {
+			log.Infof("%d pending IPFIX data sets expired", n)
+		}
+
+		if ifs.config.DataDir == "" {
+			continue
+		}
+
+		err := ifs.tmplCache.save(ifs.templateFile())
+		if err != nil {
+			log.Errorf("Unable to save IPFIX templates: %v", err)
+		}
+	}
+}
+
+// Templates returns the contents of the template caches
+func (ifs *IPFIXServer) Templates() interface{} {
+	res := ifs.tmplCache.templates()
+
+	ifs.sessionsLock.RLock()
+	defer ifs.sessionsLock.RUnlock()
+	for session, c := range ifs.sessions {
+		for _, t := range c.templates() {
+			t.Session = session
+			res = append(res, t)
+		}
+	}
+
+	return res
+}
+
 // validateSource checks if src is a configured agent
 func (ifs *IPFIXServer) validateSource(src net.IP) bool {
 	if _, ok := ifs.config.AgentsNameByIP[src.String()]; ok {
@@ -134,14 +294,14 @@ func (ifs *IPFIXServer) packetWorker(identity int, conn *net.UDPConn) {
 			log.Errorf("Unknown source: %s", remote.IP.String())
 		}
 
-		ifs.processPacket(remote.IP, buffer[:length])
+		ifs.processPacket(remote.IP, buffer[:length], ifs.tmplCache)
 	}
 	ifs.wg.Done()
 }
 
-// processPacket takes a raw netflow packet, send it to the decoder, updates template cache
+// processPacket takes a raw netflow packet, send it to the decoder, updates template cache `tmplCache`
 // (if there are templates in the packet) and passes the decoded packet over to processFlowSets()
-func (ifs *IPFIXServer) processPacket(remote net.IP, buffer []byte) {
+func (ifs *IPFIXServer) processPacket(remote net.IP, buffer []byte, tmplCache *templateCache) {
 	length := len(buffer)
 	packet, err := ipfix.Decode(buffer[:length], remote)
 	if err != nil {
@@ -149,45 +309,78 @@ func (ifs *IPFIXServer) processPacket(remote net.IP, buffer []byte) {
 		return
 	}
 
-	ifs.updateTemplateCache(remote, packet)
-	ifs.processFlowSets(remote, packet.Header.DomainID, packet.DataFlowSets(), int64(packet.Header.ExportTime), packet)
+	ifs.updateTemplateCache(remote, packet, tmplCache)
+	count := ifs.processFlowSets(remote, packet.Header.DomainID, packet.DataFlowSets(), int64(packet.Header.ExportTime), packet, tmplCache)
+
+	// Sequence numbers of IPFIX count data records (RFC7011 3.1.)
+	ifs.seqTracker.Update(remote, packet.Header.DomainID, packet.Header.SequenceNumber, count)
 }
 
-// processFlowSets iterates over flowSets and calls processFlowSet() for each flow set
-func (ifs *IPFIXServer) processFlowSets(remote net.IP, domainID uint32, flowSets []*ipfix.Set, ts int64, packet *ipfix.Packet) {
+// processFlowSets iterates over flowSets and calls processFlowSet() for each flow set. It returns the number of
+// data records or seqtrack.UnknownCount if a flow set could not be decoded for a missing template.
+func (ifs *IPFIXServer) processFlowSets(remote net.IP, domainID uint32, flowSets []*ipfix.Set, ts int64, packet *ipfix.Packet, tmplCache *templateCache) int {
 	addr := remote.String()
 	keyParts := make([]string, 3, 3)
+	count := 0
 	for _, set := range flowSets {
-		template := ifs.tmplCache.get(convert.Uint32(remote), domainID, set.Header.SetID)
+		template := tmplCache.get(addr, domainID, set.Header.SetID)
 
 		if template == nil {
 			templateKey := makeTemplateKey(addr, domainID, set.Header.SetID, keyParts)
 			if ifs.config.Debug > 0 {
 				log.Warningf("Template for given FlowSet not found: %s", templateKey)
 			}
+
+			tmplCache.pending.Add(pending.Key{
+				Agent:      addr,
+				SourceID:   domainID,
+				TemplateID: set.Header.SetID,
+			}, &pendingSet{
+				set:    set,
+				ts:     ts,
+				packet: packet,
+			})
+			count = seqtrack.UnknownCount
 			continue
 		}
 
-		records := template.DecodeFlowSet(*set)
-		if records == nil {
-			log.Warning("Error decoding FlowSet")
-			continue
+		n := ifs.decodeFlowSet(template, set, remote, ts, packet)
+		if count != seqtrack.UnknownCount {
+			count += n
 		}
-		ifs.processFlowSet(template, records, remote, ts, packet)
 	}
+
+	return count
+}
+
+// pendingSet is a data set waiting for its template
+type pendingSet struct {
+	set    *ipfix.Set
+	ts     int64
+	packet *ipfix.Packet
+}
+
+// decodeFlowSet decodes `set` using `template`, passes the records to processFlowSet() and returns the number of records
+func (ifs *IPFIXServer) decodeFlowSet(template *ipfix.TemplateRecords, set *ipfix.Set, remote net.IP, ts int64, packet *ipfix.Packet) int {
+	records := template.DecodeFlowSet(*set)
+	if records == nil {
+		log.Warning("Error decoding FlowSet")
+		return 0
+	}
+	ifs.processFlowSet(template, records, remote, ts, packet)
+	return len(records)
 }
 
 // process generates Flow elements from records and pushes them into the `receiver` channel
 func (ifs *IPFIXServer) processFlowSet(template *ipfix.TemplateRecords, records []ipfix.FlowDataRecord, agent net.IP, ts int64, packet *ipfix.Packet) {
-	fm := generateFieldMap(template)
+	fm := ifs.fieldMapping.generateFieldMap(template)
 
 	for _, r := range records {
-		/*if template.OptionScopes != nil {
-			if fm.samplingPacketInterval >= 0 {
-				ifs.sampleRateCache.Set(agent, uint64(convert.Uint32(r.Values[fm.samplingPacketInterval])))
-			}
+		if template.IsOptions() {
+			ifs.updateSamplerate(agent, packet.Header.DomainID, fm, r)
+			ifs.updateApplication(agent, fm, r)
 			continue
-		}*/
+		}
 
 		if fm.family >= 0 {
 			if fm.family == 4 {
@@ -209,11 +402,28 @@ func (ifs *IPFIXServer) processFlowSet(template *ipfix.TemplateRecords, records
 		}
 
 		if fm.packets >= 0 {
-			fl.Packets = convert.Uint32(r.Values[fm.packets])
+			fl.Packets = convert.Uint64(r.Values[fm.packets])
 		}
 
 		if fm.size >= 0 {
-			fl.Size = uint64(convert.Uint32(r.Values[fm.size]))
+			fl.Size = convert.Uint64(r.Values[fm.size])
+		}
+
+		if fm.outPackets >= 0 {
+			fl.OutPkts = convert.Uint64(r.Values[fm.outPackets])
+		}
+
+		if fm.outSize >= 0 {
+			fl.OutBytes = convert.Uint64(r.Values[fm.outSize])
+		}
+
+		// Flows exported on egress might carry egress counters only
+		if fm.size < 0 && fm.outSize >= 0 {
+			fl.Size = fl.OutBytes
+		}
+
+		if fm.packets < 0 && fm.outPackets >= 0 {
+			fl.Packets = fl.OutPkts
 		}
 
 		if fm.protocol >= 0 {
@@ -258,7 +468,123 @@ func (ifs *IPFIXServer) processFlowSet(template *ipfix.TemplateRecords, records
 			}
 		}
 
-		fl.Samplerate = ifs.sampleRateCache.Get(agent)
+		if fm.tcpFlags >= 0 {
+			fl.TcpFlags = convert.Uint32(r.Values[fm.tcpFlags])
+		}
+
+		if fm.tos >= 0 {
+			fl.Tos = convert.Uint32(r.Values[fm.tos])
+		}
+
+		// ICMP type and code are encoded as type * 256 + code, either in a dedicated element or the DST port
+		if fm.icmpTypeCode >= 0 {
+			typeCode := convert.Uint32(r.Values[fm.icmpTypeCode])
+			fl.IcmpType, fl.IcmpCode = typeCode>>8, typeCode&0xff
+		} else if fm.icmpType >= 0 || fm.icmpCode >= 0 {
+			if fm.icmpType >= 0 {
+				fl.IcmpType = convert.Uint32(r.Values[fm.icmpType])
+			}
+			if fm.icmpCode >= 0 {
+				fl.IcmpCode = convert.Uint32(r.Values[fm.icmpCode])
+			}
+		} else if fl.Protocol == ippacket.ICMP || fl.Protocol == ippacket.ICMPv6 {
+			fl.IcmpType, fl.IcmpCode = fl.DstPort>>8, fl.DstPort&0xff
+		}
+
+		if fm.srcVlan >= 0 {
+			fl.SrcVlan = convert.Uint32(r.Values[fm.srcVlan])
+		}
+
+		if fm.dstVlan >= 0 {
+			fl.DstVlan = convert.Uint32(r.Values[fm.dstVlan])
+		}
+
+		if fm.srcMac >= 0 {
+			fl.SrcMac = convert.Reverse(r.Values[fm.srcMac])
+		}
+
+		if fm.dstMac >= 0 {
+			fl.DstMac = convert.Reverse(r.Values[fm.dstMac])
+		}
+
+		if fm.mplsLabel1 >= 0 {
+			fl.MplsLabel1 = ippacket.LabelFromStackSection(r.Values[fm.mplsLabel1])
+		}
+
+		if fm.mplsLabel2 >= 0 {
+			fl.MplsLabel2 = ippacket.LabelFromStackSection(r.Values[fm.mplsLabel2])
+		}
+
+		if fm.mplsLabel3 >= 0 {
+			fl.MplsLabel3 = ippacket.LabelFromStackSection(r.Values[fm.mplsLabel3])
+		}
+
+		if fm.mplsTopLabelAddr >= 0 {
+			fl.MplsTopLabelAddr = convert.Reverse(r.Values[fm.mplsTopLabelAddr])
+		}
+
+		if fm.forwardingStatus >= 0 {
+			fl.ForwardingStatus = convert.Uint32(r.Values[fm.forwardingStatus])
+		}
+
+		if fm.flowStartMs >= 0 {
+			fl.FlowStart = convert.Uint64(r.Values[fm.flowStartMs])
+		} else if fm.flowStart >= 0 {
+			fl.FlowStart = convert.Uint64(r.Values[fm.flowStart]) * 1000
+		}
+
+		if fm.flowEndMs >= 0 {
+			fl.FlowEnd = convert.Uint64(r.Values[fm.flowEndMs])
+		} else if fm.flowEnd >= 0 {
+			fl.FlowEnd = convert.Uint64(r.Values[fm.flowEnd]) * 1000
+		}
+
+		if fm.postNATSrcAddr >= 0 {
+			fl.PostNatSrcAddr = convert.Reverse(r.Values[fm.postNATSrcAddr])
+		}
+
+		if fm.postNATDstAddr >= 0 {
+			fl.PostNatDstAddr = convert.Reverse(r.Values[fm.postNATDstAddr])
+		}
+
+		if fm.postNAPTSrcPort >= 0 {
+			fl.PostNaptSrcPort = convert.Uint32(r.Values[fm.postNAPTSrcPort])
+		}
+
+		if fm.postNAPTDstPort >= 0 {
+			fl.PostNaptDstPort = convert.Uint32(r.Values[fm.postNAPTDstPort])
+		}
+
+		if fm.natEvent >= 0 {
+			fl.NatEvent = convert.Uint32(r.Values[fm.natEvent])
+		}
+
+		if fm.direction >= 0 {
+			fl.Direction = convert.Uint32(r.Values[fm.direction])
+		}
+
+		if fm.applicationID >= 0 {
+			fl.ApplicationId = convert.Reverse(r.Values[fm.applicationID])
+		}
+
+		if fm.applicationName >= 0 {
+			fl.ApplicationName = strings.TrimRight(string(convert.Reverse(r.Values[fm.applicationName])), "\x00")
+		} else {
+			fl.ApplicationName = ifs.appCache.Get(agent, fl.ApplicationId)
+		}
+
+		// The direction policy only applies if the template carries the direction
+		if a := ifs.config.AgentsByIP[agent.String()]; a != nil && fm.direction >= 0 && !a.CountsFlow(fl.ObservationInterface(), fl.Egress()) {
+			atomic.AddUint64(&stats.GlobalStats.FlowsDirectionSkipped, 1)
+			continue
+		}
+
+		var samplerID uint64
+		if fm.samplerID >= 0 {
+			samplerID = convert.Uint64(r.Values[fm.samplerID])
+		}
+		fl.Samplerate = ifs.sampleRateCache.GetSampler(agent, packet.Header.DomainID, samplerID, fl.IntIn)
+		ifs.seqTracker.Compensate(&fl, packet.Header.DomainID)
 
 		if ifs.config.Debug > 2 {
 			Dump(&fl)
@@ -268,6 +594,36 @@ func (ifs *IPFIXServer) processFlowSet(template *ipfix.TemplateRecords, records
 	}
 }
 
+// updateSamplerate learns the samplerate of a sampler/selector from options data record `r`
+func (ifs *IPFIXServer) updateSamplerate(agent net.IP, domainID uint32, fm *fieldMap, r ipfix.FlowDataRecord) {
+	if fm.samplingPacketInterval < 0 {
+		return
+	}
+
+	rate := convert.Uint64(r.Values[fm.samplingPacketInterval])
+	if rate == 0 {
+		return
+	}
+
+	var samplerID uint64
+	if fm.samplerID >= 0 {
+		samplerID = convert.Uint64(r.Values[fm.samplerID])
+	}
+
+	ifs.sampleRateCache.SetSampler(agent, domainID, samplerID, rate)
+}
+
+// updateApplication learns the name of an application from options data record `r` of an application table
+func (ifs *IPFIXServer) updateApplication(agent net.IP, fm *fieldMap, r ipfix.FlowDataRecord) {
+	if fm.applicationID < 0 || fm.applicationName < 0 {
+		return
+	}
+
+	id := convert.Reverse(r.Values[fm.applicationID])
+	name := strings.TrimRight(string(convert.Reverse(r.Values[fm.applicationName])), "\x00")
+	ifs.appCache.Set(agent, id, name)
+}
+
 // Dump dumps a flow on the screen
 func Dump(fl *netflow.Flow) {
 	fmt.Printf("--------------------------------\n")
@@ -282,6 +638,8 @@ func Dump(fl *netflow.Flow) {
 	fmt.Printf("IntOut: %d\n", fl.IntOut)
 	fmt.Printf("Packets: %d\n", fl.Packets)
 	fmt.Printf("Bytes: %d\n", fl.Size)
+	fmt.Printf("OutPackets: %d\n", fl.OutPkts)
+	fmt.Printf("OutBytes: %d\n", fl.OutBytes)
 	fmt.Printf("--------------------------------\n")
 }
 
@@ -295,13 +653,19 @@ func DumpTemplate(tmpl *ipfix.TemplateRecords) {
 
 // generateFieldMap processes a TemplateRecord and populates a fieldMap accordingly
 // the FieldMap can then be used to read fields from a flow
-func generateFieldMap(template *ipfix.TemplateRecords) *fieldMap {
+func (m fieldMapping) generateFieldMap(template *ipfix.TemplateRecords) *fieldMap {
 	fm := fieldMap{
 		srcAddr:                -1,
 		dstAddr:                -1,
 		protocol:               -1,
 		packets:                -1,
 		size:                   -1,
+		outPackets:             -1,
+		outSize:                -1,
+		flowStart:              -1,
+		flowEnd:                -1,
+		flowStartMs:            -1,
+		flowEndMs:              -1,
 		intIn:                  -1,
 		intOut:                 -1,
 		nextHop:                -1,
@@ -313,59 +677,195 @@ func generateFieldMap(template *ipfix.TemplateRecords) *fieldMap {
 		srcPort:                -1,
 		dstPort:                -1,
 		samplingPacketInterval: -1,
+		samplerID:              -1,
+		tcpFlags:               -1,
+		tos:                    -1,
+		icmpTypeCode:           -1,
+		icmpType:               -1,
+		icmpCode:               -1,
+		srcVlan:                -1,
+		dstVlan:                -1,
+		srcMac:                 -1,
+		dstMac:                 -1,
+		mplsLabel1:             -1,
+		mplsLabel2:             -1,
+		mplsLabel3:             -1,
+		mplsTopLabelAddr:       -1,
+		forwardingStatus:       -1,
+		direction:              -1,
+		postNATSrcAddr:         -1,
+		postNATDstAddr:         -1,
+		postNAPTSrcPort:        -1,
+		postNAPTDstPort:        -1,
+		natEvent:               -1,
+		applicationID:          -1,
+		applicationName:        -1,
 	}
 
-	i := -1
-	for _, f := range template.Records {
-		i++
+	// priorities holds the priority of the element currently mapped to a field
+	priorities := make(map[string]int)
 
-		switch f.Type {
-		case ipfix.IPv4SrcAddr:
-			fm.srcAddr = i
-			fm.family = 4
-		case ipfix.IPv6SrcAddr:
-			fm.srcAddr = i
-			fm.family = 6
-		case ipfix.IPv4DstAddr:
-			fm.dstAddr = i
-		case ipfix.IPv6DstAddr:
-			fm.dstAddr = i
-		case ipfix.InBytes:
-			fm.size = i
-		case ipfix.Protocol:
-			fm.protocol = i
-		case ipfix.InPkts:
-			fm.packets = i
-		case ipfix.InputSnmp:
-			fm.intIn = i
-		case ipfix.OutputSnmp:
-			fm.intOut = i
-		case ipfix.IPv4NextHop:
-			fm.nextHop = i
-		case ipfix.IPv6NextHop:
-			fm.nextHop = i
-		case ipfix.L4SrcPort:
-			fm.srcPort = i
-		case ipfix.L4DstPort:
-			fm.dstPort = i
-		case ipfix.SrcAs:
-			fm.srcAsn = i
-		case ipfix.DstAs:
-			fm.dstAsn = i
-		case ipfix.SamplingPacketInterval:
-			fm.samplingPacketInterval = i
+	for i, f := range template.Records {
+		for _, ref := range m[ieKey{enterpriseNumber: f.EnterpriseNumber, id: f.Type}] {
+			if prio, ok := priorities[ref.field]; ok && prio <= ref.priority {
+				continue
+			}
+
+			priorities[ref.field] = ref.priority
+			fm.set(ref, i)
 		}
 	}
 
 	return &fm
 }
 
-// updateTemplateCache updates the template cache
-func (ifs *IPFIXServer) updateTemplateCache(remote net.IP, p *ipfix.Packet) {
+// set maps the field referenced by `ref` to index `i`
+func (fm *fieldMap) set(ref fieldRef, i int) {
+	switch ref.field {
+	case fieldSrcAddr:
+		fm.srcAddr = i
+		switch ref.ie.DataType {
+		case ipfix.DataTypeIPv4Address:
+			fm.family = 4
+		case ipfix.DataTypeIPv6Address:
+			fm.family = 6
+		}
+	case fieldDstAddr:
+		fm.dstAddr = i
+	case fieldProtocol:
+		fm.protocol = i
+	case fieldPackets:
+		fm.packets = i
+	case fieldSize:
+		fm.size = i
+	case fieldOutPackets:
+		fm.outPackets = i
+	case fieldOutSize:
+		fm.outSize = i
+	case fieldFlowStart:
+		fm.flowStart, fm.flowStartMs = -1, -1
+		if ref.ie.DataType == ipfix.DataTypeDateTimeMilliseconds {
+			fm.flowStartMs = i
+		} else {
+			fm.flowStart = i
+		}
+	case fieldFlowEnd:
+		fm.flowEnd, fm.flowEndMs = -1, -1
+		if ref.ie.DataType == ipfix.DataTypeDateTimeMilliseconds {
+			fm.flowEndMs = i
+		} else {
+			fm.flowEnd = i
+		}
+	case fieldIntIn:
+		fm.intIn = i
+	case fieldIntOut:
+		fm.intOut = i
+	case fieldNextHop:
+		fm.nextHop = i
+	case fieldSrcAsn:
+		fm.srcAsn = i
+	case fieldDstAsn:
+		fm.dstAsn = i
+	case fieldSrcPort:
+		fm.srcPort = i
+	case fieldDstPort:
+		fm.dstPort = i
+	case fieldSamplingPacketInterval:
+		fm.samplingPacketInterval = i
+	case fieldSamplerID:
+		fm.samplerID = i
+	case fieldTCPFlags:
+		fm.tcpFlags = i
+	case fieldTos:
+		fm.tos = i
+	case fieldIcmpTypeCode:
+		fm.icmpTypeCode = i
+	case fieldIcmpType:
+		fm.icmpType = i
+	case fieldIcmpCode:
+		fm.icmpCode = i
+	case fieldSrcVlan:
+		fm.srcVlan = i
+	case fieldDstVlan:
+		fm.dstVlan = i
+	case fieldSrcMac:
+		fm.srcMac = i
+	case fieldDstMac:
+		fm.dstMac = i
+	case fieldMplsLabel1:
+		fm.mplsLabel1 = i
+	case fieldMplsLabel2:
+		fm.mplsLabel2 = i
+	case fieldMplsLabel3:
+		fm.mplsLabel3 = i
+	case fieldMplsTopLabelAddr:
+		fm.mplsTopLabelAddr = i
+	case fieldForwardingStatus:
+		fm.forwardingStatus = i
+	case fieldDirection:
+		fm.direction = i
+	case fieldPostNATSrcAddr:
+		fm.postNATSrcAddr = i
+	case fieldPostNATDstAddr:
+		fm.postNATDstAddr = i
+	case fieldPostNAPTSrcPort:
+		fm.postNAPTSrcPort = i
+	case fieldPostNAPTDstPort:
+		fm.postNAPTDstPort = i
+	case fieldNatEvent:
+		fm.natEvent = i
+	case fieldApplicationID:
+		fm.applicationID = i
+	case fieldApplicationName:
+		fm.applicationName = i
+	}
+}
+
+// updateTemplateCache updates the template cache `tmplCache`
+func (ifs *IPFIXServer) updateTemplateCache(remote net.IP, p *ipfix.Packet, tmplCache *templateCache) {
 	templRecs := p.GetTemplateRecords()
 	for _, tr := range templRecs {
-		ifs.tmplCache.set(convert.Uint32(remote), tr.Packet.Header.DomainID, tr.Header.TemplateID, *tr)
+		if tr.Header.FieldCount == 0 {
+			ifs.withdrawTemplate(remote, tr, tmplCache)
+			continue
+		}
+
+		tmplCache.set(remote.String(), tr.Packet.Header.DomainID, tr.Header.TemplateID, *tr)
+		ifs.replayPendingSets(remote, tr, tmplCache)
+	}
+}
+
+// replayPendingSets processes data sets that have been received before template `tr`
+func (ifs *IPFIXServer) replayPendingSets(remote net.IP, tr *ipfix.TemplateRecords, tmplCache *templateCache) {
+	items := tmplCache.pending.Take(pending.Key{
+		Agent:      remote.String(),
+		SourceID:   tr.Packet.Header.DomainID,
+		TemplateID: tr.Header.TemplateID,
+	})
+
+	for _, item := range items {
+		ps := item.(*pendingSet)
+		ifs.decodeFlowSet(tr, ps.set, remote, ps.ts, ps.packet)
+	}
+}
+
+// withdrawTemplate removes the template(s) withdrawn by `tr` from `tmplCache` (RFC7011 8.1.)
+func (ifs *IPFIXServer) withdrawTemplate(remote net.IP, tr *ipfix.TemplateRecords, tmplCache *templateCache) {
+	if ifs.config.Debug > 0 {
+		log.Infof("Template %d of %s (domain %d) withdrawn", tr.Header.TemplateID, remote.String(), tr.Packet.Header.DomainID)
 	}
+
+	// A withdrawal of the (options) template set ID withdraws all (options) templates of the observation domain
+	switch tr.Header.TemplateID {
+	case ipfix.TemplateSetID:
+		tmplCache.deleteDomain(remote.String(), tr.Packet.Header.DomainID, false)
+		return
+	case ipfix.OptionsTemplateSetID:
+		tmplCache.deleteDomain(remote.String(), tr.Packet.Header.DomainID, true)
+		return
+	}
+
+	tmplCache.delete(remote.String(), tr.Packet.Header.DomainID, tr.Header.TemplateID)
 }
 
 // makeTemplateKey creates a string of the 3 tuple router address, source id and template id
@@ -0,0 +1,263 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/appcache"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/ipfix"
+	ippacket "github.com/bio-routing/tflow2/packet"
+	"github.com/bio-routing/tflow2/pending"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingSetsReplay(t *testing.T) {
+	template := ipfixMessage(ipfixSet(ipfix.TemplateSetID,
+		1, 0, 0, 2, // template 256, 2 fields
+		0, 8, 0, 4, // sourceIPv4Address
+		0, 1, 0, 8, // octetDeltaCount
+	))
+	data := func(addr byte) []byte {
+		return ipfixMessage(ipfixSet(256,
+			10, 0, 0, addr,
+			0, 0, 0, 0, 0, 0, 0, 100,
+		))
+	}
+
+	ifs := testServer(t)
+	ifs.tmplCache.pending = pending.New(10, time.Minute)
+	agent := net.IP{10, 0, 0, 254}
+
+	ifs.processPacket(agent, data(1), ifs.tmplCache)
+	ifs.processPacket(agent, data(2), ifs.tmplCache)
+	ifs.processPacket(net.IP{10, 0, 0, 253}, data(3), ifs.tmplCache)
+	assert.Equal(t, 0, len(ifs.Output))
+	assert.Equal(t, 3, ifs.tmplCache.pending.Len())
+
+	// Buffered data of the agent is replayed in order once the template arrives
+	ifs.processPacket(agent, template, ifs.tmplCache)
+	ifs.processPacket(agent, data(4), ifs.tmplCache)
+
+	for _, want := range []byte{1, 2, 4} {
+		if !assert.Equal(t, true, len(ifs.Output) > 0) {
+			return
+		}
+		fl := <-ifs.Output
+		assert.Equal(t, net.IP{10, 0, 0, want}, net.IP(fl.SrcAddr))
+	}
+	assert.Equal(t, 0, len(ifs.Output))
+	assert.Equal(t, 1, ifs.tmplCache.pending.Len())
+}
+
+func TestSamplerates(t *testing.T) {
+	templates := ipfixMessage(
+		ipfixSet(ipfix.OptionsTemplateSetID,
+			1, 1, 0, 2, 0, 1, // options template 257, 2 fields, 1 scope field
+			1, 46, 0, 8, // selectorId (scope)
+			0, 34, 0, 4, // samplingInterval
+		),
+		ipfixSet(ipfix.TemplateSetID,
+			1, 0, 0, 3, // template 256, 3 fields
+			0, 8, 0, 4, // sourceIPv4Address
+			0, 10, 0, 4, // ingressInterface
+			1, 46, 0, 8, // selectorId
+		),
+	)
+	options := ipfixMessage(ipfixSet(257,
+		0, 0, 0, 0, 0, 0, 0, 5,
+		0, 0, 3, 232,
+	))
+	data := func(intIn byte, selectorID byte) []byte {
+		return ipfixMessage(ipfixSet(256,
+			10, 0, 0, 1,
+			0, 0, 0, intIn,
+			0, 0, 0, 0, 0, 0, 0, selectorID,
+		))
+	}
+
+	ifs := testServer(t)
+	ifs.sampleRateCache = srcache.New([]config.Agent{
+		{
+			IPAddress:  "10.0.0.254",
+			SampleRate: 100,
+			InterfaceSampleRates: map[uint32]uint64{
+				2: 500,
+			},
+		},
+	})
+	agent := net.IP{10, 0, 0, 254}
+
+	ifs.processPacket(agent, templates, ifs.tmplCache)
+	ifs.processPacket(agent, options, ifs.tmplCache)
+	assert.Equal(t, 0, len(ifs.Output))
+
+	tests := []struct {
+		name       string
+		intIn      byte
+		selectorID byte
+		expected   uint64
+	}{
+		{
+			name:       "Learned selector",
+			intIn:      1,
+			selectorID: 5,
+			expected:   1000,
+		},
+		{
+			name:       "Configured interface",
+			intIn:      2,
+			selectorID: 6,
+			expected:   500,
+		},
+		{
+			name:       "Configured agent",
+			intIn:      3,
+			selectorID: 6,
+			expected:   100,
+		},
+	}
+
+	for _, test := range tests {
+		ifs.processPacket(agent, data(test.intIn, test.selectorID), ifs.tmplCache)
+		if !assert.Equal(t, 1, len(ifs.Output), test.name) {
+			return
+		}
+		fl := <-ifs.Output
+		assert.Equal(t, test.expected, fl.Samplerate, test.name)
+	}
+}
+
+func TestApplication(t *testing.T) {
+	templates := ipfixMessage(
+		ipfixSet(ipfix.OptionsTemplateSetID,
+			1, 1, 0, 2, 0, 1, // options template 257, 2 fields, 1 scope field
+			0, 95, 0, 4, // applicationId (scope)
+			0, 96, 255, 255, // applicationName, variable length
+		),
+		ipfixSet(ipfix.TemplateSetID,
+			1, 0, 0, 1, // template 256, 1 field
+			0, 95, 0, 4, // applicationId
+		),
+	)
+	options := ipfixMessage(ipfixSet(257,
+		3, 0, 0, 80,
+		4, 'h', 't', 't', 'p',
+	))
+	data := ipfixMessage(ipfixSet(256,
+		3, 0, 0, 80,
+		3, 0, 1, 187,
+	))
+
+	ifs := testServer(t)
+	ifs.appCache = appcache.New()
+	agent := net.IP{10, 0, 0, 254}
+	ifs.processPacket(agent, templates, ifs.tmplCache)
+	ifs.processPacket(agent, options, ifs.tmplCache)
+	ifs.processPacket(agent, data, ifs.tmplCache)
+	if !assert.Equal(t, 2, len(ifs.Output)) {
+		return
+	}
+
+	fl := <-ifs.Output
+	assert.Equal(t, "http", fl.Application())
+
+	// Applications missing in the application table are identified by their ID
+	fl = <-ifs.Output
+	assert.Equal(t, "3:443", fl.Application())
+}
+
+func TestFlowDimensions(t *testing.T) {
+	templates := ipfixMessage(ipfixSet(ipfix.TemplateSetID,
+		1, 0, 0, 7, // template 256, 7 fields
+		0, 8, 0, 4, // sourceIPv4Address
+		0, 4, 0, 1, // protocolIdentifier
+		0, 11, 0, 2, // destinationTransportPort
+		0, 6, 0, 2, // tcpControlBits
+		0, 5, 0, 1, // ipClassOfService
+		0, 56, 0, 6, // sourceMacAddress
+		0, 58, 0, 2, // vlanId
+	))
+	data := ipfixMessage(ipfixSet(256,
+		10, 0, 0, 1, 6, 1, 187, 0, 2, 184, 0, 0x11, 0x22, 0x33, 0x44, 0x55, 0, 42,
+		10, 0, 0, 2, 1, 3, 13, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	))
+
+	ifs := testServer(t)
+	agent := net.IP{10, 0, 0, 254}
+	ifs.processPacket(agent, templates, ifs.tmplCache)
+	ifs.processPacket(agent, data, ifs.tmplCache)
+	if !assert.Equal(t, 2, len(ifs.Output)) {
+		return
+	}
+
+	fl := <-ifs.Output
+	assert.Equal(t, uint32(ippacket.TCPFlagSYN), fl.TcpFlags)
+	assert.Equal(t, uint32(184), fl.Tos)
+	assert.Equal(t, uint32(42), fl.SrcVlan)
+	assert.Equal(t, "00:11:22:33:44:55", net.HardwareAddr(fl.SrcMac).String())
+	assert.Equal(t, uint32(0), fl.IcmpType)
+
+	// ICMP type and code are taken from the DST port
+	fl = <-ifs.Output
+	assert.Equal(t, uint32(3), fl.IcmpType)
+	assert.Equal(t, uint32(13), fl.IcmpCode)
+}
+
+func TestDirectionPolicy(t *testing.T) {
+	templates := ipfixMessage(
+		ipfixSet(ipfix.TemplateSetID,
+			1, 0, 0, 2, // template 256, 2 fields
+			0, 10, 0, 4, // ingressInterface
+			0, 61, 0, 1, // flowDirection
+		),
+		ipfixSet(ipfix.TemplateSetID,
+			1, 1, 0, 1, // template 257, 1 field
+			0, 10, 0, 4, // ingressInterface
+		),
+	)
+	data := ipfixMessage(
+		ipfixSet(256,
+			0, 0, 0, 1, 0, // ingress
+			0, 0, 0, 1, 1, // egress
+		),
+		ipfixSet(257,
+			0, 0, 0, 1, // unknown direction
+		),
+	)
+
+	ifs := testServer(t)
+	agent := net.IP{10, 0, 0, 254}
+	ifs.config.AgentsByIP = map[string]*config.Agent{
+		agent.String(): {
+			Name:           "rtr01",
+			IPAddress:      agent.String(),
+			CountDirection: config.DirectionEgress,
+		},
+	}
+	ifs.processPacket(agent, templates, ifs.tmplCache)
+	ifs.processPacket(agent, data, ifs.tmplCache)
+	if !assert.Equal(t, 2, len(ifs.Output)) {
+		return
+	}
+
+	fl := <-ifs.Output
+	assert.True(t, fl.Egress())
+
+	// Flows of templates without direction are counted regardless of the policy
+	fl = <-ifs.Output
+	assert.Equal(t, uint32(1), fl.IntIn)
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifserver
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxMessageLength is the maximum length of an IPFIX message
+const maxMessageLength = 65535
+
+// tcpListener accepts IPFIX over TCP connections and starts a session for each of them
+func (ifs *IPFIXServer) tcpListener(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Errorf("Unable to accept IPFIX connection: %v", err)
+			return
+		}
+
+		go ifs.tcpSession(conn)
+	}
+}
+
+// tcpSession reads IPFIX messages from `conn` until the connection is closed
+func (ifs *IPFIXServer) tcpSession(conn net.Conn) {
+	defer conn.Close()
+
+	remote := conn.RemoteAddr().(*net.TCPAddr).IP
+	if remote.To4() != nil {
+		remote = remote.To4()
+	}
+
+	if !ifs.validateSource(remote) {
+		log.Errorf("Unknown source: %s", remote.String())
+	}
+
+	atomic.AddInt64(&stats.GlobalStats.IPFIXSessions, 1)
+	defer atomic.AddInt64(&stats.GlobalStats.IPFIXSessions, -1)
+
+	err := ifs.readSession(remote, conn.RemoteAddr().String(), conn)
+	if err != nil {
+		log.Errorf("IPFIX session with %s failed: %v", remote.String(), err)
+		return
+	}
+
+	if ifs.config.Debug > 0 {
+		log.Infof("IPFIX session with %s closed", remote.String())
+	}
+}
+
+// readSession processes IPFIX messages read from `r`. Templates are scoped to the session
+// and are dropped once `r` is exhausted. Templates of TCP sessions do not expire (RFC7011 8.).
+func (ifs *IPFIXServer) readSession(remote net.IP, session string, r io.Reader) error {
+	tmplCache := newTemplateCache(0)
+
+	ifs.sessionsLock.Lock()
+	ifs.sessions[session] = tmplCache
+	ifs.sessionsLock.Unlock()
+
+	defer func() {
+		ifs.sessionsLock.Lock()
+		delete(ifs.sessions, session)
+		ifs.sessionsLock.Unlock()
+	}()
+
+	buffer := make([]byte, maxMessageLength)
+	for {
+		msg, err := readMessage(r, buffer)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		atomic.AddUint64(&stats.GlobalStats.IPFIXpackets, 1)
+		atomic.AddUint64(&stats.GlobalStats.IPFIXbytes, uint64(len(msg)))
+
+		ifs.processPacket(remote, msg, tmplCache)
+	}
+}
+
+// readMessage reads a single length framed IPFIX message from `r` into `buffer`
+func readMessage(r io.Reader, buffer []byte) ([]byte, error) {
+	_, err := io.ReadFull(r, buffer[:ipfix.HeaderLength])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.Wrap(err, "Unable to read message header")
+		}
+		return nil, err
+	}
+
+	if v := convert.Uint16b(buffer[0:2]); v != 10 {
+		return nil, errors.Errorf("Invalid version %d", v)
+	}
+
+	length := int(convert.Uint16b(buffer[2:4]))
+	if length < ipfix.HeaderLength {
+		return nil, errors.Errorf("Invalid message length %d", length)
+	}
+
+	_, err = io.ReadFull(r, buffer[ipfix.HeaderLength:length])
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errors.Wrap(err, "Unable to read message")
+	}
+
+	return buffer[:length], nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifserver
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/stretchr/testify/assert"
+)
+
+// ipfixMessage builds an IPFIX message consisting of `sets`
+func ipfixMessage(sets ...[]byte) []byte {
+	body := make([]byte, 0)
+	for _, s := range sets {
+		body = append(body, s...)
+	}
+
+	msg := append([]byte{0, 10}, convert.Uint16Byte(uint16(ipfix.HeaderLength+len(body)))...)
+	msg = append(msg, 0, 0, 0, 1) // export time
+	msg = append(msg, 0, 0, 0, 0) // sequence number
+	msg = append(msg, 0, 0, 0, 1) // observation domain
+	return append(msg, body...)
+}
+
+// ipfixSet builds an IPFIX set with ID `id`
+func ipfixSet(id uint16, body ...byte) []byte {
+	set := append(convert.Uint16Byte(id), convert.Uint16Byte(uint16(4+len(body)))...)
+	return append(set, body...)
+}
+
+func testServer(t *testing.T) *IPFIXServer {
+	reg, err := ipfix.LoadRegistry("../ipfix_information_elements.csv")
+	if err != nil {
+		t.Fatalf("Unable to load registry: %v", err)
+	}
+
+	mapping, err := newFieldMapping(reg, nil)
+	if err != nil {
+		t.Fatalf("Unable to create field mapping: %v", err)
+	}
+
+	return &IPFIXServer{
+		tmplCache:       newTemplateCache(0),
+		sessions:        make(map[string]*templateCache),
+		Output:          make(chan *netflow.Flow, 10),
+		sampleRateCache: srcache.New(nil),
+		fieldMapping:    mapping,
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+		},
+	}
+}
+
+func TestReadSession(t *testing.T) {
+	template := ipfixMessage(ipfixSet(ipfix.TemplateSetID,
+		1, 0, 0, 2, // template 256, 2 fields
+		0, 8, 0, 4, // sourceIPv4Address
+		0, 1, 0, 8, // octetDeltaCount
+	))
+	data := ipfixMessage(ipfixSet(256,
+		10, 0, 0, 1,
+		0, 0, 0, 0, 0, 0, 0, 100,
+	))
+	withdrawal := ipfixMessage(ipfixSet(ipfix.TemplateSetID,
+		1, 0, 0, 0, // template 256, 0 fields
+	))
+	withdrawAll := ipfixMessage(ipfixSet(ipfix.TemplateSetID,
+		0, 2, 0, 0, // template set ID, 0 fields
+	))
+
+	tests := []struct {
+		name      string
+		messages  [][]byte
+		wantFlows int
+		wantErr   bool
+	}{
+		{
+			name:      "Template and data",
+			messages:  [][]byte{template, data, data},
+			wantFlows: 2,
+		},
+		{
+			name:      "Template of other session",
+			messages:  [][]byte{data},
+			wantFlows: 0,
+		},
+		{
+			name:      "Withdrawal",
+			messages:  [][]byte{template, data, withdrawal, data},
+			wantFlows: 1,
+		},
+		{
+			name:      "Withdrawal of all templates",
+			messages:  [][]byte{template, data, withdrawAll, data},
+			wantFlows: 1,
+		},
+		{
+			name:      "Truncated message",
+			messages:  [][]byte{template, data[:20]},
+			wantFlows: 0,
+			wantErr:   true,
+		},
+	}
+
+	ifs := testServer(t)
+	for _, test := range tests {
+		stream := make([]byte, 0)
+		for _, msg := range test.messages {
+			stream = append(stream, msg...)
+		}
+
+		err := ifs.readSession(net.IP{10, 0, 0, 254}, "10.0.0.254:4242", bytes.NewReader(stream))
+		assert.Equal(t, test.wantErr, err != nil, test.name)
+
+		flows := 0
+		for len(ifs.Output) > 0 {
+			fl := <-ifs.Output
+			assert.Equal(t, uint64(100), fl.Size, test.name)
+			flows++
+		}
+		assert.Equal(t, test.wantFlows, flows, test.name)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	buffer := make([]byte, maxMessageLength)
+
+	_, err := readMessage(bytes.NewReader(nil), buffer)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = readMessage(bytes.NewReader([]byte{0, 9, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}), buffer)
+	assert.Error(t, err, "invalid version")
+
+	_, err = readMessage(bytes.NewReader([]byte{0, 10, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}), buffer)
+	assert.Error(t, err, "invalid length")
+
+	msg := ipfixMessage(ipfixSet(256, bytes.Repeat([]byte{1}, 2000)...))
+	res, err := readMessage(bytes.NewReader(msg), buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, res)
+}
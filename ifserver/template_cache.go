@@ -12,34 +12,87 @@
 package ifserver
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/bio-routing/tflow2/pending"
+	"github.com/pkg/errors"
 )
 
+// Template is the serializable representation of a cached template
+type Template struct {
+	Router     string  `json:"router"`
+	Session    string  `json:"session,omitempty"`
+	DomainID   uint32  `json:"domain_id"`
+	TemplateID uint16  `json:"template_id"`
+	LastSeen   int64   `json:"last_seen"`
+	Fields     []Field `json:"fields"`
+
+	// ScopeFieldCount is the number of scope fields of an options template (0 for templates)
+	ScopeFieldCount uint16 `json:"scope_field_count,omitempty"`
+}
+
+// Field is the serializable representation of a template field
+type Field struct {
+	Type             uint16 `json:"type"`
+	Length           uint16 `json:"length"`
+	EnterpriseNumber uint32 `json:"enterprise_number,omitempty"`
+}
+
+type templateCacheEntry struct {
+	records  ipfix.TemplateRecords
+	lastSeen time.Time
+}
+
 type templateCache struct {
-	cache map[uint32]map[uint32]map[uint16]ipfix.TemplateRecords
+	cache map[string]map[uint32]map[uint16]*templateCacheEntry
 	lock  sync.RWMutex
+
+	// timeout is the time after which a template not refreshed by the exporter expires (0 = never)
+	timeout time.Duration
+
+	// dirty is set when the cache has been modified since it was last saved
+	dirty bool
+
+	// pending holds data sets received before their template (nil = data sets are not held)
+	pending *pending.Queue
 }
 
 // newTemplateCache creates and initializes a new `templateCache` instance
-func newTemplateCache() *templateCache {
-	return &templateCache{cache: make(map[uint32]map[uint32]map[uint16]ipfix.TemplateRecords)}
+func newTemplateCache(timeout time.Duration) *templateCache {
+	return &templateCache{
+		cache:   make(map[string]map[uint32]map[uint16]*templateCacheEntry),
+		timeout: timeout,
+	}
 }
 
-func (c *templateCache) set(rtr uint32, domainID uint32, templateID uint16, records ipfix.TemplateRecords) {
+func (c *templateCache) set(rtr string, domainID uint32, templateID uint16, records ipfix.TemplateRecords) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	c.setEntry(rtr, domainID, templateID, &templateCacheEntry{
+		records:  records,
+		lastSeen: time.Now(),
+	})
+}
+
+// setEntry adds `entry` to the cache. Caller must hold the write lock.
+func (c *templateCache) setEntry(rtr string, domainID uint32, templateID uint16, entry *templateCacheEntry) {
 	if _, ok := c.cache[rtr]; !ok {
-		c.cache[rtr] = make(map[uint32]map[uint16]ipfix.TemplateRecords)
+		c.cache[rtr] = make(map[uint32]map[uint16]*templateCacheEntry)
 	}
 	if _, ok := c.cache[rtr][domainID]; !ok {
-		c.cache[rtr][domainID] = make(map[uint16]ipfix.TemplateRecords)
+		c.cache[rtr][domainID] = make(map[uint16]*templateCacheEntry)
 	}
-	c.cache[rtr][domainID][templateID] = records
+	c.cache[rtr][domainID][templateID] = entry
+	c.dirty = true
 }
 
-func (c *templateCache) get(rtr uint32, domainID uint32, templateID uint16) *ipfix.TemplateRecords {
+func (c *templateCache) get(rtr string, domainID uint32, templateID uint16) *ipfix.TemplateRecords {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	if _, ok := c.cache[rtr]; !ok {
@@ -48,9 +101,196 @@ func (c *templateCache) get(rtr uint32, domainID uint32, templateID uint16) *ipf
 	if _, ok := c.cache[rtr][domainID]; !ok {
 		return nil
 	}
-	if _, ok := c.cache[rtr][domainID][templateID]; !ok {
+	entry, ok := c.cache[rtr][domainID][templateID]
+	if !ok || c.expired(entry, time.Now()) {
 		return nil
 	}
-	ret := c.cache[rtr][domainID][templateID]
+	ret := entry.records
 	return &ret
 }
+
+// delete removes template `templateID` of observation domain `domainID` of router `rtr`
+func (c *templateCache) delete(rtr string, domainID uint32, templateID uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.cache[rtr]; !ok {
+		return
+	}
+	delete(c.cache[rtr][domainID], templateID)
+	c.dirty = true
+}
+
+// deleteDomain removes all templates (or options templates if `options` is set) of observation domain
+// `domainID` of router `rtr`
+func (c *templateCache) deleteDomain(rtr string, domainID uint32, options bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.cache[rtr]; !ok {
+		return
+	}
+	for templateID, entry := range c.cache[rtr][domainID] {
+		if entry.records.IsOptions() == options {
+			delete(c.cache[rtr][domainID], templateID)
+		}
+	}
+	c.dirty = true
+}
+
+// expired checks if `entry` has expired at time `now`
+func (c *templateCache) expired(entry *templateCacheEntry, now time.Time) bool {
+	return c.timeout > 0 && now.Sub(entry.lastSeen) > c.timeout
+}
+
+// expire removes all expired templates and returns the number of templates removed
+func (c *templateCache) expire() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	count := 0
+	for rtr, domains := range c.cache {
+		for domainID, templates := range domains {
+			for templateID, entry := range templates {
+				if c.expired(entry, now) {
+					delete(templates, templateID)
+					count++
+				}
+			}
+			if len(templates) == 0 {
+				delete(domains, domainID)
+			}
+		}
+		if len(domains) == 0 {
+			delete(c.cache, rtr)
+		}
+	}
+
+	if count > 0 {
+		c.dirty = true
+	}
+	return count
+}
+
+// templates returns all templates in the cache ordered by router, domain and template ID
+func (c *templateCache) templates() []Template {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	res := make([]Template, 0)
+	for rtr, domains := range c.cache {
+		for domainID, templates := range domains {
+			for templateID, entry := range templates {
+				t := Template{
+					Router:     rtr,
+					DomainID:   domainID,
+					TemplateID: templateID,
+					LastSeen:   entry.lastSeen.Unix(),
+					Fields:     make([]Field, 0, len(entry.records.Records)),
+
+					ScopeFieldCount: entry.records.ScopeFieldCount,
+				}
+				for _, rec := range entry.records.Records {
+					t.Fields = append(t.Fields, Field{
+						Type:             rec.Type,
+						Length:           rec.Length,
+						EnterpriseNumber: rec.EnterpriseNumber,
+					})
+				}
+				res = append(res, t)
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Router != res[j].Router {
+			return res[i].Router < res[j].Router
+		}
+		if res[i].DomainID != res[j].DomainID {
+			return res[i].DomainID < res[j].DomainID
+		}
+		return res[i].TemplateID < res[j].TemplateID
+	})
+
+	return res
+}
+
+// save writes the cache to `filename` if it has been modified since it was last saved
+func (c *templateCache) save(filename string) error {
+	c.lock.Lock()
+	dirty := c.dirty
+	c.dirty = false
+	c.lock.Unlock()
+
+	if !dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.templates())
+	if err != nil {
+		return errors.Wrap(err, "Unable to marshal templates")
+	}
+
+	// Write to a temporary file first so a crash can not leave a truncated file behind
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write %s", tmp)
+	}
+
+	err = os.Rename(tmp, filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to rename %s", tmp)
+	}
+
+	return nil
+}
+
+// load reads templates saved by save() from `filename`. Expired templates are skipped.
+func (c *templateCache) load(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", filename)
+	}
+
+	templates := make([]Template, 0)
+	err = json.Unmarshal(data, &templates)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", filename)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for _, t := range templates {
+		entry := &templateCacheEntry{
+			records: ipfix.TemplateRecords{
+				Header: &ipfix.TemplateRecordHeader{
+					TemplateID: t.TemplateID,
+					FieldCount: uint16(len(t.Fields)),
+				},
+				Records: make([]*ipfix.TemplateRecord, 0, len(t.Fields)),
+
+				ScopeFieldCount: t.ScopeFieldCount,
+			},
+			lastSeen: time.Unix(t.LastSeen, 0),
+		}
+
+		if c.expired(entry, now) {
+			continue
+		}
+
+		for _, f := range t.Fields {
+			entry.records.Records = append(entry.records.Records, &ipfix.TemplateRecord{
+				Type:             f.Type,
+				Length:           f.Length,
+				EnterpriseNumber: f.EnterpriseNumber,
+			})
+		}
+
+		c.setEntry(t.Router, t.DomainID, t.TemplateID, entry)
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ifserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTemplate(id uint16) ipfix.TemplateRecords {
+	return ipfix.TemplateRecords{
+		Header: &ipfix.TemplateRecordHeader{
+			TemplateID: id,
+			FieldCount: 2,
+		},
+		Records: []*ipfix.TemplateRecord{
+			{Type: ipfix.IPv4SrcAddr, Length: 4},
+			{Type: 12236, Length: 4, EnterpriseNumber: 9},
+		},
+	}
+}
+
+func TestTemplateCacheExpiry(t *testing.T) {
+	c := newTemplateCache(time.Minute)
+	c.set("10.0.0.1", 1, 256, testTemplate(256))
+	c.set("10.0.0.1", 1, 257, testTemplate(257))
+	c.cache["10.0.0.1"][1][257].lastSeen = time.Now().Add(-2 * time.Minute)
+
+	assert.NotNil(t, c.get("10.0.0.1", 1, 256))
+	assert.Nil(t, c.get("10.0.0.1", 1, 257))
+
+	assert.Equal(t, 1, c.expire())
+	assert.Equal(t, 1, len(c.templates()))
+
+	c.cache["10.0.0.1"][1][256].lastSeen = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, 1, c.expire())
+	assert.Equal(t, 0, len(c.cache))
+}
+
+func TestTemplateCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tflow2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, templateFileName)
+
+	c := newTemplateCache(time.Minute)
+	c.set("10.0.0.1", 1, 256, testTemplate(256))
+	c.set("2001:db8::1", 2, 257, testTemplate(257))
+	c.set("2001:db8::1", 2, 258, testTemplate(258))
+	c.cache["2001:db8::1"][2][258].lastSeen = time.Now().Add(-time.Minute)
+
+	if !assert.NoError(t, c.save(filename)) {
+		return
+	}
+	assert.False(t, c.dirty)
+
+	// Templates that expired while not running must not be restored
+	restored := newTemplateCache(45 * time.Second)
+
+	if !assert.NoError(t, restored.load(filename)) {
+		return
+	}
+
+	assert.Equal(t, 2, len(restored.templates()))
+	tmpl := restored.get("2001:db8::1", 2, 257)
+	if !assert.NotNil(t, tmpl) {
+		return
+	}
+	assert.Equal(t, uint16(257), tmpl.Header.TemplateID)
+	assert.Equal(t, testTemplate(257).Records, tmpl.Records)
+	assert.Nil(t, restored.get("2001:db8::1", 2, 258))
+
+	assert.Error(t, restored.load(filepath.Join(dir, "missing.json")))
+}
+
+func TestTemplateCachePersistenceOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tflow2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, templateFileName)
+
+	options := testTemplate(512)
+	options.ScopeFieldCount = 1
+
+	c := newTemplateCache(time.Minute)
+	c.set("10.0.0.1", 1, 512, options)
+	if !assert.NoError(t, c.save(filename)) {
+		return
+	}
+
+	restored := newTemplateCache(time.Minute)
+	if !assert.NoError(t, restored.load(filename)) {
+		return
+	}
+
+	tmpl := restored.get("10.0.0.1", 1, 512)
+	if !assert.NotNil(t, tmpl) {
+		return
+	}
+	assert.True(t, tmpl.IsOptions())
+	assert.Equal(t, uint16(1), tmpl.ScopeFieldCount)
+}
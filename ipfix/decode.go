@@ -31,6 +31,9 @@ const SetIDTemplateMax = 255
 // TemplateSetID is the set ID reserved for template sets
 const TemplateSetID = 2
 
+// OptionsTemplateSetID is the set ID reserved for options template sets
+const OptionsTemplateSetID = 3
+
 // errorIncompatibleVersion prints an error message in case the detected version is not supported
 func errorIncompatibleVersion(version uint16) error {
 	return errors.Errorf("IPFIX: Incompatible protocol version v%d, only v10 is supported", version)
@@ -41,24 +44,20 @@ func Decode(raw []byte, remote net.IP) (*Packet, error) {
 	data := convert.Reverse(raw) //TODO: Make it endian aware. This assumes a little endian machine
 
 	pSize := len(data)
-	bufSize := 1500
-	buffer := [1500]byte{}
-
-	if pSize > bufSize {
-		panic("Buffer too small\n")
+	if pSize < int(sizeOfHeader) {
+		return nil, errors.Errorf("IPFIX: Packet too short (%d bytes)", pSize)
 	}
 
-	// copy data into array as arrays allow us to cast the shit out of it
-	for i := 0; i < pSize; i++ {
-		buffer[bufSize-pSize+i] = data[i]
-	}
+	// copy data into a new buffer as templates keep pointing into it
+	buffer := make([]byte, pSize)
+	copy(buffer, data)
 
-	bufferPtr := unsafe.Pointer(&buffer)
-	bufferMinPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(bufSize) - uintptr(pSize))
-	headerPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(bufSize) - uintptr(sizeOfHeader))
+	bufferPtr := unsafe.Pointer(&buffer[0])
+	bufferMinPtr := bufferPtr
+	headerPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(pSize) - uintptr(sizeOfHeader))
 
 	var packet Packet
-	packet.Buffer = buffer[:]
+	packet.Buffer = buffer
 	packet.Header = (*Header)(headerPtr)
 
 	if packet.Header.Version != 10 {
@@ -68,16 +67,23 @@ func Decode(raw []byte, remote net.IP) (*Packet, error) {
 	//Pre-allocate some room for templates to avoid later copying
 	packet.Templates = make([]*TemplateRecords, 0, numPreAllocRecs)
 
-	for uintptr(headerPtr) > uintptr(bufferMinPtr) {
+	for uintptr(headerPtr)-uintptr(bufferMinPtr) >= sizeOfSetHeader {
 		ptr := unsafe.Pointer(uintptr(headerPtr) - sizeOfSetHeader)
 
 		fls := &Set{
 			Header: (*SetHeader)(ptr),
 		}
 
+		if uintptr(fls.Header.Length) < sizeOfSetHeader || uintptr(fls.Header.Length) > uintptr(headerPtr)-uintptr(bufferMinPtr) {
+			return nil, errors.Errorf("IPFIX: Invalid set length %d", fls.Header.Length)
+		}
+
 		if fls.Header.SetID == TemplateSetID {
 			// Template
-			decodeTemplate(&packet, ptr, uintptr(fls.Header.Length)-sizeOfSetHeader, remote)
+			decodeTemplate(&packet, ptr, uintptr(fls.Header.Length)-sizeOfSetHeader, remote, false)
+		} else if fls.Header.SetID == OptionsTemplateSetID {
+			// Options template
+			decodeTemplate(&packet, ptr, uintptr(fls.Header.Length)-sizeOfSetHeader, remote, true)
 		} else if fls.Header.SetID > SetIDTemplateMax {
 			// Actual data packet
 			decodeData(&packet, ptr, uintptr(fls.Header.Length)-sizeOfSetHeader)
@@ -102,10 +108,11 @@ func decodeData(packet *Packet, headerPtr unsafe.Pointer, size uintptr) {
 	packet.FlowSets = append(packet.FlowSets, fls)
 }
 
-// decodeTemplate decodes a template from `packet`
-func decodeTemplate(packet *Packet, end unsafe.Pointer, size uintptr, remote net.IP) {
+// decodeTemplate decodes a template from `packet`. Options templates carry a scope field count
+// following the template record header.
+func decodeTemplate(packet *Packet, end unsafe.Pointer, size uintptr, remote net.IP, options bool) {
 	min := uintptr(end) - size
-	for uintptr(end) > min {
+	for uintptr(end) >= min+sizeOfTemplateRecordHeader {
 		headerPtr := unsafe.Pointer(uintptr(end) - sizeOfTemplateRecordHeader)
 
 		tmplRecs := &TemplateRecords{}
@@ -113,16 +120,44 @@ func decodeTemplate(packet *Packet, end unsafe.Pointer, size uintptr, remote net
 		tmplRecs.Packet = packet
 		tmplRecs.Records = make([]*TemplateRecord, 0, numPreAllocRecs)
 
-		ptr := unsafe.Pointer(uintptr(headerPtr) - sizeOfTemplateRecordHeader)
+		ptr := headerPtr
+		if options && tmplRecs.Header.FieldCount > 0 {
+			if uintptr(ptr)-sizeOfScopeFieldCount < min {
+				return
+			}
+
+			tmplRecs.ScopeFieldCount = *(*uint16)(unsafe.Pointer(uintptr(ptr) - sizeOfScopeFieldCount))
+			ptr = unsafe.Pointer(uintptr(ptr) - sizeOfScopeFieldCount)
+		}
 		var i uint16
 		for i = 0; i < tmplRecs.Header.FieldCount; i++ {
-			rec := (*TemplateRecord)(unsafe.Pointer(ptr))
+			if uintptr(ptr)-sizeOfFieldSpecifier < min {
+				return
+			}
+
+			spec := (*fieldSpecifier)(unsafe.Pointer(uintptr(ptr) - sizeOfFieldSpecifier))
+			ptr = unsafe.Pointer(uintptr(ptr) - sizeOfFieldSpecifier)
+
+			rec := &TemplateRecord{
+				Length: spec.Length,
+				Type:   spec.Type,
+			}
+
+			if spec.Type&EnterpriseBit != 0 {
+				if uintptr(ptr)-sizeOfEnterpriseNumber < min {
+					return
+				}
+
+				rec.Type = spec.Type &^ EnterpriseBit
+				rec.EnterpriseNumber = *(*uint32)(unsafe.Pointer(uintptr(ptr) - sizeOfEnterpriseNumber))
+				ptr = unsafe.Pointer(uintptr(ptr) - sizeOfEnterpriseNumber)
+			}
+
 			tmplRecs.Records = append(tmplRecs.Records, rec)
-			ptr = unsafe.Pointer(uintptr(ptr) - sizeOfTemplateRecord)
 		}
 
 		packet.Templates = append(packet.Templates, tmplRecs)
-		end = unsafe.Pointer(uintptr(end) - uintptr(tmplRecs.Header.FieldCount)*sizeOfTemplateRecord - sizeOfTemplateRecordHeader)
+		end = ptr
 	}
 }
 
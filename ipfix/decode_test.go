@@ -0,0 +1,86 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfix
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTemplateEnterpriseElements(t *testing.T) {
+	set := []byte{
+		0, 2, 0, 32, // set ID 2, length 32
+		1, 0, 0, 3, // template 256, 3 fields
+		0, 8, 0, 4, // sourceIPv4Address
+		0xaf, 0xcc, 0, 4, 0, 0, 0, 9, // Cisco (9) element 12236
+		0, 7, 0, 2, // sourceTransportPort
+		1, 1, 0, 1, // template 257, 1 field
+		0, 1, 0, 8, // octetDeltaCount
+	}
+
+	raw := []byte{
+		0, 10, 0, 48, // version 10, length 48
+		0, 0, 0, 1, // export time
+		0, 0, 0, 2, // sequence number
+		0, 0, 0, 3, // observation domain
+	}
+	raw = append(raw, set...)
+
+	p, err := Decode(raw, net.IP{10, 0, 0, 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tmpls := p.GetTemplateRecords()
+	if !assert.Equal(t, 2, len(tmpls)) {
+		return
+	}
+
+	assert.Equal(t, uint16(256), tmpls[0].Header.TemplateID)
+	assert.Equal(t, []*TemplateRecord{
+		{Type: IPv4SrcAddr, Length: 4},
+		{Type: 12236, Length: 4, EnterpriseNumber: 9},
+		{Type: L4SrcPort, Length: 2},
+	}, tmpls[0].Records)
+
+	assert.Equal(t, uint16(257), tmpls[1].Header.TemplateID)
+	assert.Equal(t, []*TemplateRecord{
+		{Type: InBytes, Length: 8},
+	}, tmpls[1].Records)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{
+			name: "Short header",
+			raw:  []byte{0, 10, 0, 8},
+		},
+		{
+			name: "Set length zero",
+			raw:  []byte{0, 10, 0, 20, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 1, 0, 0, 0},
+		},
+		{
+			name: "Set exceeds message",
+			raw:  []byte{0, 10, 0, 20, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 1, 0, 0, 8},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Decode(test.raw, net.IP{10, 0, 0, 1})
+		assert.Error(t, err, test.name)
+	}
+}
@@ -108,5 +108,9 @@ const (
 	ApplicationDescription    = 94
 	ApplicationTag            = 95
 	ApplicationName           = 96
+	FlowStartSeconds          = 150
+	FlowEndSeconds            = 151
+	FlowStartMilliseconds     = 152
+	FlowEndMilliseconds       = 153
 	SamplingPacketInterval    = 305
 )
@@ -208,6 +208,9 @@ type Packet struct {
 
 var sizeOfHeader = unsafe.Sizeof(Header{})
 
+// HeaderLength is the length of an IPFIX message header on the wire
+const HeaderLength = 16
+
 // GetTemplateRecords generate a list of all Template Records in the packet.
 // Template Records can be used to decode Data FlowSets to Data Records.
 func (p *Packet) GetTemplateRecords() []*TemplateRecords {
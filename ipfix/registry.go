@@ -0,0 +1,147 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfix
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Abstract data types of information elements (RFC7012 3.1.)
+const (
+	DataTypeIPv4Address          = "ipv4Address"
+	DataTypeIPv6Address          = "ipv6Address"
+	DataTypeDateTimeSeconds      = "dateTimeSeconds"
+	DataTypeDateTimeMilliseconds = "dateTimeMilliseconds"
+)
+
+// InformationElement describes an IPFIX information element
+type InformationElement struct {
+	// Private enterprise number. 0 for IANA assigned elements.
+	EnterpriseNumber uint32
+	ID               uint16
+	Name             string
+	DataType         string
+}
+
+// ieKey identifies an information element
+type ieKey struct {
+	enterpriseNumber uint32
+	id               uint16
+}
+
+// Registry is a registry of known information elements
+type Registry struct {
+	byID   map[ieKey]*InformationElement
+	byName map[string]*InformationElement
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		byID:   make(map[ieKey]*InformationElement),
+		byName: make(map[string]*InformationElement),
+	}
+}
+
+// LoadRegistry reads information elements from the CSV file `filename`
+func LoadRegistry(filename string) (*Registry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open %s", filename)
+	}
+	defer f.Close()
+
+	r, err := ReadRegistry(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read %s", filename)
+	}
+
+	return r, nil
+}
+
+// ReadRegistry reads information elements in CSV format (enterprise,id,name,type) from `in`.
+// Lines starting with # are ignored as well as a header line.
+func ReadRegistry(in io.Reader) (*Registry, error) {
+	reader := csv.NewReader(in)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	reg := NewRegistry()
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse CSV")
+		}
+
+		if rec[0] == "enterprise" {
+			continue
+		}
+
+		enterprise, err := strconv.ParseUint(rec[0], 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid enterprise number %q", rec[0])
+		}
+
+		id, err := strconv.ParseUint(rec[1], 10, 15)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid element ID %q", rec[1])
+		}
+
+		err = reg.Add(&InformationElement{
+			EnterpriseNumber: uint32(enterprise),
+			ID:               uint16(id),
+			Name:             strings.TrimSpace(rec[2]),
+			DataType:         strings.TrimSpace(rec[3]),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reg, nil
+}
+
+// Add adds an information element to the registry
+func (r *Registry) Add(ie *InformationElement) error {
+	key := ieKey{enterpriseNumber: ie.EnterpriseNumber, id: ie.ID}
+	if _, ok := r.byID[key]; ok {
+		return errors.Errorf("Duplicate information element %d/%d", ie.EnterpriseNumber, ie.ID)
+	}
+
+	if _, ok := r.byName[ie.Name]; ok {
+		return errors.Errorf("Duplicate information element name %s", ie.Name)
+	}
+
+	r.byID[key] = ie
+	r.byName[ie.Name] = ie
+	return nil
+}
+
+// Get returns the information element `id` of enterprise `enterpriseNumber` or nil if unknown
+func (r *Registry) Get(enterpriseNumber uint32, id uint16) *InformationElement {
+	return r.byID[ieKey{enterpriseNumber: enterpriseNumber, id: id}]
+}
+
+// GetByName returns the information element called `name` or nil if unknown
+func (r *Registry) GetByName(name string) *InformationElement {
+	return r.byName[name]
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRegistry(t *testing.T) {
+	reg, err := LoadRegistry("../ipfix_information_elements.csv")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, &InformationElement{
+		ID:       IPv6SrcAddr,
+		Name:     "sourceIPv6Address",
+		DataType: DataTypeIPv6Address,
+	}, reg.Get(0, IPv6SrcAddr))
+
+	assert.Equal(t, &InformationElement{
+		EnterpriseNumber: 637,
+		ID:               93,
+		Name:             "aluNatSubString",
+		DataType:         "string",
+	}, reg.GetByName("aluNatSubString"))
+
+	assert.Nil(t, reg.Get(9, IPv6SrcAddr))
+}
+
+func TestReadRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:  "Valid",
+			input: "enterprise,id,name,type\n# comment\n0,8,sourceIPv4Address,ipv4Address\n9,8,ciscoElement,string\n",
+		},
+		{
+			name:    "Duplicate ID",
+			input:   "0,8,sourceIPv4Address,ipv4Address\n0,8,other,ipv4Address\n",
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate name",
+			input:   "0,8,sourceIPv4Address,ipv4Address\n9,8,sourceIPv4Address,ipv4Address\n",
+			wantErr: true,
+		},
+		{
+			name:    "ID out of range",
+			input:   "0,32768,tooLarge,string\n",
+			wantErr: true,
+		},
+		{
+			name:    "Missing column",
+			input:   "0,8,sourceIPv4Address\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ReadRegistry(strings.NewReader(test.input))
+		assert.Equal(t, test.wantErr, err != nil, test.name)
+	}
+}
@@ -11,11 +11,21 @@
 
 package ipfix
 
-import "unsafe"
+import (
+	"unsafe"
+
+	"github.com/bio-routing/tflow2/convert"
+)
 
 const (
 	// numPreAllocFlowDataRecs is number of elements to pre allocate in DataRecs slice
 	numPreAllocFlowDataRecs = 20
+
+	// VariableLength is the field length indicating a variable length information element (RFC7011 7.)
+	VariableLength = 65535
+
+	// EnterpriseBit is set in the element ID of enterprise specific information elements (RFC7011 3.2.)
+	EnterpriseBit = 0x8000
 )
 
 // TemplateRecordHeader represents the header of a template record
@@ -46,6 +56,15 @@ type TemplateRecords struct {
 	Packet *Packet
 
 	Values [][]byte
+
+	// Number of scope fields of an options template (0 for templates). Scope fields are the first
+	// ScopeFieldCount fields of Records.
+	ScopeFieldCount uint16
+}
+
+// IsOptions returns true if `t` is an options template
+func (t *TemplateRecords) IsOptions() bool {
+	return t.ScopeFieldCount > 0
 }
 
 //TemplateRecord represents a Template Record as described in RFC3954
@@ -55,6 +74,15 @@ type TemplateRecord struct {
 
 	// A numeric value that represents the type of field.
 	Type uint16
+
+	// Private enterprise number of enterprise specific information elements, 0 otherwise
+	EnterpriseNumber uint32
+}
+
+// fieldSpecifier is the raw representation of a template field specifier (without enterprise number)
+type fieldSpecifier struct {
+	Length uint16
+	Type   uint16
 }
 
 // FlowDataRecord is actual NetFlow data. This structure does not contain any
@@ -65,8 +93,14 @@ type FlowDataRecord struct {
 	Values [][]byte
 }
 
-// sizeOfTemplateRecord is the raw size of a TemplateRecord
-var sizeOfTemplateRecord = unsafe.Sizeof(TemplateRecord{})
+// sizeOfFieldSpecifier is the raw size of a field specifier
+var sizeOfFieldSpecifier = unsafe.Sizeof(fieldSpecifier{})
+
+// sizeOfEnterpriseNumber is the raw size of the enterprise number following enterprise specific field specifiers
+const sizeOfEnterpriseNumber = 4
+
+// sizeOfScopeFieldCount is the size of the scope field count of an options template record header
+const sizeOfScopeFieldCount = 2
 
 // DecodeFlowSet uses current TemplateRecord to decode data in Data FlowSet to
 // a list of Flow Data Records.
@@ -103,12 +137,44 @@ func parseFieldValues(flows []byte, fields []*TemplateRecord) ([][]byte, int) {
 	n := len(flows)
 	values := make([][]byte, len(fields))
 	for i, f := range fields {
-		if n < int(f.Length) {
+		length := int(f.Length)
+		if f.Length == VariableLength {
+			var prefixLen int
+			length, prefixLen = variableFieldLength(flows[0:n])
+			if length < 0 {
+				return nil, 0
+			}
+			count += prefixLen
+			n -= prefixLen
+		}
+
+		if n < length {
 			return nil, 0
 		}
-		values[i] = flows[n-int(f.Length) : n]
-		count += int(f.Length)
-		n -= int(f.Length)
+		values[i] = flows[n-length : n]
+		count += length
+		n -= length
 	}
 	return values, count
 }
+
+// variableFieldLength reads the length of a variable length field at the end of (reversed) `data`.
+// It returns the length of the value and the number of bytes used to encode the length or -1 if `data` is too short.
+func variableFieldLength(data []byte) (int, int) {
+	n := len(data)
+	if n < 1 {
+		return -1, 0
+	}
+
+	length := int(data[n-1])
+	if length < 255 {
+		return length, 1
+	}
+
+	// Lengths >= 255 are encoded as 255 followed by a 2 byte length
+	if n < 3 {
+		return -1, 0
+	}
+
+	return int(convert.Uint16(data[n-3 : n-1])), 3
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfix
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFlowSetVariableLength(t *testing.T) {
+	long := bytes.Repeat([]byte{'a'}, 300)
+
+	// Wire format of a single record
+	record := []byte{10, 0, 0, 1} // sourceIPv4Address
+	record = append(record, 4)    // interfaceName length
+	record = append(record, []byte("eth0")...)
+	record = append(record, 255, 1, 44) // applicationDescription length (300)
+	record = append(record, long...)
+	record = append(record, 0, 80) // destinationTransportPort
+
+	data := append([]byte{}, record...)
+	data = append(data, record...)
+
+	tmpl := &TemplateRecords{
+		Header: &TemplateRecordHeader{
+			TemplateID: 256,
+		},
+		Records: []*TemplateRecord{
+			{Type: IPv4SrcAddr, Length: 4},
+			{Type: IfName, Length: VariableLength},
+			{Type: ApplicationDescription, Length: VariableLength},
+			{Type: L4DstPort, Length: 2},
+		},
+	}
+
+	set := Set{
+		Header: &SetHeader{
+			SetID: 256,
+		},
+		Records: convert.Reverse(data),
+	}
+
+	records := tmpl.DecodeFlowSet(set)
+	if !assert.Equal(t, 2, len(records)) {
+		return
+	}
+
+	for _, r := range records {
+		assert.Equal(t, []byte{1, 0, 0, 10}, r.Values[0])
+		assert.Equal(t, "eth0", string(convert.Reverse(r.Values[1])))
+		assert.Equal(t, long, r.Values[2])
+		assert.Equal(t, uint16(80), convert.Uint16(r.Values[3]))
+	}
+}
+
+func TestDecodeFlowSetVariableLengthTruncated(t *testing.T) {
+	tmpl := &TemplateRecords{
+		Header: &TemplateRecordHeader{
+			TemplateID: 256,
+		},
+		Records: []*TemplateRecord{
+			{Type: IPv4SrcAddr, Length: 4},
+			{Type: IfName, Length: VariableLength},
+		},
+	}
+
+	set := Set{
+		Header: &SetHeader{
+			SetID: 256,
+		},
+		Records: convert.Reverse([]byte{10, 0, 0, 1, 20, 'e', 't', 'h', '0'}),
+	}
+
+	assert.Equal(t, 0, len(tmpl.DecodeFlowSet(set)))
+}
@@ -0,0 +1,33 @@
+package netflow
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Application returns the name of the application of the flow or, if the name is unknown, its formatted application ID
+func (fl *Flow) Application() string {
+	if fl.ApplicationName != "" {
+		return fl.ApplicationName
+	}
+	return FormatApplicationID(fl.ApplicationId)
+}
+
+// FormatApplicationID formats application ID `id` (RFC 6759) as <classification engine ID>:<selector ID>.
+// Selector IDs longer than 8 bytes are formatted hex encoded.
+func FormatApplicationID(id []byte) string {
+	if len(id) == 0 {
+		return ""
+	}
+
+	selector := id[1:]
+	if len(selector) > 8 {
+		return fmt.Sprintf("%d:%s", id[0], hex.EncodeToString(selector))
+	}
+
+	var v uint64
+	for _, b := range selector {
+		v = v<<8 | uint64(b)
+	}
+	return fmt.Sprintf("%d:%d", id[0], v)
+}
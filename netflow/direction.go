@@ -0,0 +1,21 @@
+package netflow
+
+// Values of Flow.Direction as defined for NetFlow v9 and IPFIX field 61 (flowDirection)
+const (
+	DirectionIngress = 0
+	DirectionEgress  = 1
+)
+
+// Egress checks if the flow has been observed on egress
+func (fl *Flow) Egress() bool {
+	return fl.Direction == DirectionEgress
+}
+
+// ObservationInterface returns the interface the flow has been observed on:
+// the input interface of ingress flows and the output interface of egress flows
+func (fl *Flow) ObservationInterface() uint32 {
+	if fl.Egress() {
+		return fl.IntOut
+	}
+	return fl.IntIn
+}
@@ -1,28 +1,16 @@
-// Code generated by protoc-gen-go.
+// Code generated by protoc-gen-go. DO NOT EDIT.
 // source: netflow.proto
-// DO NOT EDIT!
 
-/*
-Package netflow is a generated protocol buffer package.
-
-It is generated from these files:
-	netflow.proto
-
-It has these top-level messages:
-	Pfx
-	Flow
-	Intf
-	Flows
-*/
 package netflow
 
-import proto "github.com/golang/protobuf/proto"
-import fmt "fmt"
-import math "math"
-
 import (
-	context "golang.org/x/net/context"
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
 	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
 )
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -34,20 +22,43 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
 // Pfx defines an IP prefix
 type Pfx struct {
 	// IPv4 or IPv6 address
 	IP []byte `protobuf:"bytes,1,opt,name=IP,proto3" json:"IP,omitempty"`
 	// Netmask
-	Mask []byte `protobuf:"bytes,2,opt,name=mask,proto3" json:"mask,omitempty"`
+	Mask                 []byte   `protobuf:"bytes,2,opt,name=mask,proto3" json:"mask,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Pfx) Reset()         { *m = Pfx{} }
+func (m *Pfx) String() string { return proto.CompactTextString(m) }
+func (*Pfx) ProtoMessage()    {}
+func (*Pfx) Descriptor() ([]byte, []int) {
+	return fileDescriptor_742a417cd49626a2, []int{0}
+}
+
+func (m *Pfx) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Pfx.Unmarshal(m, b)
+}
+func (m *Pfx) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Pfx.Marshal(b, m, deterministic)
+}
+func (m *Pfx) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Pfx.Merge(m, src)
+}
+func (m *Pfx) XXX_Size() int {
+	return xxx_messageInfo_Pfx.Size(m)
+}
+func (m *Pfx) XXX_DiscardUnknown() {
+	xxx_messageInfo_Pfx.DiscardUnknown(m)
 }
 
-func (m *Pfx) Reset()                    { *m = Pfx{} }
-func (m *Pfx) String() string            { return proto.CompactTextString(m) }
-func (*Pfx) ProtoMessage()               {}
-func (*Pfx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+var xxx_messageInfo_Pfx proto.InternalMessageInfo
 
 func (m *Pfx) GetIP() []byte {
 	if m != nil {
@@ -63,52 +74,263 @@ func (m *Pfx) GetMask() []byte {
 	return nil
 }
 
+// Tuple defines the addresses, protocol and ports of an IP packet
+type Tuple struct {
+	// Address family
+	Family uint32 `protobuf:"varint,1,opt,name=family,proto3" json:"family,omitempty"`
+	// SRC IP address
+	SrcAddr []byte `protobuf:"bytes,2,opt,name=src_addr,json=srcAddr,proto3" json:"src_addr,omitempty"`
+	// DST IP address
+	DstAddr []byte `protobuf:"bytes,3,opt,name=dst_addr,json=dstAddr,proto3" json:"dst_addr,omitempty"`
+	// Protocol
+	Protocol uint32 `protobuf:"varint,4,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	// SRC port
+	SrcPort uint32 `protobuf:"varint,5,opt,name=src_port,json=srcPort,proto3" json:"src_port,omitempty"`
+	// DST port
+	DstPort uint32 `protobuf:"varint,6,opt,name=dst_port,json=dstPort,proto3" json:"dst_port,omitempty"`
+	// TCP flags
+	TcpFlags uint32 `protobuf:"varint,7,opt,name=tcp_flags,json=tcpFlags,proto3" json:"tcp_flags,omitempty"`
+	// Type of service (IPv4) or traffic class (IPv6)
+	Tos uint32 `protobuf:"varint,8,opt,name=tos,proto3" json:"tos,omitempty"`
+	// ICMP type
+	IcmpType uint32 `protobuf:"varint,9,opt,name=icmp_type,json=icmpType,proto3" json:"icmp_type,omitempty"`
+	// ICMP code
+	IcmpCode             uint32   `protobuf:"varint,10,opt,name=icmp_code,json=icmpCode,proto3" json:"icmp_code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Tuple) Reset()         { *m = Tuple{} }
+func (m *Tuple) String() string { return proto.CompactTextString(m) }
+func (*Tuple) ProtoMessage()    {}
+func (*Tuple) Descriptor() ([]byte, []int) {
+	return fileDescriptor_742a417cd49626a2, []int{1}
+}
+
+func (m *Tuple) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Tuple.Unmarshal(m, b)
+}
+func (m *Tuple) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Tuple.Marshal(b, m, deterministic)
+}
+func (m *Tuple) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Tuple.Merge(m, src)
+}
+func (m *Tuple) XXX_Size() int {
+	return xxx_messageInfo_Tuple.Size(m)
+}
+func (m *Tuple) XXX_DiscardUnknown() {
+	xxx_messageInfo_Tuple.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Tuple proto.InternalMessageInfo
+
+func (m *Tuple) GetFamily() uint32 {
+	if m != nil {
+		return m.Family
+	}
+	return 0
+}
+
+func (m *Tuple) GetSrcAddr() []byte {
+	if m != nil {
+		return m.SrcAddr
+	}
+	return nil
+}
+
+func (m *Tuple) GetDstAddr() []byte {
+	if m != nil {
+		return m.DstAddr
+	}
+	return nil
+}
+
+func (m *Tuple) GetProtocol() uint32 {
+	if m != nil {
+		return m.Protocol
+	}
+	return 0
+}
+
+func (m *Tuple) GetSrcPort() uint32 {
+	if m != nil {
+		return m.SrcPort
+	}
+	return 0
+}
+
+func (m *Tuple) GetDstPort() uint32 {
+	if m != nil {
+		return m.DstPort
+	}
+	return 0
+}
+
+func (m *Tuple) GetTcpFlags() uint32 {
+	if m != nil {
+		return m.TcpFlags
+	}
+	return 0
+}
+
+func (m *Tuple) GetTos() uint32 {
+	if m != nil {
+		return m.Tos
+	}
+	return 0
+}
+
+func (m *Tuple) GetIcmpType() uint32 {
+	if m != nil {
+		return m.IcmpType
+	}
+	return 0
+}
+
+func (m *Tuple) GetIcmpCode() uint32 {
+	if m != nil {
+		return m.IcmpCode
+	}
+	return 0
+}
+
 // Flow defines a network flow
 type Flow struct {
 	// Router flow was received from
 	Router []byte `protobuf:"bytes,1,opt,name=router,proto3" json:"router,omitempty"`
 	// Address family
-	Family uint32 `protobuf:"varint,2,opt,name=family" json:"family,omitempty"`
+	Family uint32 `protobuf:"varint,2,opt,name=family,proto3" json:"family,omitempty"`
 	// SRC IP address
 	SrcAddr []byte `protobuf:"bytes,3,opt,name=src_addr,json=srcAddr,proto3" json:"src_addr,omitempty"`
 	// DST IP address
 	DstAddr []byte `protobuf:"bytes,4,opt,name=dst_addr,json=dstAddr,proto3" json:"dst_addr,omitempty"`
 	// Protocol
-	Protocol uint32 `protobuf:"varint,5,opt,name=protocol" json:"protocol,omitempty"`
+	Protocol uint32 `protobuf:"varint,5,opt,name=protocol,proto3" json:"protocol,omitempty"`
 	// Number of packets
-	Packets uint32 `protobuf:"varint,6,opt,name=packets" json:"packets,omitempty"`
+	Packets uint64 `protobuf:"varint,6,opt,name=packets,proto3" json:"packets,omitempty"`
 	// Size of flow
-	Size uint64 `protobuf:"varint,7,opt,name=size" json:"size,omitempty"`
+	Size uint64 `protobuf:"varint,7,opt,name=size,proto3" json:"size,omitempty"`
 	// SNMP interface id flow was received on
-	IntIn uint32 `protobuf:"varint,8,opt,name=int_in,json=intIn" json:"int_in,omitempty"`
+	IntIn uint32 `protobuf:"varint,8,opt,name=int_in,json=intIn,proto3" json:"int_in,omitempty"`
 	// SNMP interface if flow was transmitted on
-	IntOut uint32 `protobuf:"varint,9,opt,name=int_out,json=intOut" json:"int_out,omitempty"`
+	IntOut uint32 `protobuf:"varint,9,opt,name=int_out,json=intOut,proto3" json:"int_out,omitempty"`
 	// Next Hop IP address
 	NextHop []byte `protobuf:"bytes,10,opt,name=next_hop,json=nextHop,proto3" json:"next_hop,omitempty"`
 	// SRC ASN
-	SrcAs uint32 `protobuf:"varint,11,opt,name=src_as,json=srcAs" json:"src_as,omitempty"`
+	SrcAs uint32 `protobuf:"varint,11,opt,name=src_as,json=srcAs,proto3" json:"src_as,omitempty"`
 	// DST ASN
-	DstAs uint32 `protobuf:"varint,12,opt,name=dst_as,json=dstAs" json:"dst_as,omitempty"`
+	DstAs uint32 `protobuf:"varint,12,opt,name=dst_as,json=dstAs,proto3" json:"dst_as,omitempty"`
 	// NEXT HOP ASN
-	NextHopAs uint32 `protobuf:"varint,13,opt,name=next_hop_as,json=nextHopAs" json:"next_hop_as,omitempty"`
+	NextHopAs uint32 `protobuf:"varint,13,opt,name=next_hop_as,json=nextHopAs,proto3" json:"next_hop_as,omitempty"`
 	// Unix timestamp
-	Timestamp int64 `protobuf:"varint,14,opt,name=timestamp" json:"timestamp,omitempty"`
+	Timestamp int64 `protobuf:"varint,14,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 	// SRC prefix
-	SrcPfx *Pfx `protobuf:"bytes,15,opt,name=src_pfx,json=srcPfx" json:"src_pfx,omitempty"`
+	SrcPfx *Pfx `protobuf:"bytes,15,opt,name=src_pfx,json=srcPfx,proto3" json:"src_pfx,omitempty"`
 	// DST perfix
-	DstPfx *Pfx `protobuf:"bytes,16,opt,name=dst_pfx,json=dstPfx" json:"dst_pfx,omitempty"`
+	DstPfx *Pfx `protobuf:"bytes,16,opt,name=dst_pfx,json=dstPfx,proto3" json:"dst_pfx,omitempty"`
 	// SRC port
-	SrcPort uint32 `protobuf:"varint,17,opt,name=src_port,json=srcPort" json:"src_port,omitempty"`
-	// DST port
-	DstPort uint32 `protobuf:"varint,18,opt,name=dst_port,json=dstPort" json:"dst_port,omitempty"`
-	// Samplerate
-	Samplerate uint64 `protobuf:"varint,19,opt,name=samplerate" json:"samplerate,omitempty"`
-}
-
-func (m *Flow) Reset()                    { *m = Flow{} }
-func (m *Flow) String() string            { return proto.CompactTextString(m) }
-func (*Flow) ProtoMessage()               {}
-func (*Flow) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+	SrcPort uint32 `protobuf:"varint,17,opt,name=src_port,json=srcPort,proto3" json:"src_port,omitempty"`
+	//DST port
+	DstPort uint32 `protobuf:"varint,18,opt,name=dst_port,json=dstPort,proto3" json:"dst_port,omitempty"`
+	//Samplerate
+	Samplerate uint64 `protobuf:"varint,19,opt,name=samplerate,proto3" json:"samplerate,omitempty"`
+	// SRC VLAN
+	SrcVlan uint32 `protobuf:"varint,20,opt,name=src_vlan,json=srcVlan,proto3" json:"src_vlan,omitempty"`
+	// DST VLAN
+	DstVlan uint32 `protobuf:"varint,21,opt,name=dst_vlan,json=dstVlan,proto3" json:"dst_vlan,omitempty"`
+	// SRC 802.1p priority
+	SrcPriority uint32 `protobuf:"varint,22,opt,name=src_priority,json=srcPriority,proto3" json:"src_priority,omitempty"`
+	// DST 802.1p priority
+	DstPriority uint32 `protobuf:"varint,23,opt,name=dst_priority,json=dstPriority,proto3" json:"dst_priority,omitempty"`
+	// BGP next hop IP address
+	BgpNextHop []byte `protobuf:"bytes,24,opt,name=bgp_next_hop,json=bgpNextHop,proto3" json:"bgp_next_hop,omitempty"`
+	// SRC peer ASN
+	SrcPeerAs uint32 `protobuf:"varint,25,opt,name=src_peer_as,json=srcPeerAs,proto3" json:"src_peer_as,omitempty"`
+	// AS path towards the destination
+	AsPath []uint32 `protobuf:"varint,26,rep,packed,name=as_path,json=asPath,proto3" json:"as_path,omitempty"`
+	// BGP communities of the destination route
+	BgpCommunities []uint32 `protobuf:"varint,27,rep,packed,name=bgp_communities,json=bgpCommunities,proto3" json:"bgp_communities,omitempty"`
+	// Outermost IP header of a tunneled packet
+	Outer *Tuple `protobuf:"bytes,28,opt,name=outer,proto3" json:"outer,omitempty"`
+	// Innermost IP header of a tunneled packet
+	Inner *Tuple `protobuf:"bytes,29,opt,name=inner,proto3" json:"inner,omitempty"`
+	// Number of egress bytes
+	OutBytes uint64 `protobuf:"varint,30,opt,name=out_bytes,json=outBytes,proto3" json:"out_bytes,omitempty"`
+	// Number of egress packets
+	OutPkts uint64 `protobuf:"varint,31,opt,name=out_pkts,json=outPkts,proto3" json:"out_pkts,omitempty"`
+	// Unix timestamp (milliseconds) of the first packet of the flow
+	FlowStart uint64 `protobuf:"varint,32,opt,name=flow_start,json=flowStart,proto3" json:"flow_start,omitempty"`
+	// Unix timestamp (milliseconds) of the last packet of the flow
+	FlowEnd uint64 `protobuf:"varint,33,opt,name=flow_end,json=flowEnd,proto3" json:"flow_end,omitempty"`
+	// TCP flags (cumulative over all packets of the flow)
+	TcpFlags uint32 `protobuf:"varint,34,opt,name=tcp_flags,json=tcpFlags,proto3" json:"tcp_flags,omitempty"`
+	// Type of service (IPv4) or traffic class (IPv6)
+	Tos uint32 `protobuf:"varint,35,opt,name=tos,proto3" json:"tos,omitempty"`
+	// ICMP type
+	IcmpType uint32 `protobuf:"varint,36,opt,name=icmp_type,json=icmpType,proto3" json:"icmp_type,omitempty"`
+	// ICMP code
+	IcmpCode uint32 `protobuf:"varint,37,opt,name=icmp_code,json=icmpCode,proto3" json:"icmp_code,omitempty"`
+	// SRC MAC address
+	SrcMac []byte `protobuf:"bytes,38,opt,name=src_mac,json=srcMac,proto3" json:"src_mac,omitempty"`
+	// DST MAC address
+	DstMac []byte `protobuf:"bytes,39,opt,name=dst_mac,json=dstMac,proto3" json:"dst_mac,omitempty"`
+	// Top (outermost) MPLS label
+	MplsLabel1 uint32 `protobuf:"varint,40,opt,name=mpls_label1,json=mplsLabel1,proto3" json:"mpls_label1,omitempty"`
+	// Second MPLS label
+	MplsLabel2 uint32 `protobuf:"varint,41,opt,name=mpls_label2,json=mplsLabel2,proto3" json:"mpls_label2,omitempty"`
+	// Third MPLS label
+	MplsLabel3 uint32 `protobuf:"varint,42,opt,name=mpls_label3,json=mplsLabel3,proto3" json:"mpls_label3,omitempty"`
+	// IP address of the FEC of the top MPLS label
+	MplsTopLabelAddr []byte `protobuf:"bytes,43,opt,name=mpls_top_label_addr,json=mplsTopLabelAddr,proto3" json:"mpls_top_label_addr,omitempty"`
+	// Forwarding status (RFC 7270): status in the two most significant bits, reason code in the others
+	ForwardingStatus uint32 `protobuf:"varint,44,opt,name=forwarding_status,json=forwardingStatus,proto3" json:"forwarding_status,omitempty"`
+	// Direction the flow was observed in (0 = ingress, 1 = egress)
+	Direction uint32 `protobuf:"varint,45,opt,name=direction,proto3" json:"direction,omitempty"`
+	// SRC IP address after NAT
+	PostNatSrcAddr []byte `protobuf:"bytes,46,opt,name=post_nat_src_addr,json=postNatSrcAddr,proto3" json:"post_nat_src_addr,omitempty"`
+	// DST IP address after NAT
+	PostNatDstAddr []byte `protobuf:"bytes,47,opt,name=post_nat_dst_addr,json=postNatDstAddr,proto3" json:"post_nat_dst_addr,omitempty"`
+	// SRC port after NAPT
+	PostNaptSrcPort uint32 `protobuf:"varint,48,opt,name=post_napt_src_port,json=postNaptSrcPort,proto3" json:"post_napt_src_port,omitempty"`
+	// DST port after NAPT
+	PostNaptDstPort uint32 `protobuf:"varint,49,opt,name=post_napt_dst_port,json=postNaptDstPort,proto3" json:"post_napt_dst_port,omitempty"`
+	// NAT event (e.g. session create/delete) a NAT event record was exported for
+	NatEvent uint32 `protobuf:"varint,50,opt,name=nat_event,json=natEvent,proto3" json:"nat_event,omitempty"`
+	// Application ID (RFC 6759): classification engine ID followed by the selector ID
+	ApplicationId []byte `protobuf:"bytes,51,opt,name=application_id,json=applicationId,proto3" json:"application_id,omitempty"`
+	// Name of the application as reported by the exporter
+	ApplicationName      string   `protobuf:"bytes,52,opt,name=application_name,json=applicationName,proto3" json:"application_name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Flow) Reset()         { *m = Flow{} }
+func (m *Flow) String() string { return proto.CompactTextString(m) }
+func (*Flow) ProtoMessage()    {}
+func (*Flow) Descriptor() ([]byte, []int) {
+	return fileDescriptor_742a417cd49626a2, []int{2}
+}
+
+func (m *Flow) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Flow.Unmarshal(m, b)
+}
+func (m *Flow) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Flow.Marshal(b, m, deterministic)
+}
+func (m *Flow) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Flow.Merge(m, src)
+}
+func (m *Flow) XXX_Size() int {
+	return xxx_messageInfo_Flow.Size(m)
+}
+func (m *Flow) XXX_DiscardUnknown() {
+	xxx_messageInfo_Flow.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Flow proto.InternalMessageInfo
 
 func (m *Flow) GetRouter() []byte {
 	if m != nil {
@@ -145,7 +367,7 @@ func (m *Flow) GetProtocol() uint32 {
 	return 0
 }
 
-func (m *Flow) GetPackets() uint32 {
+func (m *Flow) GetPackets() uint64 {
 	if m != nil {
 		return m.Packets
 	}
@@ -243,18 +465,272 @@ func (m *Flow) GetSamplerate() uint64 {
 	return 0
 }
 
+func (m *Flow) GetSrcVlan() uint32 {
+	if m != nil {
+		return m.SrcVlan
+	}
+	return 0
+}
+
+func (m *Flow) GetDstVlan() uint32 {
+	if m != nil {
+		return m.DstVlan
+	}
+	return 0
+}
+
+func (m *Flow) GetSrcPriority() uint32 {
+	if m != nil {
+		return m.SrcPriority
+	}
+	return 0
+}
+
+func (m *Flow) GetDstPriority() uint32 {
+	if m != nil {
+		return m.DstPriority
+	}
+	return 0
+}
+
+func (m *Flow) GetBgpNextHop() []byte {
+	if m != nil {
+		return m.BgpNextHop
+	}
+	return nil
+}
+
+func (m *Flow) GetSrcPeerAs() uint32 {
+	if m != nil {
+		return m.SrcPeerAs
+	}
+	return 0
+}
+
+func (m *Flow) GetAsPath() []uint32 {
+	if m != nil {
+		return m.AsPath
+	}
+	return nil
+}
+
+func (m *Flow) GetBgpCommunities() []uint32 {
+	if m != nil {
+		return m.BgpCommunities
+	}
+	return nil
+}
+
+func (m *Flow) GetOuter() *Tuple {
+	if m != nil {
+		return m.Outer
+	}
+	return nil
+}
+
+func (m *Flow) GetInner() *Tuple {
+	if m != nil {
+		return m.Inner
+	}
+	return nil
+}
+
+func (m *Flow) GetOutBytes() uint64 {
+	if m != nil {
+		return m.OutBytes
+	}
+	return 0
+}
+
+func (m *Flow) GetOutPkts() uint64 {
+	if m != nil {
+		return m.OutPkts
+	}
+	return 0
+}
+
+func (m *Flow) GetFlowStart() uint64 {
+	if m != nil {
+		return m.FlowStart
+	}
+	return 0
+}
+
+func (m *Flow) GetFlowEnd() uint64 {
+	if m != nil {
+		return m.FlowEnd
+	}
+	return 0
+}
+
+func (m *Flow) GetTcpFlags() uint32 {
+	if m != nil {
+		return m.TcpFlags
+	}
+	return 0
+}
+
+func (m *Flow) GetTos() uint32 {
+	if m != nil {
+		return m.Tos
+	}
+	return 0
+}
+
+func (m *Flow) GetIcmpType() uint32 {
+	if m != nil {
+		return m.IcmpType
+	}
+	return 0
+}
+
+func (m *Flow) GetIcmpCode() uint32 {
+	if m != nil {
+		return m.IcmpCode
+	}
+	return 0
+}
+
+func (m *Flow) GetSrcMac() []byte {
+	if m != nil {
+		return m.SrcMac
+	}
+	return nil
+}
+
+func (m *Flow) GetDstMac() []byte {
+	if m != nil {
+		return m.DstMac
+	}
+	return nil
+}
+
+func (m *Flow) GetMplsLabel1() uint32 {
+	if m != nil {
+		return m.MplsLabel1
+	}
+	return 0
+}
+
+func (m *Flow) GetMplsLabel2() uint32 {
+	if m != nil {
+		return m.MplsLabel2
+	}
+	return 0
+}
+
+func (m *Flow) GetMplsLabel3() uint32 {
+	if m != nil {
+		return m.MplsLabel3
+	}
+	return 0
+}
+
+func (m *Flow) GetMplsTopLabelAddr() []byte {
+	if m != nil {
+		return m.MplsTopLabelAddr
+	}
+	return nil
+}
+
+func (m *Flow) GetForwardingStatus() uint32 {
+	if m != nil {
+		return m.ForwardingStatus
+	}
+	return 0
+}
+
+func (m *Flow) GetDirection() uint32 {
+	if m != nil {
+		return m.Direction
+	}
+	return 0
+}
+
+func (m *Flow) GetPostNatSrcAddr() []byte {
+	if m != nil {
+		return m.PostNatSrcAddr
+	}
+	return nil
+}
+
+func (m *Flow) GetPostNatDstAddr() []byte {
+	if m != nil {
+		return m.PostNatDstAddr
+	}
+	return nil
+}
+
+func (m *Flow) GetPostNaptSrcPort() uint32 {
+	if m != nil {
+		return m.PostNaptSrcPort
+	}
+	return 0
+}
+
+func (m *Flow) GetPostNaptDstPort() uint32 {
+	if m != nil {
+		return m.PostNaptDstPort
+	}
+	return 0
+}
+
+func (m *Flow) GetNatEvent() uint32 {
+	if m != nil {
+		return m.NatEvent
+	}
+	return 0
+}
+
+func (m *Flow) GetApplicationId() []byte {
+	if m != nil {
+		return m.ApplicationId
+	}
+	return nil
+}
+
+func (m *Flow) GetApplicationName() string {
+	if m != nil {
+		return m.ApplicationName
+	}
+	return ""
+}
+
 // Intf groups an interfaces ID and name
 type Intf struct {
 	// ID is an interface ID
-	Id uint32 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Id uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
 	// name is an interfaces name
-	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *Intf) Reset()                    { *m = Intf{} }
-func (m *Intf) String() string            { return proto.CompactTextString(m) }
-func (*Intf) ProtoMessage()               {}
-func (*Intf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (m *Intf) Reset()         { *m = Intf{} }
+func (m *Intf) String() string { return proto.CompactTextString(m) }
+func (*Intf) ProtoMessage()    {}
+func (*Intf) Descriptor() ([]byte, []int) {
+	return fileDescriptor_742a417cd49626a2, []int{3}
+}
+
+func (m *Intf) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Intf.Unmarshal(m, b)
+}
+func (m *Intf) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Intf.Marshal(b, m, deterministic)
+}
+func (m *Intf) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Intf.Merge(m, src)
+}
+func (m *Intf) XXX_Size() int {
+	return xxx_messageInfo_Intf.Size(m)
+}
+func (m *Intf) XXX_DiscardUnknown() {
+	xxx_messageInfo_Intf.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Intf proto.InternalMessageInfo
 
 func (m *Intf) GetId() uint32 {
 	if m != nil {
@@ -273,15 +749,38 @@ func (m *Intf) GetName() string {
 // Flows defines a groups of flows
 type Flows struct {
 	// Group of flows
-	Flows []*Flow `protobuf:"bytes,1,rep,name=flows" json:"flows,omitempty"`
+	Flows []*Flow `protobuf:"bytes,1,rep,name=flows,proto3" json:"flows,omitempty"`
 	// Mapping of interface names to IDs
-	InterfaceMapping []*Intf `protobuf:"bytes,2,rep,name=interface_mapping,json=interfaceMapping" json:"interface_mapping,omitempty"`
+	InterfaceMapping     []*Intf  `protobuf:"bytes,2,rep,name=interface_mapping,json=interfaceMapping,proto3" json:"interface_mapping,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Flows) Reset()         { *m = Flows{} }
+func (m *Flows) String() string { return proto.CompactTextString(m) }
+func (*Flows) ProtoMessage()    {}
+func (*Flows) Descriptor() ([]byte, []int) {
+	return fileDescriptor_742a417cd49626a2, []int{4}
 }
 
-func (m *Flows) Reset()                    { *m = Flows{} }
-func (m *Flows) String() string            { return proto.CompactTextString(m) }
-func (*Flows) ProtoMessage()               {}
-func (*Flows) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (m *Flows) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Flows.Unmarshal(m, b)
+}
+func (m *Flows) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Flows.Marshal(b, m, deterministic)
+}
+func (m *Flows) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Flows.Merge(m, src)
+}
+func (m *Flows) XXX_Size() int {
+	return xxx_messageInfo_Flows.Size(m)
+}
+func (m *Flows) XXX_DiscardUnknown() {
+	xxx_messageInfo_Flows.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Flows proto.InternalMessageInfo
 
 func (m *Flows) GetFlows() []*Flow {
 	if m != nil {
@@ -299,11 +798,83 @@ func (m *Flows) GetInterfaceMapping() []*Intf {
 
 func init() {
 	proto.RegisterType((*Pfx)(nil), "netflow.pfx")
+	proto.RegisterType((*Tuple)(nil), "netflow.tuple")
 	proto.RegisterType((*Flow)(nil), "netflow.Flow")
 	proto.RegisterType((*Intf)(nil), "netflow.Intf")
 	proto.RegisterType((*Flows)(nil), "netflow.Flows")
 }
 
+func init() { proto.RegisterFile("netflow.proto", fileDescriptor_742a417cd49626a2) }
+
+var fileDescriptor_742a417cd49626a2 = []byte{
+	// 1025 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x55, 0xdd, 0x6e, 0x1b, 0x37,
+	0x13, 0xfd, 0xf4, 0x67, 0x59, 0x94, 0x2c, 0xcb, 0xcc, 0x97, 0x84, 0xf9, 0x73, 0x14, 0x25, 0x6e,
+	0x64, 0xbb, 0x71, 0x1b, 0xb9, 0x40, 0x81, 0xde, 0xb9, 0xf9, 0x41, 0x0d, 0x34, 0xae, 0x20, 0x07,
+	0xbd, 0x5d, 0x50, 0xbb, 0x5c, 0x79, 0xe1, 0x5d, 0x92, 0x58, 0x8e, 0x62, 0xb9, 0x4f, 0xd1, 0xa7,
+	0xec, 0x73, 0x14, 0x33, 0x5c, 0xad, 0x25, 0xc3, 0xee, 0x1d, 0x67, 0xce, 0xe1, 0x21, 0x79, 0x38,
+	0x1c, 0xb2, 0x2d, 0xad, 0x20, 0x4e, 0xcd, 0xd5, 0x91, 0xcd, 0x0d, 0x18, 0xde, 0x2c, 0xc2, 0xc1,
+	0x3e, 0xab, 0xd9, 0x78, 0xc1, 0xbb, 0xac, 0x7a, 0x3a, 0x16, 0x95, 0x7e, 0x65, 0xd8, 0x99, 0x54,
+	0x4f, 0xc7, 0x9c, 0xb3, 0x7a, 0x26, 0xdd, 0xa5, 0xa8, 0x52, 0x86, 0xc6, 0x83, 0xbf, 0xab, 0xac,
+	0x01, 0x73, 0x9b, 0x2a, 0xfe, 0x88, 0x6d, 0xc4, 0x32, 0x4b, 0xd2, 0x6b, 0x9a, 0xb1, 0x35, 0x29,
+	0x22, 0xfe, 0x84, 0x6d, 0xba, 0x3c, 0x0c, 0x64, 0x14, 0xe5, 0xc5, 0xcc, 0xa6, 0xcb, 0xc3, 0x93,
+	0x28, 0xca, 0x11, 0x8a, 0x1c, 0x78, 0xa8, 0xe6, 0xa1, 0xc8, 0x01, 0x41, 0x4f, 0xd9, 0x26, 0x6d,
+	0x2a, 0x34, 0xa9, 0xa8, 0x93, 0x5e, 0x19, 0x2f, 0x15, 0xad, 0xc9, 0x41, 0x34, 0x08, 0x43, 0xc5,
+	0xb1, 0xc9, 0x61, 0xa9, 0x48, 0xd0, 0x86, 0x87, 0x22, 0x07, 0x04, 0x3d, 0x63, 0x2d, 0x08, 0x6d,
+	0x10, 0xa7, 0x72, 0xe6, 0x44, 0xd3, 0x4b, 0x42, 0x68, 0x3f, 0x63, 0xcc, 0x7b, 0xac, 0x06, 0xc6,
+	0x89, 0x4d, 0x4a, 0xe3, 0x10, 0xe9, 0x49, 0x98, 0xd9, 0x00, 0xae, 0xad, 0x12, 0x2d, 0x4f, 0xc7,
+	0xc4, 0xd7, 0x6b, 0xab, 0x4a, 0x30, 0x34, 0x91, 0x12, 0xec, 0x06, 0xfc, 0x60, 0x22, 0x35, 0xf8,
+	0xa7, 0xc3, 0xea, 0x9f, 0x53, 0x73, 0x85, 0x8e, 0xe4, 0x66, 0x0e, 0x2a, 0x2f, 0x3c, 0x2c, 0xa2,
+	0x15, 0xa7, 0xaa, 0xf7, 0x3a, 0x55, 0xbb, 0xdf, 0xa9, 0xfa, 0xfd, 0x4e, 0x35, 0x6e, 0x39, 0x25,
+	0x58, 0xd3, 0xca, 0xf0, 0x52, 0x81, 0x23, 0x37, 0xea, 0x93, 0x65, 0x88, 0x77, 0xe9, 0x92, 0xbf,
+	0x14, 0x19, 0x51, 0x9f, 0xd0, 0x98, 0x3f, 0x64, 0x1b, 0x89, 0x86, 0x20, 0xd1, 0x85, 0x0f, 0x8d,
+	0x44, 0xc3, 0xa9, 0xe6, 0x8f, 0x59, 0x13, 0xd3, 0x66, 0x0e, 0x85, 0x0f, 0xc8, 0xfa, 0x63, 0x4e,
+	0x66, 0x6b, 0xb5, 0x80, 0xe0, 0xc2, 0x58, 0x32, 0xa1, 0x33, 0x69, 0x62, 0xfc, 0x9b, 0xb1, 0x28,
+	0x45, 0x47, 0x71, 0xa2, 0xed, 0xa5, 0xf0, 0x20, 0x0e, 0xd3, 0x74, 0x0c, 0x27, 0x3a, 0x3e, 0x8d,
+	0x87, 0x70, 0x7c, 0x97, 0xb5, 0x97, 0x42, 0x88, 0x6d, 0x11, 0xd6, 0x2a, 0xb4, 0x4e, 0x1c, 0x7f,
+	0xce, 0x5a, 0x90, 0x64, 0xca, 0x81, 0xcc, 0xac, 0xe8, 0xf6, 0x2b, 0xc3, 0xda, 0xe4, 0x26, 0xc1,
+	0xf7, 0x58, 0x93, 0xca, 0x21, 0x5e, 0x88, 0xed, 0x7e, 0x65, 0xd8, 0x1e, 0x75, 0x8e, 0xca, 0xba,
+	0x8e, 0x17, 0x13, 0xdc, 0xc8, 0x38, 0x5e, 0x20, 0x8d, 0x4a, 0x23, 0x5e, 0x88, 0xde, 0x5d, 0x34,
+	0xac, 0x93, 0x78, 0xb1, 0x56, 0x5c, 0x3b, 0xf7, 0x17, 0x17, 0x5f, 0x2f, 0xae, 0x5d, 0xc6, 0x9c,
+	0xcc, 0x6c, 0xaa, 0x72, 0x09, 0x4a, 0x3c, 0x20, 0x53, 0x57, 0x32, 0x4b, 0xd5, 0x6f, 0xa9, 0xd4,
+	0xe2, 0xff, 0xa5, 0xea, 0x9f, 0xa9, 0xd4, 0x4b, 0x55, 0x82, 0x1e, 0x96, 0xaa, 0x04, 0xbd, 0x62,
+	0x1d, 0xda, 0x4b, 0x9e, 0x98, 0x3c, 0x81, 0x6b, 0xf1, 0x88, 0xe0, 0x36, 0xee, 0xa7, 0x48, 0x21,
+	0x85, 0xf6, 0xb4, 0xa4, 0x3c, 0xf6, 0x14, 0xdc, 0xd7, 0x92, 0xd2, 0x67, 0x9d, 0xe9, 0xcc, 0x06,
+	0xe5, 0x55, 0x09, 0xba, 0x2a, 0x36, 0x9d, 0xd9, 0xb3, 0xe2, 0xb6, 0x76, 0x59, 0x9b, 0xd6, 0x51,
+	0x2a, 0x47, 0xff, 0x9f, 0x78, 0xff, 0x71, 0x19, 0xa5, 0xf2, 0x13, 0x87, 0x15, 0x20, 0x5d, 0x60,
+	0x25, 0x5c, 0x88, 0xa7, 0xfd, 0x1a, 0x56, 0x80, 0x74, 0x63, 0x09, 0x17, 0xfc, 0x2d, 0xdb, 0x46,
+	0xe9, 0xd0, 0x64, 0xd9, 0x5c, 0x27, 0x90, 0x28, 0x27, 0x9e, 0x11, 0xa1, 0x3b, 0x9d, 0xd9, 0x0f,
+	0x37, 0x59, 0xfe, 0x86, 0x35, 0xfc, 0x4b, 0x78, 0x4e, 0xd6, 0x77, 0x4b, 0xeb, 0xa9, 0x77, 0x4c,
+	0x3c, 0x88, 0xac, 0x44, 0x6b, 0x95, 0x8b, 0x17, 0x77, 0xb3, 0x08, 0xc4, 0xc7, 0x67, 0xe6, 0x10,
+	0x4c, 0xaf, 0x41, 0x39, 0xb1, 0x4b, 0x56, 0x6f, 0x9a, 0x39, 0xfc, 0x8a, 0x31, 0xba, 0x89, 0xa0,
+	0xbd, 0x04, 0x27, 0x5e, 0xfa, 0x92, 0x37, 0x73, 0x18, 0x5f, 0x82, 0xe3, 0x2f, 0x18, 0x43, 0xb1,
+	0xc0, 0x81, 0xcc, 0x41, 0xf4, 0x09, 0x6c, 0x61, 0xe6, 0x1c, 0x13, 0x38, 0x93, 0x60, 0xa5, 0x23,
+	0xf1, 0xca, 0xcf, 0xc4, 0xf8, 0x93, 0x8e, 0xd6, 0x5b, 0xc7, 0xe0, 0xee, 0xd6, 0xf1, 0xfa, 0x9e,
+	0xd6, 0xf1, 0xe6, 0xbf, 0x5a, 0xc7, 0xde, 0x7a, 0xeb, 0x40, 0xa3, 0xf1, 0x22, 0x32, 0x19, 0x8a,
+	0xef, 0x7c, 0xcb, 0x70, 0x79, 0xf8, 0x45, 0x86, 0x08, 0xe0, 0x35, 0x23, 0xf0, 0xd6, 0x03, 0x91,
+	0x03, 0x04, 0x5e, 0xb2, 0x76, 0x66, 0x53, 0x17, 0xa4, 0x72, 0xaa, 0xd2, 0xf7, 0x62, 0x48, 0x82,
+	0x0c, 0x53, 0xbf, 0x53, 0x66, 0x9d, 0x30, 0x12, 0xfb, 0xb7, 0x08, 0xa3, 0x75, 0xc2, 0xb1, 0x38,
+	0xb8, 0x45, 0x38, 0xe6, 0xef, 0xd8, 0x03, 0x22, 0x80, 0xb1, 0x9e, 0xe4, 0xdb, 0xd0, 0x21, 0xed,
+	0xa3, 0x87, 0xd0, 0x57, 0x63, 0x89, 0x4b, 0xfd, 0xe8, 0x90, 0xed, 0xc4, 0x26, 0xbf, 0x92, 0x79,
+	0x94, 0xe8, 0x19, 0x9a, 0x0d, 0x73, 0x27, 0xbe, 0x27, 0xd5, 0xde, 0x0d, 0x70, 0x4e, 0x79, 0x7c,
+	0xd9, 0x51, 0x92, 0xab, 0x10, 0x12, 0xa3, 0xc5, 0x3b, 0x5f, 0x77, 0x65, 0x82, 0xef, 0xb3, 0x1d,
+	0x6b, 0x1c, 0x04, 0x5a, 0x42, 0x50, 0x76, 0xc6, 0x23, 0x5a, 0xb7, 0x8b, 0xc0, 0x99, 0x84, 0xf3,
+	0xa2, 0x41, 0xae, 0x52, 0xcb, 0x4e, 0xf9, 0xc3, 0x1a, 0xf5, 0x63, 0xd1, 0x30, 0x0f, 0x19, 0x2f,
+	0xa8, 0xd6, 0xcb, 0xd2, 0x83, 0xfe, 0x91, 0x16, 0xdf, 0xf6, 0x5c, 0x8b, 0xba, 0xf4, 0xb0, 0xd7,
+	0xc8, 0xe5, 0xeb, 0x7f, 0xbf, 0x4e, 0xfe, 0x78, 0xf3, 0xc5, 0xe0, 0xfa, 0xea, 0x9b, 0xd2, 0x20,
+	0x46, 0xfe, 0x6e, 0xb5, 0x84, 0x4f, 0x18, 0xf3, 0x3d, 0xd6, 0x95, 0xd6, 0xa6, 0x49, 0x28, 0xf1,
+	0x6c, 0x41, 0x12, 0x89, 0x63, 0xda, 0xde, 0xd6, 0x4a, 0xf6, 0x34, 0xe2, 0xfb, 0xac, 0xb7, 0x4a,
+	0xd3, 0x32, 0x53, 0xe2, 0xa7, 0x7e, 0x65, 0xd8, 0x9a, 0x6c, 0xaf, 0xe4, 0xcf, 0x64, 0xa6, 0x06,
+	0x07, 0xac, 0x7e, 0xaa, 0x21, 0xc6, 0x7f, 0x3a, 0x89, 0x8a, 0x5f, 0xb7, 0x9a, 0x44, 0xd8, 0xdb,
+	0x69, 0x5a, 0x95, 0xa6, 0xd1, 0x78, 0x70, 0xc1, 0x1a, 0xf8, 0x27, 0x39, 0xfe, 0x9a, 0x35, 0xb0,
+	0xac, 0x9d, 0xa8, 0xf4, 0x6b, 0xc3, 0xf6, 0x68, 0xab, 0x7c, 0x63, 0x08, 0x4f, 0x3c, 0xc6, 0x7f,
+	0x61, 0x3b, 0x89, 0x06, 0x95, 0xc7, 0x32, 0x54, 0x41, 0x26, 0xad, 0x4d, 0xf4, 0x4c, 0x54, 0x6f,
+	0x4d, 0xc0, 0xb5, 0x27, 0xbd, 0x92, 0xf7, 0xc5, 0xd3, 0x46, 0x3f, 0xb3, 0x96, 0xd4, 0xda, 0x80,
+	0x04, 0x93, 0xf3, 0x03, 0xb6, 0x79, 0xe2, 0x03, 0xc5, 0xd7, 0x97, 0x7a, 0xba, 0x1e, 0x0e, 0xfe,
+	0x37, 0xdd, 0xa0, 0x6f, 0xeb, 0xf8, 0xdf, 0x01, 0x00, 0x6b, 0x2f, 0x22, 0x50, 0x96, 0x08, 0x00,
+	0x00,
+}
+
 // Reference imports to suppress errors if they are not otherwise used.
 var _ context.Context
 var _ grpc.ClientConn
@@ -312,8 +883,9 @@ var _ grpc.ClientConn
 // is compatible with the grpc package it is being compiled against.
 const _ = grpc.SupportPackageIsVersion4
 
-// Client API for Annotator service
-
+// AnnotatorClient is the client API for Annotator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type AnnotatorClient interface {
 	Annotate(ctx context.Context, in *Flow, opts ...grpc.CallOption) (*Flow, error)
 }
@@ -328,19 +900,26 @@ func NewAnnotatorClient(cc *grpc.ClientConn) AnnotatorClient {
 
 func (c *annotatorClient) Annotate(ctx context.Context, in *Flow, opts ...grpc.CallOption) (*Flow, error) {
 	out := new(Flow)
-	err := grpc.Invoke(ctx, "/netflow.annotator/Annotate", in, out, c.cc, opts...)
+	err := c.cc.Invoke(ctx, "/netflow.annotator/Annotate", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// Server API for Annotator service
-
+// AnnotatorServer is the server API for Annotator service.
 type AnnotatorServer interface {
 	Annotate(context.Context, *Flow) (*Flow, error)
 }
 
+// UnimplementedAnnotatorServer can be embedded to have forward compatible implementations.
+type UnimplementedAnnotatorServer struct {
+}
+
+func (*UnimplementedAnnotatorServer) Annotate(ctx context.Context, req *Flow) (*Flow, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Annotate not implemented")
+}
+
 func RegisterAnnotatorServer(s *grpc.Server, srv AnnotatorServer) {
 	s.RegisterService(&_Annotator_serviceDesc, srv)
 }
@@ -375,39 +954,3 @@ var _Annotator_serviceDesc = grpc.ServiceDesc{
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "netflow.proto",
 }
-
-func init() { proto.RegisterFile("netflow.proto", fileDescriptor0) }
-
-var fileDescriptor0 = []byte{
-	// 476 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x52, 0xcd, 0x8e, 0xd3, 0x30,
-	0x10, 0x26, 0x6d, 0xfa, 0x37, 0xdd, 0x2e, 0xbb, 0x46, 0x80, 0x59, 0xa1, 0x55, 0x15, 0x84, 0x14,
-	0xf6, 0xb0, 0x87, 0x72, 0x40, 0xe2, 0xd6, 0x0b, 0xa2, 0x07, 0x44, 0x95, 0x17, 0x88, 0x4c, 0xe2,
-	0xb0, 0xd6, 0x26, 0xb6, 0x65, 0x4f, 0xb5, 0x81, 0xb7, 0xe0, 0x8d, 0xd1, 0xd8, 0x69, 0x61, 0x11,
-	0x37, 0x7f, 0x3f, 0x33, 0xfe, 0xec, 0x19, 0x58, 0x69, 0x89, 0x4d, 0x6b, 0x1e, 0x6e, 0xad, 0x33,
-	0x68, 0xd8, 0x6c, 0x80, 0xd9, 0x3b, 0x18, 0xdb, 0xa6, 0x67, 0xe7, 0x30, 0xda, 0xed, 0x79, 0xb2,
-	0x4e, 0xf2, 0xb3, 0x62, 0xb4, 0xdb, 0x33, 0x06, 0x69, 0x27, 0xfc, 0x3d, 0x1f, 0x05, 0x26, 0x9c,
-	0xb3, 0x5f, 0x29, 0xa4, 0x9f, 0x5a, 0xf3, 0xc0, 0x5e, 0xc0, 0xd4, 0x99, 0x03, 0x4a, 0x37, 0x14,
-	0x0c, 0x88, 0xf8, 0x46, 0x74, 0xaa, 0xfd, 0x11, 0xca, 0x56, 0xc5, 0x80, 0xd8, 0x2b, 0x98, 0x7b,
-	0x57, 0x95, 0xa2, 0xae, 0x1d, 0x1f, 0x87, 0x8a, 0x99, 0x77, 0xd5, 0xb6, 0xae, 0x1d, 0x49, 0xb5,
-	0xc7, 0x28, 0xa5, 0x51, 0xaa, 0x3d, 0x06, 0xe9, 0x0a, 0xe6, 0x21, 0x6b, 0x65, 0x5a, 0x3e, 0x09,
-	0xfd, 0x4e, 0x98, 0x71, 0x98, 0x59, 0x51, 0xdd, 0x4b, 0xf4, 0x7c, 0x1a, 0xa4, 0x23, 0xa4, 0xe0,
-	0x5e, 0xfd, 0x94, 0x7c, 0xb6, 0x4e, 0xf2, 0xb4, 0x08, 0x67, 0xf6, 0x1c, 0xa6, 0x4a, 0x63, 0xa9,
-	0x34, 0x9f, 0x07, 0xf3, 0x44, 0x69, 0xdc, 0x69, 0xf6, 0x12, 0x66, 0x44, 0x9b, 0x03, 0xf2, 0x45,
-	0xcc, 0xab, 0x34, 0x7e, 0x3d, 0x20, 0x85, 0xd2, 0xb2, 0xc7, 0xf2, 0xce, 0x58, 0x0e, 0x31, 0x14,
-	0xe1, 0xcf, 0xc6, 0x52, 0xab, 0xf0, 0x14, 0xcf, 0x97, 0xb1, 0x15, 0x3d, 0xc4, 0x13, 0x1d, 0x9e,
-	0xe1, 0xf9, 0x59, 0xa4, 0xe9, 0x11, 0x9e, 0x5d, 0xc3, 0xf2, 0xd8, 0x88, 0xb4, 0x55, 0xd0, 0x16,
-	0x43, 0xaf, 0xad, 0x67, 0xaf, 0x61, 0x81, 0xaa, 0x93, 0x1e, 0x45, 0x67, 0xf9, 0xf9, 0x3a, 0xc9,
-	0xc7, 0xc5, 0x1f, 0x82, 0xbd, 0x05, 0xfa, 0xa6, 0xd2, 0x36, 0x3d, 0x7f, 0xba, 0x4e, 0xf2, 0xe5,
-	0xe6, 0xec, 0xf6, 0x34, 0xc4, 0xa6, 0x2f, 0x28, 0xc8, 0xbe, 0xe9, 0xc9, 0x46, 0x77, 0x93, 0xed,
-	0xe2, 0x7f, 0xb6, 0xda, 0x23, 0xd9, 0x86, 0x21, 0x58, 0xe3, 0x90, 0x5f, 0xc6, 0x3f, 0xa3, 0x06,
-	0xc6, 0xe1, 0x71, 0x08, 0x41, 0x62, 0x51, 0xa2, 0x22, 0x92, 0xae, 0x01, 0xbc, 0xe8, 0x6c, 0x2b,
-	0x9d, 0x40, 0xc9, 0x9f, 0x85, 0x4f, 0xfd, 0x8b, 0xc9, 0x6e, 0x20, 0xdd, 0x69, 0x6c, 0x68, 0x7f,
-	0x54, 0x1d, 0xd6, 0x61, 0x55, 0x8c, 0x54, 0x4d, 0x63, 0xd0, 0xa2, 0x93, 0x61, 0x11, 0x16, 0x45,
-	0x38, 0x67, 0x77, 0x30, 0xa1, 0xf5, 0xf1, 0xec, 0x0d, 0x4c, 0x28, 0x9e, 0xe7, 0xc9, 0x7a, 0x9c,
-	0x2f, 0x37, 0xab, 0x53, 0x5e, 0x92, 0x8b, 0xa8, 0xb1, 0x8f, 0x70, 0xa9, 0x34, 0x4a, 0xd7, 0x88,
-	0x4a, 0x96, 0x9d, 0xb0, 0x56, 0xe9, 0xef, 0x7c, 0xf4, 0x4f, 0x01, 0xdd, 0x5d, 0x5c, 0x9c, 0x7c,
-	0x5f, 0xa2, 0x6d, 0xf3, 0x01, 0x16, 0x42, 0x6b, 0x83, 0x02, 0x8d, 0x63, 0x37, 0x30, 0xdf, 0x46,
-	0x20, 0xd9, 0xe3, 0xab, 0xae, 0x1e, 0xc3, 0xec, 0xc9, 0xb7, 0x69, 0xd8, 0xb0, 0xf7, 0xbf, 0x03,
-	0x00, 0x00, 0xff, 0xff, 0x2a, 0x39, 0x13, 0x10, 0x2e, 0x03, 0x00, 0x00,
-}
@@ -0,0 +1,74 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nf5
+
+import (
+	"fmt"
+	"net"
+	"unsafe"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/pkg/errors"
+)
+
+// errorIncompatibleVersion prints an error message in case the detected version is not supported
+func errorIncompatibleVersion(version uint16) error {
+	return errors.Errorf("NF5: Incompatible protocol version v%d, only v5 is supported", version)
+}
+
+// Decode is the main function of this package. It converts raw packet bytes to Packet struct.
+func Decode(raw []byte, remote net.IP) (*Packet, error) {
+	pSize := len(raw)
+	if uintptr(pSize) < sizeOfHeader {
+		return nil, errors.Errorf("NF5: Packet is too short: %d", pSize)
+	}
+
+	// Copy data as the records returned point into the buffer
+	data := make([]byte, pSize)
+	copy(data, raw)
+	data = convert.Reverse(data) //TODO: Make it endian aware. This assumes a little endian machine
+
+	bufferPtr := unsafe.Pointer(&data[0])
+	headerPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(pSize) - sizeOfHeader)
+
+	var packet Packet
+	packet.Buffer = data
+	packet.Header = (*Header)(headerPtr)
+
+	if packet.Header.Version != 5 {
+		return nil, errorIncompatibleVersion(packet.Header.Version)
+	}
+
+	count := uintptr(packet.Header.Count)
+	if sizeOfHeader+count*sizeOfFlowRecord > uintptr(pSize) {
+		return nil, errors.Errorf("NF5: Packet is too short for %d records: %d", count, pSize)
+	}
+
+	packet.Records = make([]*FlowRecord, 0, count)
+	ptr := headerPtr
+	for i := uintptr(0); i < count; i++ {
+		ptr = unsafe.Pointer(uintptr(ptr) - sizeOfFlowRecord)
+		packet.Records = append(packet.Records, (*FlowRecord)(ptr))
+	}
+
+	return &packet, nil
+}
+
+// PrintHeader prints the header of `packet`
+func PrintHeader(p *Packet) {
+	fmt.Printf("Version: %d\n", p.Header.Version)
+	fmt.Printf("Count: %d\n", p.Header.Count)
+	fmt.Printf("SysUpTime: %d\n", p.Header.SysUpTime)
+	fmt.Printf("UnixSecs: %d\n", p.Header.UnixSecs)
+	fmt.Printf("Sequence: %d\n", p.Header.FlowSequence)
+	fmt.Printf("SamplingInterval: %d\n", p.Header.SampleRate())
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nf5
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	s := []byte{
+		0, 5, // Version
+		0, 1, // Count
+		0, 0, 0x12, 0x34, // SysUpTime
+		0x5a, 0x5e, 0x7b, 0x60, // UNIX secs
+		0, 0, 0, 0, // UNIX nsecs
+		0, 0, 0, 42, // Flow Sequence
+		0,          // Engine Type
+		0,          // Engine ID
+		0x40, 0x64, // Sampling Interval (mode 1, interval 100)
+
+		10, 0, 0, 1, // SRC IP
+		192, 168, 0, 1, // DST IP
+		10, 0, 0, 254, // Next-Hop
+		0, 3, // Input interface
+		0, 7, // Output interface
+		0, 0, 0, 5, // Packets
+		0, 0, 5, 220, // Octets
+		0, 0, 0x10, 0, // First
+		0, 0, 0x11, 0, // Last
+		0xd4, 0x31, // SRC port
+		0, 80, // DST port
+		0,      // Pad
+		0x12,   // TCP flags
+		6,      // Protocol
+		0,      // ToS
+		0, 100, // SRC AS
+		0xfd, 0xe8, // DST AS
+		8,    // SRC mask
+		24,   // DST mask
+		0, 0, // Pad
+	}
+
+	p, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	if err != nil {
+		t.Fatalf("Decoding packet failed: %v\n", err)
+	}
+
+	assert := assert.New(t)
+	assert.Equal(uint16(5), p.Header.Version)
+	assert.Equal(uint16(1), p.Header.Count)
+	assert.Equal(uint32(1516141408), p.Header.UnixSecs)
+	assert.Equal(uint32(42), p.Header.FlowSequence)
+	assert.Equal(uint8(1), p.Header.SamplingMode())
+	assert.Equal(uint16(100), p.Header.SampleRate())
+
+	assert.Len(p.Records, 1)
+	r := p.Records[0]
+	assert.Equal("10.0.0.1", net.IP(convert.Reverse(r.SrcAddr[:])).String())
+	assert.Equal("192.168.0.1", net.IP(convert.Reverse(r.DstAddr[:])).String())
+	assert.Equal("10.0.0.254", net.IP(convert.Reverse(r.NextHop[:])).String())
+	assert.Equal(uint16(3), r.Input)
+	assert.Equal(uint16(7), r.Output)
+	assert.Equal(uint32(5), r.DPkts)
+	assert.Equal(uint32(1500), r.DOctets)
+	assert.Equal(uint16(54321), r.SrcPort)
+	assert.Equal(uint16(80), r.DstPort)
+	assert.Equal(uint8(0x12), r.TCPFlags)
+	assert.Equal(uint8(6), r.Protocol)
+	assert.Equal(uint16(100), r.SrcAs)
+	assert.Equal(uint16(65000), r.DstAs)
+	assert.Equal(uint8(8), r.SrcMask)
+	assert.Equal(uint8(24), r.DstMask)
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	s := []byte{
+		0, 5, // Version
+		0, 2, // Count
+		0, 0, 0, 0, // SysUpTime
+		0, 0, 0, 0, // UNIX secs
+		0, 0, 0, 0, // UNIX nsecs
+		0, 0, 0, 0, // Flow Sequence
+		0,    // Engine Type
+		0,    // Engine ID
+		0, 0, // Sampling Interval
+	}
+
+	_, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	assert.Error(t, err)
+
+	s[1] = 9
+	_, err = Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	assert.EqualError(t, err, "NF5: Incompatible protocol version v9, only v5 is supported")
+}
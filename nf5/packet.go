@@ -0,0 +1,150 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nf5 provides structures and functions to decode and analyze
+// NetFlow v5 packets.
+//
+// In contrast to NetFlow v9 and IPFIX, NetFlow v5 uses a fixed record
+// format. A packet consists of a header followed by up to 30 flow records:
+//
+//	+--------+--------+--------+-----+--------+
+//	| Packet | Flow   | Flow   |     | Flow   |
+//	| Header | Record | Record | ... | Record |
+//	+--------+--------+--------+-----+--------+
+//
+// As in the other decoders of tflow2 the raw packet is reversed before
+// decoding. Thus all structs in this package list their fields in reverse
+// order compared to the wire format.
+package nf5
+
+import "unsafe"
+
+// Header is the NetFlow version 5 header
+type Header struct {
+	// First two bits hold the sampling mode, remaining 14 bits hold the
+	// value of the sampling interval
+	SamplingInterval uint16
+
+	// Slot number of the flow-switching engine
+	EngineID uint8
+
+	// Type of flow-switching engine
+	EngineType uint8
+
+	// Sequence counter of total flows seen
+	FlowSequence uint32
+
+	// Residual nanoseconds since 0000 UTC 1970
+	UnixNsecs uint32
+
+	// Time in seconds since 0000 UTC 1970, at which the Export Packet
+	// leaves the Exporter.
+	UnixSecs uint32
+
+	// Time in milliseconds since this device was first booted.
+	SysUpTime uint32
+
+	// Number of flows exported in this packet (1-30)
+	Count uint16
+
+	// NetFlow export format version number
+	Version uint16
+}
+
+// FlowRecord is a NetFlow version 5 flow record
+type FlowRecord struct {
+	// Unused (zero) bytes
+	Pad2 uint16
+
+	// Destination address prefix mask bits
+	DstMask uint8
+
+	// Source address prefix mask bits
+	SrcMask uint8
+
+	// Autonomous system number of the destination, either origin or peer
+	DstAs uint16
+
+	// Autonomous system number of the source, either origin or peer
+	SrcAs uint16
+
+	// IP type of service (ToS)
+	Tos uint8
+
+	// IP protocol type (for example, TCP = 6; UDP = 17)
+	Protocol uint8
+
+	// Cumulative OR of TCP flags
+	TCPFlags uint8
+
+	// Unused (zero) bytes
+	Pad1 uint8
+
+	// TCP/UDP destination port number or equivalent
+	DstPort uint16
+
+	// TCP/UDP source port number or equivalent
+	SrcPort uint16
+
+	// SysUptime at the time the last packet of the flow was received
+	Last uint32
+
+	// SysUptime at start of flow
+	First uint32
+
+	// Total number of Layer 3 bytes in the packets of the flow
+	DOctets uint32
+
+	// Packets in the flow
+	DPkts uint32
+
+	// SNMP index of output interface
+	Output uint16
+
+	// SNMP index of input interface
+	Input uint16
+
+	// IP address of next hop router
+	NextHop [4]byte
+
+	// Destination IP address
+	DstAddr [4]byte
+
+	// Source IP address
+	SrcAddr [4]byte
+}
+
+var (
+	sizeOfHeader     = unsafe.Sizeof(Header{})
+	sizeOfFlowRecord = unsafe.Sizeof(FlowRecord{})
+)
+
+// Packet is a decoded representation of a single NetFlow v5 UDP packet.
+type Packet struct {
+	// A pointer to the packets headers
+	Header *Header
+
+	// A slice of pointers to the flow records found in this packet
+	Records []*FlowRecord
+
+	// Buffer is a slice pointing to the original byte array that this packet was decoded from.
+	Buffer []byte
+}
+
+// SamplingMode returns the sampling mode encoded in the first two bits of the sampling interval field
+func (h *Header) SamplingMode() uint8 {
+	return uint8(h.SamplingInterval >> 14)
+}
+
+// SampleRate returns the sampling interval without the sampling mode bits
+func (h *Header) SampleRate() uint16 {
+	return h.SamplingInterval & 0x3fff
+}
@@ -0,0 +1,207 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nf5server provides netflow v5 collection services via UDP and passes flows into annotator layer
+package nf5server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/nf5"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/bio-routing/tflow2/stats"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NetflowV5Server represents a Netflow v5 Collector instance
+type NetflowV5Server struct {
+	// Output is the channel used to send flows to the annotator layer
+	Output chan *netflow.Flow
+
+	// con is the UDP socket
+	conn *net.UDPConn
+
+	wg sync.WaitGroup
+
+	sampleRateCache *srcache.SamplerateCache
+
+	config *config.Config
+}
+
+// New creates and starts a new `NetflowV5Server` instance
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *NetflowV5Server {
+	nfs := &NetflowV5Server{
+		Output:          make(chan *netflow.Flow),
+		sampleRateCache: sampleRateCache,
+		config:          config,
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", nfs.config.NetflowV5.Listen)
+	if err != nil {
+		panic(fmt.Sprintf("ResolveUDPAddr: %v", err))
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		panic(fmt.Sprintf("Listen: %v", err))
+	}
+	nfs.conn = conn
+
+	// Create goroutines that read netflow packet and process it
+	nfs.wg.Add(numReaders)
+	for i := 0; i < numReaders; i++ {
+		go func(num int) {
+			nfs.packetWorker(num)
+		}(i)
+	}
+
+	return nfs
+}
+
+// Close closes the socket and stops the workers
+func (nfs *NetflowV5Server) Close() {
+	nfs.conn.Close()
+	nfs.wg.Wait()
+}
+
+// validateSource checks if src is a configured agent
+func (nfs *NetflowV5Server) validateSource(src net.IP) bool {
+	if _, ok := nfs.config.AgentsNameByIP[src.String()]; ok {
+		return true
+	}
+	return false
+}
+
+// packetWorker reads netflow packet from socket and handsoff processing to processPacket()
+func (nfs *NetflowV5Server) packetWorker(identity int) {
+	buffer := make([]byte, 8960)
+	for {
+		length, remote, err := nfs.conn.ReadFromUDP(buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Errorf("Error reading from socket: %v", err)
+			continue
+		}
+		atomic.AddUint64(&stats.GlobalStats.Netflow5packets, 1)
+		atomic.AddUint64(&stats.GlobalStats.Netflow5bytes, uint64(length))
+
+		if !nfs.validateSource(remote.IP) {
+			log.Errorf("Unknown source: %s", remote.IP.String())
+		}
+
+		nfs.processPacket(remote.IP, buffer[:length])
+	}
+	nfs.wg.Done()
+}
+
+// processPacket takes a raw netflow v5 packet, sends it to the decoder and passes the flow records on
+func (nfs *NetflowV5Server) processPacket(agent net.IP, buffer []byte) {
+	packet, err := nf5.Decode(buffer, agent)
+	if err != nil {
+		log.Errorf("nf5.Decode: %v", err)
+		return
+	}
+
+	if rate := packet.Header.SampleRate(); rate > 0 {
+		nfs.sampleRateCache.Set(agent, uint64(rate))
+	}
+
+	for _, fl := range nfs.processRecords(agent, packet) {
+		if nfs.config.Debug > 2 {
+			Dump(fl)
+		}
+
+		nfs.Output <- fl
+	}
+}
+
+// processRecords generates Flow elements from the records of `packet`
+func (nfs *NetflowV5Server) processRecords(agent net.IP, packet *nf5.Packet) []*netflow.Flow {
+	flows := make([]*netflow.Flow, 0, len(packet.Records))
+	samplerate := nfs.sampleRateCache.Get(agent)
+
+	for _, r := range packet.Records {
+		atomic.AddUint64(&stats.GlobalStats.Flows4, 1)
+
+		fl := &netflow.Flow{
+			Router:     agent,
+			Family:     4,
+			Timestamp:  int64(packet.Header.UnixSecs),
+			SrcAddr:    reverseIPv4(r.SrcAddr),
+			DstAddr:    reverseIPv4(r.DstAddr),
+			NextHop:    reverseIPv4(r.NextHop),
+			Protocol:   uint32(r.Protocol),
+			Packets:    uint64(r.DPkts),
+			Size:       uint64(r.DOctets),
+			IntIn:      uint32(r.Input),
+			IntOut:     uint32(r.Output),
+			SrcPort:    uint32(r.SrcPort),
+			DstPort:    uint32(r.DstPort),
+			SrcPfx:     makePfx(r.SrcAddr, r.SrcMask),
+			DstPfx:     makePfx(r.DstAddr, r.DstMask),
+			Samplerate: samplerate,
+		}
+
+		if !nfs.config.BGPAugmentation.Enabled {
+			fl.SrcAs = uint32(r.SrcAs)
+			fl.DstAs = uint32(r.DstAs)
+		}
+
+		flows = append(flows, fl)
+	}
+
+	return flows
+}
+
+// reverseIPv4 returns a copy of the reversed address `addr`
+func reverseIPv4(addr [4]byte) net.IP {
+	return net.IP(convert.Reverse(addr[:]))
+}
+
+// makePfx creates the prefix `addr` belongs to given the mask length `mask`
+func makePfx(addr [4]byte, mask uint8) *netflow.Pfx {
+	m := net.CIDRMask(int(mask), 8*net.IPv4len)
+	if m == nil {
+		return nil
+	}
+
+	return &netflow.Pfx{
+		IP:   reverseIPv4(addr).Mask(m),
+		Mask: m,
+	}
+}
+
+// Dump dumps a flow on the screen
+func Dump(fl *netflow.Flow) {
+	fmt.Printf("--------------------------------\n")
+	fmt.Printf("Flow dump:\n")
+	fmt.Printf("Router: %d\n", fl.Router)
+	fmt.Printf("Family: %d\n", fl.Family)
+	fmt.Printf("SrcAddr: %s\n", net.IP(fl.SrcAddr).String())
+	fmt.Printf("DstAddr: %s\n", net.IP(fl.DstAddr).String())
+	fmt.Printf("Protocol: %d\n", fl.Protocol)
+	fmt.Printf("NextHop: %s\n", net.IP(fl.NextHop).String())
+	fmt.Printf("IntIn: %d\n", fl.IntIn)
+	fmt.Printf("IntOut: %d\n", fl.IntOut)
+	fmt.Printf("Packets: %d\n", fl.Packets)
+	fmt.Printf("Bytes: %d\n", fl.Size)
+	fmt.Printf("--------------------------------\n")
+}
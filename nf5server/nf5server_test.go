@@ -0,0 +1,181 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nf5server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/nf5"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func testServer(bgp bool) *NetflowV5Server {
+	return &NetflowV5Server{
+		Output: make(chan *netflow.Flow, 10),
+		sampleRateCache: srcache.New([]config.Agent{
+			{
+				IPAddress:  "192.0.2.1",
+				SampleRate: 1000,
+			},
+		}),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{Enabled: bgp},
+		},
+	}
+}
+
+func TestProcessRecords(t *testing.T) {
+	agent := net.IP{192, 0, 2, 1}
+
+	// Addresses are stored in reversed byte order
+	record := nf5.FlowRecord{
+		SrcAddr: [4]byte{1, 0, 0, 10},
+		DstAddr: [4]byte{1, 0, 168, 192},
+		NextHop: [4]byte{254, 0, 0, 10},
+		SrcMask: 8,
+		DstMask: 24,
+		SrcAs:   100,
+		DstAs:   65000,
+		DPkts:   5,
+		DOctets: 1500,
+		Input:   3,
+		Output:  7,
+	}
+
+	tests := []struct {
+		name         string
+		bgp          bool
+		srcMask      uint8
+		interval     uint16
+		wantRate     uint64
+		wantSrcPfx   string
+		wantSrcAs    uint32
+		wantDstAs    uint32
+		wantNoSrcPfx bool
+	}{
+		{
+			name:       "Configured samplerate overrides header",
+			interval:   0x4064,
+			srcMask:    8,
+			wantRate:   1000,
+			wantSrcPfx: "10.0.0.0/8",
+			wantSrcAs:  100,
+			wantDstAs:  65000,
+		},
+		{
+			name:       "AS left to BGP augmentation",
+			bgp:        true,
+			srcMask:    32,
+			wantRate:   1000,
+			wantSrcPfx: "10.0.0.1/32",
+		},
+		{
+			name:         "Invalid mask",
+			srcMask:      33,
+			wantRate:     1000,
+			wantSrcAs:    100,
+			wantDstAs:    65000,
+			wantNoSrcPfx: true,
+		},
+	}
+
+	for _, test := range tests {
+		nfs := testServer(test.bgp)
+		r := record
+		r.SrcMask = test.srcMask
+		packet := &nf5.Packet{
+			Header: &nf5.Header{
+				SamplingInterval: test.interval,
+				UnixSecs:         1516141408,
+			},
+			Records: []*nf5.FlowRecord{&r},
+		}
+
+		flows := nfs.processRecords(agent, packet)
+		if !assert.Equal(t, 1, len(flows), test.name) {
+			continue
+		}
+
+		fl := flows[0]
+		assert.Equal(t, test.wantRate, fl.Samplerate, test.name)
+		assert.Equal(t, int64(1516141408), fl.Timestamp, test.name)
+		assert.Equal(t, "10.0.0.1", net.IP(fl.SrcAddr).String(), test.name)
+		assert.Equal(t, "192.168.0.1", net.IP(fl.DstAddr).String(), test.name)
+		assert.Equal(t, "10.0.0.254", net.IP(fl.NextHop).String(), test.name)
+		assert.Equal(t, uint64(5), fl.Packets, test.name)
+		assert.Equal(t, uint64(1500), fl.Size, test.name)
+		assert.Equal(t, uint32(3), fl.IntIn, test.name)
+		assert.Equal(t, uint32(7), fl.IntOut, test.name)
+		assert.Equal(t, test.wantSrcAs, fl.SrcAs, test.name)
+		assert.Equal(t, test.wantDstAs, fl.DstAs, test.name)
+		assert.Equal(t, "192.168.0.0", net.IP(fl.DstPfx.IP).String(), test.name)
+		assert.Equal(t, net.CIDRMask(24, 32), net.IPMask(fl.DstPfx.Mask), test.name)
+
+		if test.wantNoSrcPfx {
+			assert.Nil(t, fl.SrcPfx, test.name)
+			continue
+		}
+		if assert.NotNil(t, fl.SrcPfx, test.name) {
+			pfx := net.IPNet{IP: fl.SrcPfx.IP, Mask: fl.SrcPfx.Mask}
+			assert.Equal(t, test.wantSrcPfx, pfx.String(), test.name)
+		}
+	}
+}
+
+func TestProcessPacketSamplerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval []byte
+		wantRate uint64
+	}{
+		{
+			name:     "No samplerate in header",
+			interval: []byte{0, 0},
+			wantRate: 1000,
+		},
+		{
+			name:     "Samplerate in header",
+			interval: []byte{0x40, 0x64},
+			wantRate: 100,
+		},
+	}
+
+	for _, test := range tests {
+		s := []byte{
+			0, 5, // Version
+			0, 1, // Count
+			0, 0, 0x12, 0x34, // SysUpTime
+			0x5a, 0x5e, 0x7b, 0x60, // UNIX secs
+			0, 0, 0, 0, // UNIX nsecs
+			0, 0, 0, 42, // Flow Sequence
+			0, // Engine Type
+			0, // Engine ID
+		}
+		s = append(s, test.interval...) // Sampling Interval
+		s = append(s, make([]byte, 48)...)
+
+		nfs := testServer(false)
+		agent := net.IP{192, 0, 2, 1}
+		nfs.processPacket(agent, s)
+		if !assert.Equal(t, 1, len(nfs.Output), test.name) {
+			continue
+		}
+
+		fl := <-nfs.Output
+		assert.Equal(t, test.wantRate, fl.Samplerate, test.name)
+		assert.Equal(t, test.wantRate, nfs.sampleRateCache.Get(agent), test.name)
+	}
+}
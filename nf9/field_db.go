@@ -108,4 +108,14 @@ const (
 	ApplicationDescription    = 94
 	ApplicationTag            = 95
 	ApplicationName           = 96
+
+	// NAT event logging (NEL) uses the IDs of the according IPFIX information elements
+	PostNATSrcIPv4Addr          = 225
+	PostNATDstIPv4Addr          = 226
+	PostNAPTSrcTransportPort    = 227
+	PostNAPTDstTransportPort    = 228
+	NatEvent                    = 230
+	PostNATSrcIPv6Addr          = 281
+	PostNATDstIPv6Addr          = 282
+	ObservationTimeMilliseconds = 323
 )
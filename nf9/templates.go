@@ -74,6 +74,23 @@ type TemplateRecords struct {
 	Values [][]byte
 }
 
+// DataRecords returns the fields of a data record described by `t`. Data records of options templates
+// carry the values of the scope fields before the values of the option fields.
+func (t *TemplateRecords) DataRecords() []*TemplateRecord {
+	if len(t.OptionScopes) == 0 {
+		return t.Records
+	}
+
+	recs := make([]*TemplateRecord, 0, len(t.OptionScopes)+len(t.Records))
+	for _, scope := range t.OptionScopes {
+		recs = append(recs, &TemplateRecord{
+			Length: scope.ScopeFieldLength,
+			Type:   scope.ScopeFieldType,
+		})
+	}
+	return append(recs, t.Records...)
+}
+
 // OptionScope represents an option scope in an options template flowset
 type OptionScope struct {
 	// The length (in bytes) of the Scope field, as it would appear in
@@ -16,21 +16,37 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/bio-routing/tflow2/appcache"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/srcache"
 
 	"github.com/bio-routing/tflow2/convert"
 	"github.com/bio-routing/tflow2/netflow"
 	"github.com/bio-routing/tflow2/nf9"
+	ippacket "github.com/bio-routing/tflow2/packet"
+	"github.com/bio-routing/tflow2/pending"
+	"github.com/bio-routing/tflow2/seqtrack"
 	"github.com/bio-routing/tflow2/stats"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// templateFileName is the name of the file in the data directory templates are persisted in
+	templateFileName = "templates_netflow_v9.json"
+
+	// templateMaintenanceInterval is the interval in which templates are expired and persisted
+	templateMaintenanceInterval = 10 * time.Second
+)
+
 // fieldMap describes what information is at what index in the slice
 // that we get from decoding a netflow packet
 type fieldMap struct {
@@ -39,6 +55,10 @@ type fieldMap struct {
 	protocol                  int
 	packets                   int
 	size                      int
+	outPackets                int
+	outSize                   int
+	firstSwitched             int
+	lastSwitched              int
 	intIn                     int
 	intOut                    int
 	nextHop                   int
@@ -52,6 +72,29 @@ type fieldMap struct {
 	flowSamplerID             int
 	samplingInterval          int
 	flowSamplerRandomInterval int
+	tcpFlags                  int
+	tos                       int
+	icmpType                  int
+	srcVlan                   int
+	dstVlan                   int
+	srcMac                    int
+	dstMac                    int
+	outSrcMac                 int
+	inDstMac                  int
+	mplsLabel1                int
+	mplsLabel2                int
+	mplsLabel3                int
+	mplsTopLabelAddr          int
+	forwardingStatus          int
+	direction                 int
+	postNATSrcAddr            int
+	postNATDstAddr            int
+	postNAPTSrcPort           int
+	postNAPTDstPort           int
+	natEvent                  int
+	observationTime           int
+	applicationTag            int
+	applicationName           int
 }
 
 // NetflowServer represents a Netflow Collector instance
@@ -70,18 +113,30 @@ type NetflowServer struct {
 
 	sampleRateCache *srcache.SamplerateCache
 
+	// seqTracker tracks sequence numbers of export packets
+	seqTracker *seqtrack.Tracker
+
+	// appCache holds the application tables of the agents
+	appCache *appcache.AppCache
+
 	config *config.Config
 }
 
 // New creates and starts a new `NetflowServer` instance
-func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *NetflowServer {
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache, seqTracker *seqtrack.Tracker, appCache *appcache.AppCache) *NetflowServer {
 	nfs := &NetflowServer{
-		tmplCache:       newTemplateCache(),
+		tmplCache:       newTemplateCache(time.Duration(*config.TemplateTimeout) * time.Second),
 		Output:          make(chan *netflow.Flow),
 		sampleRateCache: sampleRateCache,
+		seqTracker:      seqTracker,
+		appCache:        appCache,
 		config:          config,
 	}
 
+	nfs.tmplCache.pending = pending.New(*config.PendingSets.MaxSets, time.Duration(config.PendingSets.MaxAge)*time.Second)
+	nfs.loadTemplates()
+	go nfs.templateMaintenance()
+
 	addr, err := net.ResolveUDPAddr("udp", nfs.config.NetflowV9.Listen)
 	if err != nil {
 		panic(fmt.Sprintf("ResolveUDPAddr: %v", err))
@@ -110,6 +165,57 @@ func (nfs *NetflowServer) Close() {
 	nfs.wg.Wait()
 }
 
+// templateFile returns the path of the file templates are persisted in
+func (nfs *NetflowServer) templateFile() string {
+	return filepath.Join(nfs.config.DataDir, templateFileName)
+}
+
+// loadTemplates restores the persisted template cache
+func (nfs *NetflowServer) loadTemplates() {
+	if nfs.config.DataDir == "" {
+		return
+	}
+
+	err := nfs.tmplCache.load(nfs.templateFile())
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			log.Errorf("Unable to load NetFlow v9 templates: %v", err)
+		}
+		return
+	}
+
+	log.Infof("Loaded %d NetFlow v9 templates", len(nfs.tmplCache.templates()))
+}
+
+// templateMaintenance periodically removes expired templates and persists the template cache
+func (nfs *NetflowServer) templateMaintenance() {
+	for range time.Tick(templateMaintenanceInterval) {
+		n := nfs.tmplCache.expire()
+		if n > 0 && nfs.config.Debug > 0 {
+			log.Infof("%d NetFlow v9 templates expired", n)
+		}
+
+		n = nfs.tmplCache.pending.Expire()
+		if n > 0 && nfs.config.Debug > 0 {
+			log.Infof("%d pending NetFlow v9 data sets expired", n)
+		}
+
+		if nfs.config.DataDir == "" {
+			continue
+		}
+
+		err := nfs.tmplCache.save(nfs.templateFile())
+		if err != nil {
+			log.Errorf("Unable to save NetFlow v9 templates: %v", err)
+		}
+	}
+}
+
+// Templates returns the contents of the template cache
+func (nfs *NetflowServer) Templates() interface{} {
+	return nfs.tmplCache.templates()
+}
+
 // validateSource checks if src is a configured agent
 func (nfs *NetflowServer) validateSource(src net.IP) bool {
 	if _, ok := nfs.config.AgentsNameByIP[src.String()]; ok {
@@ -152,6 +258,9 @@ func (nfs *NetflowServer) processPacket(remote net.IP, buffer []byte) {
 		return
 	}
 
+	// Sequence numbers of NetFlow v9 count export packets (RFC3954 5.1.)
+	nfs.seqTracker.Update(remote, packet.Header.SourceID, packet.Header.SequenceNumber, 1)
+
 	nfs.updateTemplateCache(remote, packet)
 	nfs.processFlowSets(remote, packet.Header.SourceID, packet.DataFlowSets(), int64(packet.Header.UnixSecs), packet)
 }
@@ -161,23 +270,45 @@ func (nfs *NetflowServer) processFlowSets(remote net.IP, sourceID uint32, flowSe
 	addr := remote.String()
 	keyParts := make([]string, 3, 3)
 	for _, set := range flowSets {
-		template := nfs.tmplCache.get(convert.Uint32(remote), sourceID, set.Header.FlowSetID)
+		template := nfs.tmplCache.get(addr, sourceID, set.Header.FlowSetID)
 
 		if template == nil {
 			templateKey := makeTemplateKey(addr, sourceID, set.Header.FlowSetID, keyParts)
 			if nfs.config.Debug > 0 {
 				log.Warningf("Template for given FlowSet not found: %s", templateKey)
 			}
-			continue
-		}
 
-		records := nf9.DecodeFlowSet(template.Records, *set)
-		if records == nil {
-			log.Warning("Error decoding FlowSet")
+			nfs.tmplCache.pending.Add(pending.Key{
+				Agent:      addr,
+				SourceID:   sourceID,
+				TemplateID: set.Header.FlowSetID,
+			}, &pendingSet{
+				set:    set,
+				ts:     ts,
+				packet: packet,
+			})
 			continue
 		}
-		nfs.processFlowSet(template, records, remote, ts, packet)
+
+		nfs.decodeFlowSet(template, set, remote, ts, packet)
+	}
+}
+
+// pendingSet is a data set waiting for its template
+type pendingSet struct {
+	set    *nf9.FlowSet
+	ts     int64
+	packet *nf9.Packet
+}
+
+// decodeFlowSet decodes `set` using `template` and passes the records to processFlowSet()
+func (nfs *NetflowServer) decodeFlowSet(template *nf9.TemplateRecords, set *nf9.FlowSet, remote net.IP, ts int64, packet *nf9.Packet) {
+	records := nf9.DecodeFlowSet(template.DataRecords(), *set)
+	if records == nil {
+		log.Warning("Error decoding FlowSet")
+		return
 	}
+	nfs.processFlowSet(template, records, remote, ts, packet)
 }
 
 // process generates Flow elements from records and pushes them into the `receiver` channel
@@ -186,13 +317,8 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 
 	for _, r := range records {
 		if template.OptionScopes != nil {
-			if fm.samplingInterval >= 0 {
-				nfs.sampleRateCache.Set(agent, uint64(convert.Uint32(r.Values[fm.samplingInterval])))
-			}
-
-			if fm.flowSamplerRandomInterval >= 0 {
-				nfs.sampleRateCache.Set(agent, uint64(convert.Uint32(r.Values[fm.flowSamplerRandomInterval])))
-			}
+			nfs.updateSamplerate(agent, packet.Header.SourceID, fm, r)
+			nfs.updateApplication(agent, fm, r)
 			continue
 		}
 
@@ -217,11 +343,28 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 		}
 
 		if fm.packets >= 0 {
-			fl.Packets = convert.Uint32(r.Values[fm.packets])
+			fl.Packets = convert.Uint64(r.Values[fm.packets])
 		}
 
 		if fm.size >= 0 {
-			fl.Size = uint64(convert.Uint32(r.Values[fm.size]))
+			fl.Size = convert.Uint64(r.Values[fm.size])
+		}
+
+		if fm.outPackets >= 0 {
+			fl.OutPkts = convert.Uint64(r.Values[fm.outPackets])
+		}
+
+		if fm.outSize >= 0 {
+			fl.OutBytes = convert.Uint64(r.Values[fm.outSize])
+		}
+
+		// Flows exported on egress might carry egress counters only
+		if fm.size < 0 && fm.outSize >= 0 {
+			fl.Size = fl.OutBytes
+		}
+
+		if fm.packets < 0 && fm.outPackets >= 0 {
+			fl.Packets = fl.OutPkts
 		}
 
 		if fm.protocol >= 0 {
@@ -266,7 +409,122 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 			}
 		}
 
-		fl.Samplerate = nfs.sampleRateCache.Get(agent)
+		if fm.tcpFlags >= 0 {
+			fl.TcpFlags = convert.Uint32(r.Values[fm.tcpFlags])
+		}
+
+		if fm.tos >= 0 {
+			fl.Tos = convert.Uint32(r.Values[fm.tos])
+		}
+
+		// ICMP type and code are encoded as type * 256 + code, either in a dedicated field or the DST port
+		if fm.icmpType >= 0 {
+			typeCode := convert.Uint32(r.Values[fm.icmpType])
+			fl.IcmpType, fl.IcmpCode = typeCode>>8, typeCode&0xff
+		} else if fl.Protocol == ippacket.ICMP || fl.Protocol == ippacket.ICMPv6 {
+			fl.IcmpType, fl.IcmpCode = fl.DstPort>>8, fl.DstPort&0xff
+		}
+
+		if fm.srcVlan >= 0 {
+			fl.SrcVlan = convert.Uint32(r.Values[fm.srcVlan])
+		}
+
+		if fm.dstVlan >= 0 {
+			fl.DstVlan = convert.Uint32(r.Values[fm.dstVlan])
+		}
+
+		if fm.srcMac >= 0 {
+			fl.SrcMac = convert.Reverse(r.Values[fm.srcMac])
+		} else if fm.outSrcMac >= 0 {
+			fl.SrcMac = convert.Reverse(r.Values[fm.outSrcMac])
+		}
+
+		if fm.dstMac >= 0 {
+			fl.DstMac = convert.Reverse(r.Values[fm.dstMac])
+		} else if fm.inDstMac >= 0 {
+			fl.DstMac = convert.Reverse(r.Values[fm.inDstMac])
+		}
+
+		if fm.mplsLabel1 >= 0 {
+			fl.MplsLabel1 = ippacket.LabelFromStackSection(r.Values[fm.mplsLabel1])
+		}
+
+		if fm.mplsLabel2 >= 0 {
+			fl.MplsLabel2 = ippacket.LabelFromStackSection(r.Values[fm.mplsLabel2])
+		}
+
+		if fm.mplsLabel3 >= 0 {
+			fl.MplsLabel3 = ippacket.LabelFromStackSection(r.Values[fm.mplsLabel3])
+		}
+
+		if fm.mplsTopLabelAddr >= 0 {
+			fl.MplsTopLabelAddr = convert.Reverse(r.Values[fm.mplsTopLabelAddr])
+		}
+
+		if fm.forwardingStatus >= 0 {
+			fl.ForwardingStatus = convert.Uint32(r.Values[fm.forwardingStatus])
+		}
+
+		if fm.firstSwitched >= 0 {
+			fl.FlowStart = switchedToUnixMilli(packet.Header, convert.Uint32(r.Values[fm.firstSwitched]))
+		}
+
+		if fm.lastSwitched >= 0 {
+			fl.FlowEnd = switchedToUnixMilli(packet.Header, convert.Uint32(r.Values[fm.lastSwitched]))
+		}
+
+		// NAT event records carry the time of the event instead of the first and last packet
+		if fm.firstSwitched < 0 && fm.observationTime >= 0 {
+			fl.FlowStart = convert.Uint64(r.Values[fm.observationTime])
+			fl.FlowEnd = fl.FlowStart
+		}
+
+		if fm.postNATSrcAddr >= 0 {
+			fl.PostNatSrcAddr = convert.Reverse(r.Values[fm.postNATSrcAddr])
+		}
+
+		if fm.postNATDstAddr >= 0 {
+			fl.PostNatDstAddr = convert.Reverse(r.Values[fm.postNATDstAddr])
+		}
+
+		if fm.postNAPTSrcPort >= 0 {
+			fl.PostNaptSrcPort = convert.Uint32(r.Values[fm.postNAPTSrcPort])
+		}
+
+		if fm.postNAPTDstPort >= 0 {
+			fl.PostNaptDstPort = convert.Uint32(r.Values[fm.postNAPTDstPort])
+		}
+
+		if fm.natEvent >= 0 {
+			fl.NatEvent = convert.Uint32(r.Values[fm.natEvent])
+		}
+
+		if fm.direction >= 0 {
+			fl.Direction = convert.Uint32(r.Values[fm.direction])
+		}
+
+		if fm.applicationTag >= 0 {
+			fl.ApplicationId = convert.Reverse(r.Values[fm.applicationTag])
+		}
+
+		if fm.applicationName >= 0 {
+			fl.ApplicationName = strings.TrimRight(string(convert.Reverse(r.Values[fm.applicationName])), "\x00")
+		} else {
+			fl.ApplicationName = nfs.appCache.Get(agent, fl.ApplicationId)
+		}
+
+		// The direction policy only applies if the template carries the direction
+		if a := nfs.config.AgentsByIP[agent.String()]; a != nil && fm.direction >= 0 && !a.CountsFlow(fl.ObservationInterface(), fl.Egress()) {
+			atomic.AddUint64(&stats.GlobalStats.FlowsDirectionSkipped, 1)
+			continue
+		}
+
+		var samplerID uint64
+		if fm.flowSamplerID >= 0 {
+			samplerID = convert.Uint64(r.Values[fm.flowSamplerID])
+		}
+		fl.Samplerate = nfs.sampleRateCache.GetSampler(agent, packet.Header.SourceID, samplerID, fl.IntIn)
+		nfs.seqTracker.Compensate(&fl, packet.Header.SourceID)
 
 		if nfs.config.Debug > 2 {
 			Dump(&fl)
@@ -276,6 +534,14 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 	}
 }
 
+// switchedToUnixMilli converts the sysUpTime relative timestamp `switched` into a unix timestamp in milliseconds
+func switchedToUnixMilli(hdr *nf9.Header, switched uint32) uint64 {
+	// sysUpTime is a 32 bit millisecond counter that wraps after ~49 days.
+	// Unsigned arithmetic makes sure the age is calculated correctly accross a wrap.
+	age := hdr.SysUpTime - switched
+	return uint64(hdr.UnixSecs)*1000 - uint64(age)
+}
+
 // Dump dumps a flow on the screen
 func Dump(fl *netflow.Flow) {
 	fmt.Printf("--------------------------------\n")
@@ -290,6 +556,8 @@ func Dump(fl *netflow.Flow) {
 	fmt.Printf("IntOut: %d\n", fl.IntOut)
 	fmt.Printf("Packets: %d\n", fl.Packets)
 	fmt.Printf("Bytes: %d\n", fl.Size)
+	fmt.Printf("OutPackets: %d\n", fl.OutPkts)
+	fmt.Printf("OutBytes: %d\n", fl.OutBytes)
 	fmt.Printf("--------------------------------\n")
 }
 
@@ -310,6 +578,10 @@ func generateFieldMap(template *nf9.TemplateRecords) *fieldMap {
 		protocol:                  -1,
 		packets:                   -1,
 		size:                      -1,
+		outPackets:                -1,
+		outSize:                   -1,
+		firstSwitched:             -1,
+		lastSwitched:              -1,
 		intIn:                     -1,
 		intOut:                    -1,
 		nextHop:                   -1,
@@ -323,9 +595,33 @@ func generateFieldMap(template *nf9.TemplateRecords) *fieldMap {
 		flowSamplerID:             -1,
 		samplingInterval:          -1,
 		flowSamplerRandomInterval: -1,
+		tcpFlags:                  -1,
+		tos:                       -1,
+		icmpType:                  -1,
+		srcVlan:                   -1,
+		dstVlan:                   -1,
+		srcMac:                    -1,
+		dstMac:                    -1,
+		outSrcMac:                 -1,
+		inDstMac:                  -1,
+		mplsLabel1:                -1,
+		mplsLabel2:                -1,
+		mplsLabel3:                -1,
+		mplsTopLabelAddr:          -1,
+		forwardingStatus:          -1,
+		direction:                 -1,
+		postNATSrcAddr:            -1,
+		postNATDstAddr:            -1,
+		postNAPTSrcPort:           -1,
+		postNAPTDstPort:           -1,
+		natEvent:                  -1,
+		observationTime:           -1,
+		applicationTag:            -1,
+		applicationName:           -1,
 	}
 
-	i := -1
+	// Values of option fields follow the values of the scope fields in options data records
+	i := len(template.OptionScopes) - 1
 	for _, f := range template.Records {
 		i++
 
@@ -346,6 +642,14 @@ func generateFieldMap(template *nf9.TemplateRecords) *fieldMap {
 			fm.protocol = i
 		case nf9.InPkts:
 			fm.packets = i
+		case nf9.OutBytes:
+			fm.outSize = i
+		case nf9.OutPkts:
+			fm.outPackets = i
+		case nf9.FirstSwitched:
+			fm.firstSwitched = i
+		case nf9.LastSwitched:
+			fm.lastSwitched = i
 		case nf9.InputSnmp:
 			fm.intIn = i
 		case nf9.OutputSnmp:
@@ -362,20 +666,117 @@ func generateFieldMap(template *nf9.TemplateRecords) *fieldMap {
 			fm.srcAsn = i
 		case nf9.DstAs:
 			fm.dstAsn = i
+		case nf9.FlowSamplerID:
+			fm.flowSamplerID = i
 		case nf9.SamplingInterval:
 			fm.samplingInterval = i
 		case nf9.FlowSamplerRandomInterval:
 			fm.flowSamplerRandomInterval = i
+		case nf9.TCPFlags:
+			fm.tcpFlags = i
+		case nf9.SrcTos:
+			fm.tos = i
+		case nf9.IcmpType:
+			fm.icmpType = i
+		case nf9.SrcVlan:
+			fm.srcVlan = i
+		case nf9.DstVlan:
+			fm.dstVlan = i
+		case nf9.InSrcMac:
+			fm.srcMac = i
+		case nf9.OutDstMac:
+			fm.dstMac = i
+		case nf9.OutSrcMac:
+			fm.outSrcMac = i
+		case nf9.InDstMac:
+			fm.inDstMac = i
+		case nf9.MplsLabel1:
+			fm.mplsLabel1 = i
+		case nf9.MplsLabel2:
+			fm.mplsLabel2 = i
+		case nf9.MplsLabel3:
+			fm.mplsLabel3 = i
+		case nf9.MplsTopLabelIPAddr:
+			fm.mplsTopLabelAddr = i
+		case nf9.ForwardingStatus:
+			fm.forwardingStatus = i
+		case nf9.Direction:
+			fm.direction = i
+		case nf9.PostNATSrcIPv4Addr, nf9.PostNATSrcIPv6Addr:
+			fm.postNATSrcAddr = i
+		case nf9.PostNATDstIPv4Addr, nf9.PostNATDstIPv6Addr:
+			fm.postNATDstAddr = i
+		case nf9.PostNAPTSrcTransportPort:
+			fm.postNAPTSrcPort = i
+		case nf9.PostNAPTDstTransportPort:
+			fm.postNAPTDstPort = i
+		case nf9.NatEvent:
+			fm.natEvent = i
+		case nf9.ObservationTimeMilliseconds:
+			fm.observationTime = i
+		case nf9.ApplicationTag:
+			fm.applicationTag = i
+		case nf9.ApplicationName:
+			fm.applicationName = i
 		}
 	}
 	return &fm
 }
 
+// updateSamplerate learns the samplerate of a sampler from options data record `r`
+func (nfs *NetflowServer) updateSamplerate(agent net.IP, sourceID uint32, fm *fieldMap, r nf9.FlowDataRecord) {
+	var rate uint64
+	if fm.samplingInterval >= 0 {
+		rate = convert.Uint64(r.Values[fm.samplingInterval])
+	}
+
+	if fm.flowSamplerRandomInterval >= 0 {
+		rate = convert.Uint64(r.Values[fm.flowSamplerRandomInterval])
+	}
+
+	if rate == 0 {
+		return
+	}
+
+	var samplerID uint64
+	if fm.flowSamplerID >= 0 {
+		samplerID = convert.Uint64(r.Values[fm.flowSamplerID])
+	}
+
+	nfs.sampleRateCache.SetSampler(agent, sourceID, samplerID, rate)
+}
+
+// updateApplication learns the name of an application from options data record `r` of an application table
+func (nfs *NetflowServer) updateApplication(agent net.IP, fm *fieldMap, r nf9.FlowDataRecord) {
+	if fm.applicationTag < 0 || fm.applicationName < 0 {
+		return
+	}
+
+	id := convert.Reverse(r.Values[fm.applicationTag])
+	name := strings.TrimRight(string(convert.Reverse(r.Values[fm.applicationName])), "\x00")
+	nfs.appCache.Set(agent, id, name)
+}
+
 // updateTemplateCache updates the template cache
 func (nfs *NetflowServer) updateTemplateCache(remote net.IP, p *nf9.Packet) {
 	templRecs := p.GetTemplateRecords()
 	for _, tr := range templRecs {
-		nfs.tmplCache.set(convert.Uint32(remote), tr.Packet.Header.SourceID, tr.Header.TemplateID, *tr)
+		nfs.tmplCache.set(remote.String(), tr.Packet.Header.SourceID, tr.Header.TemplateID, *tr)
+		nfs.replayPendingSets(remote, tr)
+	}
+}
+
+// replayPendingSets processes data sets that have been received before template `tr`
+func (nfs *NetflowServer) replayPendingSets(remote net.IP, tr *nf9.TemplateRecords) {
+	items := nfs.tmplCache.pending.Take(pending.Key{
+		Agent:      remote.String(),
+		SourceID:   tr.Packet.Header.SourceID,
+		TemplateID: tr.Header.TemplateID,
+	})
+
+	for _, item := range items {
+		ps := item.(*pendingSet)
+		nfs.decodeFlowSet(tr, ps.set, remote, ps.ts, ps.packet)
 	}
 }
 
@@ -0,0 +1,446 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/appcache"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/nf9"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFlowSetCounters(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     []*nf9.TemplateRecord
+		values     [][]byte
+		wantSize   uint64
+		wantPkts   uint64
+		wantOutSz  uint64
+		wantOutPkt uint64
+	}{
+		{
+			name: "64 bit counters",
+			fields: []*nf9.TemplateRecord{
+				{Type: nf9.IPv4SrcAddr, Length: 4},
+				{Type: nf9.InBytes, Length: 8},
+				{Type: nf9.InPkts, Length: 8},
+			},
+			values: [][]byte{
+				{1, 0, 0, 10},
+				{0, 0, 0, 0, 1, 0, 0, 0}, // 2^32
+				{5, 0, 0, 0, 1, 0, 0, 0}, // 2^32 + 5
+			},
+			wantSize: 1 << 32,
+			wantPkts: 1<<32 + 5,
+		},
+		{
+			name: "Reduced size encoding",
+			fields: []*nf9.TemplateRecord{
+				{Type: nf9.IPv4SrcAddr, Length: 4},
+				{Type: nf9.InBytes, Length: 2},
+				{Type: nf9.InPkts, Length: 1},
+			},
+			values: [][]byte{
+				{1, 0, 0, 10},
+				{0xdc, 0x05}, // 1500
+				{1},
+			},
+			wantSize: 1500,
+			wantPkts: 1,
+		},
+		{
+			name: "Egress counters only",
+			fields: []*nf9.TemplateRecord{
+				{Type: nf9.IPv4SrcAddr, Length: 4},
+				{Type: nf9.OutBytes, Length: 8},
+				{Type: nf9.OutPkts, Length: 4},
+			},
+			values: [][]byte{
+				{1, 0, 0, 10},
+				{0, 0, 0, 0, 2, 0, 0, 0}, // 2^33
+				{3, 0, 0, 0},
+			},
+			wantSize:   1 << 33,
+			wantPkts:   3,
+			wantOutSz:  1 << 33,
+			wantOutPkt: 3,
+		},
+	}
+
+	for _, test := range tests {
+		nfs := &NetflowServer{
+			Output:          make(chan *netflow.Flow, 1),
+			sampleRateCache: srcache.New(nil),
+			config: &config.Config{
+				BGPAugmentation: &config.BGPAugment{},
+			},
+		}
+
+		tmpl := &nf9.TemplateRecords{
+			Header:  &nf9.TemplateRecordHeader{TemplateID: 256},
+			Records: test.fields,
+		}
+		nfs.processFlowSet(tmpl, []nf9.FlowDataRecord{{Values: test.values}}, net.IP{192, 0, 2, 1}, 0, &nf9.Packet{Header: &nf9.Header{}})
+
+		fl := <-nfs.Output
+		assert.Equal(t, test.wantSize, fl.Size, test.name)
+		assert.Equal(t, test.wantPkts, fl.Packets, test.name)
+		assert.Equal(t, test.wantOutSz, fl.OutBytes, test.name)
+		assert.Equal(t, test.wantOutPkt, fl.OutPkts, test.name)
+	}
+}
+
+func TestSamplerates(t *testing.T) {
+	nfs := &NetflowServer{
+		Output: make(chan *netflow.Flow, 10),
+		sampleRateCache: srcache.New([]config.Agent{
+			{
+				IPAddress:  "192.0.2.1",
+				SampleRate: 100,
+				InterfaceSampleRates: map[uint32]uint64{
+					2: 500,
+				},
+			},
+		}),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+		},
+	}
+	agent := net.IP{192, 0, 2, 1}
+	packet := &nf9.Packet{Header: &nf9.Header{SourceID: 7}}
+
+	// Options data records carry the value of the system scope before the sampler fields
+	options := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 257},
+		OptionScopes: []*nf9.OptionScope{
+			{ScopeFieldType: 1, ScopeFieldLength: 4},
+		},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.FlowSamplerID, Length: 1},
+			{Type: nf9.FlowSamplerRandomInterval, Length: 4},
+		},
+	}
+	records := nf9.DecodeFlowSet(options.DataRecords(), nf9.FlowSet{
+		Flows: []byte{0xe8, 0x03, 0, 0, 5, 0, 0, 0, 0}, // reversed: system 0, sampler 5, interval 1000
+	})
+	nfs.processFlowSet(options, records, agent, 0, packet)
+
+	tmpl := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 256},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.InputSnmp, Length: 4},
+			{Type: nf9.FlowSamplerID, Length: 1},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		intIn     byte
+		samplerID byte
+		expected  uint64
+	}{
+		{
+			name:      "Learned sampler",
+			intIn:     1,
+			samplerID: 5,
+			expected:  1000,
+		},
+		{
+			name:      "Configured interface",
+			intIn:     2,
+			samplerID: 6,
+			expected:  500,
+		},
+		{
+			name:      "Configured agent",
+			intIn:     3,
+			samplerID: 6,
+			expected:  100,
+		},
+	}
+
+	for _, test := range tests {
+		nfs.processFlowSet(tmpl, []nf9.FlowDataRecord{{Values: [][]byte{{test.intIn, 0, 0, 0}, {test.samplerID}}}}, agent, 0, packet)
+		fl := <-nfs.Output
+		assert.Equal(t, test.expected, fl.Samplerate, test.name)
+	}
+}
+
+func TestMPLSAndForwardingStatus(t *testing.T) {
+	nfs := &NetflowServer{
+		Output:          make(chan *netflow.Flow, 1),
+		sampleRateCache: srcache.New(nil),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+		},
+	}
+
+	tmpl := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 256},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.MplsLabel1, Length: 3},
+			{Type: nf9.MplsLabel2, Length: 3},
+			{Type: nf9.MplsTopLabelIPAddr, Length: 4},
+			{Type: nf9.ForwardingStatus, Length: 1},
+		},
+	}
+	records := []nf9.FlowDataRecord{
+		{
+			Values: [][]byte{
+				{0x44, 0x06, 0x00}, // reversed: label 100, traffic class 2
+				{0x81, 0x0c, 0x00}, // reversed: label 200, bottom of stack
+				{1, 2, 0, 192},     // reversed: 192.0.2.1
+				{131},              // dropped, unroutable
+			},
+		},
+	}
+	nfs.processFlowSet(tmpl, records, net.IP{192, 0, 2, 254}, 0, &nf9.Packet{Header: &nf9.Header{}})
+
+	fl := <-nfs.Output
+	assert.Equal(t, uint32(100), fl.MplsLabel1)
+	assert.Equal(t, uint32(200), fl.MplsLabel2)
+	assert.Equal(t, uint32(0), fl.MplsLabel3)
+	assert.Equal(t, "192.0.2.1", net.IP(fl.MplsTopLabelAddr).String())
+	assert.Equal(t, uint32(131), fl.ForwardingStatus)
+}
+
+func TestApplication(t *testing.T) {
+	nfs := &NetflowServer{
+		Output:          make(chan *netflow.Flow, 10),
+		sampleRateCache: srcache.New(nil),
+		appCache:        appcache.New(),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+		},
+	}
+	agent := net.IP{192, 0, 2, 1}
+	packet := &nf9.Packet{Header: &nf9.Header{}}
+
+	// Application table: system scope, application tag, application name
+	options := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 257},
+		OptionScopes: []*nf9.OptionScope{
+			{ScopeFieldType: 1, ScopeFieldLength: 4},
+		},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.ApplicationTag, Length: 3},
+			{Type: nf9.ApplicationName, Length: 6},
+		},
+	}
+	nfs.processFlowSet(options, []nf9.FlowDataRecord{
+		{
+			Values: [][]byte{
+				{0, 0, 0, 0},
+				{80, 0, 3},                 // reversed: engine 3, selector 80
+				{0, 0, 'p', 't', 't', 'h'}, // reversed: "http" padded with zeros
+			},
+		},
+	}, agent, 0, packet)
+
+	tmpl := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 256},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.ApplicationTag, Length: 3},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		id       []byte
+		expected string
+	}{
+		{
+			name:     "Known application",
+			id:       []byte{80, 0, 3},
+			expected: "http",
+		},
+		{
+			name:     "Unknown application",
+			id:       []byte{187, 1, 3},
+			expected: "3:443",
+		},
+	}
+
+	for _, test := range tests {
+		nfs.processFlowSet(tmpl, []nf9.FlowDataRecord{{Values: [][]byte{test.id}}}, agent, 0, packet)
+		fl := <-nfs.Output
+		assert.Equal(t, test.expected, fl.Application(), test.name)
+	}
+}
+
+func TestNATEvent(t *testing.T) {
+	nfs := &NetflowServer{
+		Output:          make(chan *netflow.Flow, 1),
+		sampleRateCache: srcache.New(nil),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+		},
+	}
+
+	tmpl := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 256},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.IPv4SrcAddr, Length: 4},
+			{Type: nf9.L4SrcPort, Length: 2},
+			{Type: nf9.PostNATSrcIPv4Addr, Length: 4},
+			{Type: nf9.PostNAPTSrcTransportPort, Length: 2},
+			{Type: nf9.NatEvent, Length: 1},
+			{Type: nf9.ObservationTimeMilliseconds, Length: 8},
+		},
+	}
+	records := []nf9.FlowDataRecord{
+		{
+			Values: [][]byte{
+				{1, 0, 0, 10},               // reversed: 10.0.0.1
+				{0xe8, 0x03},                // reversed: 1000
+				{1, 100, 51, 198},           // reversed: 198.51.100.1
+				{0x40, 0x9c},                // reversed: 40000
+				{4},                         // NAT44 session create
+				{0xe8, 3, 0, 0, 0, 0, 0, 0}, // reversed: 1000
+			},
+		},
+	}
+	nfs.processFlowSet(tmpl, records, net.IP{192, 0, 2, 254}, 0, &nf9.Packet{Header: &nf9.Header{}})
+
+	fl := <-nfs.Output
+	assert.Equal(t, "10.0.0.1", net.IP(fl.SrcAddr).String())
+	assert.Equal(t, uint32(1000), fl.SrcPort)
+	assert.Equal(t, "198.51.100.1", net.IP(fl.PostNatSrcAddr).String())
+	assert.Equal(t, uint32(40000), fl.PostNaptSrcPort)
+	assert.Equal(t, uint32(4), fl.NatEvent)
+	assert.Equal(t, uint64(1000), fl.FlowStart)
+	assert.Equal(t, uint64(1000), fl.FlowEnd)
+}
+
+func TestDirectionPolicy(t *testing.T) {
+	agent := &config.Agent{
+		Name:           "rtr01",
+		IPAddress:      "192.0.2.1",
+		CountDirection: config.DirectionIngress,
+		InterfaceCountDirections: map[uint32]string{
+			3: config.DirectionEgress,
+		},
+	}
+	nfs := &NetflowServer{
+		Output:          make(chan *netflow.Flow, 10),
+		sampleRateCache: srcache.New(nil),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+			AgentsByIP: map[string]*config.Agent{
+				agent.IPAddress: agent,
+			},
+		},
+	}
+
+	tmpl := &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 256},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.InputSnmp, Length: 4},
+			{Type: nf9.OutputSnmp, Length: 4},
+			{Type: nf9.Direction, Length: 1},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		intIn    byte
+		intOut   byte
+		egress   byte
+		expected bool
+	}{
+		{
+			name:     "Ingress",
+			intIn:    1,
+			intOut:   2,
+			expected: true,
+		},
+		{
+			name:   "Egress",
+			intIn:  1,
+			intOut: 2,
+			egress: 1,
+		},
+		{
+			name:     "Egress on egress interface",
+			intIn:    1,
+			intOut:   3,
+			egress:   1,
+			expected: true,
+		},
+		{
+			name:   "Ingress on egress interface",
+			intIn:  3,
+			intOut: 1,
+		},
+	}
+
+	for _, test := range tests {
+		records := []nf9.FlowDataRecord{{Values: [][]byte{{test.intIn, 0, 0, 0}, {test.intOut, 0, 0, 0}, {test.egress}}}}
+		nfs.processFlowSet(tmpl, records, net.IP{192, 0, 2, 1}, 0, &nf9.Packet{Header: &nf9.Header{}})
+		assert.Equal(t, test.expected, len(nfs.Output) == 1, test.name)
+		if len(nfs.Output) == 1 {
+			fl := <-nfs.Output
+			assert.Equal(t, uint32(test.egress), fl.Direction, test.name)
+		}
+	}
+
+	// Flows of templates without direction are counted regardless of the policy
+	agent.CountDirection = config.DirectionEgress
+	tmpl = &nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 257},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.InputSnmp, Length: 4},
+			{Type: nf9.OutputSnmp, Length: 4},
+		},
+	}
+	records := []nf9.FlowDataRecord{{Values: [][]byte{{1, 0, 0, 0}, {2, 0, 0, 0}}}}
+	nfs.processFlowSet(tmpl, records, net.IP{192, 0, 2, 1}, 0, &nf9.Packet{Header: &nf9.Header{}})
+	assert.Equal(t, 1, len(nfs.Output), "No direction")
+}
+
+func TestSwitchedToUnixMilli(t *testing.T) {
+	tests := []struct {
+		name     string
+		hdr      *nf9.Header
+		switched uint32
+		expected uint64
+	}{
+		{
+			name: "Regular",
+			hdr: &nf9.Header{
+				UnixSecs:  1000,
+				SysUpTime: 50000,
+			},
+			switched: 20000,
+			expected: 970000,
+		},
+		{
+			name: "sysUpTime wrapped",
+			hdr: &nf9.Header{
+				UnixSecs:  1000,
+				SysUpTime: 1000,
+			},
+			switched: 4294967295 - 999,
+			expected: 998000,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, switchedToUnixMilli(test.hdr, test.switched), test.name)
+	}
+}
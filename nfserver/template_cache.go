@@ -12,34 +12,84 @@
 package nfserver
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/bio-routing/tflow2/nf9"
+	"github.com/bio-routing/tflow2/pending"
+	"github.com/pkg/errors"
 )
 
+// Template is the serializable representation of a cached template
+type Template struct {
+	Router     string  `json:"router"`
+	SourceID   uint32  `json:"source_id"`
+	TemplateID uint16  `json:"template_id"`
+	LastSeen   int64   `json:"last_seen"`
+	Options    bool    `json:"options,omitempty"`
+	Scopes     []Field `json:"scopes,omitempty"`
+	Fields     []Field `json:"fields"`
+}
+
+// Field is the serializable representation of a template field
+type Field struct {
+	Type   uint16 `json:"type"`
+	Length uint16 `json:"length"`
+}
+
+type templateCacheEntry struct {
+	records  nf9.TemplateRecords
+	lastSeen time.Time
+}
+
 type templateCache struct {
-	cache map[uint32]map[uint32]map[uint16]nf9.TemplateRecords
+	cache map[string]map[uint32]map[uint16]*templateCacheEntry
 	lock  sync.RWMutex
+
+	// timeout is the time after which a template not refreshed by the exporter expires (0 = never)
+	timeout time.Duration
+
+	// dirty is set when the cache has been modified since it was last saved
+	dirty bool
+
+	// pending holds data sets received before their template (nil = data sets are not held)
+	pending *pending.Queue
 }
 
 // newTemplateCache creates and initializes a new `templateCache` instance
-func newTemplateCache() *templateCache {
-	return &templateCache{cache: make(map[uint32]map[uint32]map[uint16]nf9.TemplateRecords)}
+func newTemplateCache(timeout time.Duration) *templateCache {
+	return &templateCache{
+		cache:   make(map[string]map[uint32]map[uint16]*templateCacheEntry),
+		timeout: timeout,
+	}
 }
 
-func (c *templateCache) set(rtr uint32, sourceID uint32, templateID uint16, records nf9.TemplateRecords) {
+func (c *templateCache) set(rtr string, sourceID uint32, templateID uint16, records nf9.TemplateRecords) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	c.setEntry(rtr, sourceID, templateID, &templateCacheEntry{
+		records:  records,
+		lastSeen: time.Now(),
+	})
+}
+
+// setEntry adds `entry` to the cache. Caller must hold the write lock.
+func (c *templateCache) setEntry(rtr string, sourceID uint32, templateID uint16, entry *templateCacheEntry) {
 	if _, ok := c.cache[rtr]; !ok {
-		c.cache[rtr] = make(map[uint32]map[uint16]nf9.TemplateRecords)
+		c.cache[rtr] = make(map[uint32]map[uint16]*templateCacheEntry)
 	}
 	if _, ok := c.cache[rtr][sourceID]; !ok {
-		c.cache[rtr][sourceID] = make(map[uint16]nf9.TemplateRecords)
+		c.cache[rtr][sourceID] = make(map[uint16]*templateCacheEntry)
 	}
-	c.cache[rtr][sourceID][templateID] = records
+	c.cache[rtr][sourceID][templateID] = entry
+	c.dirty = true
 }
 
-func (c *templateCache) get(rtr uint32, sourceID uint32, templateID uint16) *nf9.TemplateRecords {
+func (c *templateCache) get(rtr string, sourceID uint32, templateID uint16) *nf9.TemplateRecords {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	if _, ok := c.cache[rtr]; !ok {
@@ -48,9 +98,182 @@ func (c *templateCache) get(rtr uint32, sourceID uint32, templateID uint16) *nf9
 	if _, ok := c.cache[rtr][sourceID]; !ok {
 		return nil
 	}
-	if _, ok := c.cache[rtr][sourceID][templateID]; !ok {
+	entry, ok := c.cache[rtr][sourceID][templateID]
+	if !ok || c.expired(entry, time.Now()) {
 		return nil
 	}
-	ret := c.cache[rtr][sourceID][templateID]
+	ret := entry.records
 	return &ret
 }
+
+// expired checks if `entry` has expired at time `now`
+func (c *templateCache) expired(entry *templateCacheEntry, now time.Time) bool {
+	return c.timeout > 0 && now.Sub(entry.lastSeen) > c.timeout
+}
+
+// expire removes all expired templates and returns the number of templates removed
+func (c *templateCache) expire() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	count := 0
+	for rtr, domains := range c.cache {
+		for sourceID, templates := range domains {
+			for templateID, entry := range templates {
+				if c.expired(entry, now) {
+					delete(templates, templateID)
+					count++
+				}
+			}
+			if len(templates) == 0 {
+				delete(domains, sourceID)
+			}
+		}
+		if len(domains) == 0 {
+			delete(c.cache, rtr)
+		}
+	}
+
+	if count > 0 {
+		c.dirty = true
+	}
+	return count
+}
+
+// templates returns all templates in the cache ordered by router, domain and template ID
+func (c *templateCache) templates() []Template {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	res := make([]Template, 0)
+	for rtr, domains := range c.cache {
+		for sourceID, templates := range domains {
+			for templateID, entry := range templates {
+				t := Template{
+					Router:     rtr,
+					SourceID:   sourceID,
+					TemplateID: templateID,
+					LastSeen:   entry.lastSeen.Unix(),
+					Fields:     make([]Field, 0, len(entry.records.Records)),
+				}
+				for _, rec := range entry.records.Records {
+					t.Fields = append(t.Fields, Field{
+						Type:   rec.Type,
+						Length: rec.Length,
+					})
+				}
+				if entry.records.OptionScopes != nil {
+					t.Options = true
+					for _, scope := range entry.records.OptionScopes {
+						t.Scopes = append(t.Scopes, Field{
+							Type:   scope.ScopeFieldType,
+							Length: scope.ScopeFieldLength,
+						})
+					}
+				}
+				res = append(res, t)
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Router != res[j].Router {
+			return res[i].Router < res[j].Router
+		}
+		if res[i].SourceID != res[j].SourceID {
+			return res[i].SourceID < res[j].SourceID
+		}
+		return res[i].TemplateID < res[j].TemplateID
+	})
+
+	return res
+}
+
+// save writes the cache to `filename` if it has been modified since it was last saved
+func (c *templateCache) save(filename string) error {
+	c.lock.Lock()
+	dirty := c.dirty
+	c.dirty = false
+	c.lock.Unlock()
+
+	if !dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.templates())
+	if err != nil {
+		return errors.Wrap(err, "Unable to marshal templates")
+	}
+
+	// Write to a temporary file first so a crash can not leave a truncated file behind
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write %s", tmp)
+	}
+
+	err = os.Rename(tmp, filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to rename %s", tmp)
+	}
+
+	return nil
+}
+
+// load reads templates saved by save() from `filename`. Expired templates are skipped.
+func (c *templateCache) load(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", filename)
+	}
+
+	templates := make([]Template, 0)
+	err = json.Unmarshal(data, &templates)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", filename)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for _, t := range templates {
+		entry := &templateCacheEntry{
+			records: nf9.TemplateRecords{
+				Header: &nf9.TemplateRecordHeader{
+					TemplateID: t.TemplateID,
+					FieldCount: uint16(len(t.Fields)),
+				},
+				Records: make([]*nf9.TemplateRecord, 0, len(t.Fields)),
+			},
+			lastSeen: time.Unix(t.LastSeen, 0),
+		}
+
+		if c.expired(entry, now) {
+			continue
+		}
+
+		for _, f := range t.Fields {
+			entry.records.Records = append(entry.records.Records, &nf9.TemplateRecord{
+				Type:   f.Type,
+				Length: f.Length,
+			})
+		}
+
+		if t.Options {
+			entry.records.OptionScopes = make([]*nf9.OptionScope, 0, len(t.Scopes))
+			for _, f := range t.Scopes {
+				entry.records.OptionScopes = append(entry.records.OptionScopes, &nf9.OptionScope{
+					ScopeFieldType:   f.Type,
+					ScopeFieldLength: f.Length,
+				})
+			}
+		}
+
+		c.setEntry(t.Router, t.SourceID, t.TemplateID, entry)
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/nf9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tflow2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, templateFileName)
+
+	data := nf9.TemplateRecords{
+		Header: &nf9.TemplateRecordHeader{TemplateID: 256, FieldCount: 1},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.IPv4SrcAddr, Length: 4},
+		},
+	}
+	options := nf9.TemplateRecords{
+		Header:       &nf9.TemplateRecordHeader{TemplateID: 257},
+		OptionScopes: []*nf9.OptionScope{{ScopeFieldType: 1, ScopeFieldLength: 4}},
+		Records: []*nf9.TemplateRecord{
+			{Type: nf9.SamplingInterval, Length: 4},
+		},
+	}
+
+	c := newTemplateCache(time.Minute)
+	c.set("10.0.0.1", 1, 256, data)
+	c.set("10.0.0.1", 1, 257, options)
+	c.set("10.0.0.1", 1, 258, data)
+	c.cache["10.0.0.1"][1][258].lastSeen = time.Now().Add(-2 * time.Minute)
+
+	if !assert.NoError(t, c.save(filename)) {
+		return
+	}
+
+	restored := newTemplateCache(time.Minute)
+	if !assert.NoError(t, restored.load(filename)) {
+		return
+	}
+
+	assert.Equal(t, 2, len(restored.templates()))
+
+	tmpl := restored.get("10.0.0.1", 1, 256)
+	if assert.NotNil(t, tmpl) {
+		assert.Nil(t, tmpl.OptionScopes)
+		assert.Equal(t, data.Records, tmpl.Records)
+	}
+
+	tmpl = restored.get("10.0.0.1", 1, 257)
+	if assert.NotNil(t, tmpl) {
+		assert.Equal(t, options.OptionScopes, tmpl.OptionScopes)
+		assert.Equal(t, options.Records, tmpl.Records)
+	}
+
+	assert.Nil(t, restored.get("10.0.0.1", 1, 258))
+}
@@ -10,15 +10,25 @@ var (
 	SizeOfDot1Q = unsafe.Sizeof(Dot1Q{})
 )
 
-// Dot1Q represents an 802.1q header
+// Dot1Q represents an 802.1q (or 802.1ad) header
 type Dot1Q struct {
 	EtherType uint16
 	TCI       uint16
 }
 
+// VLANID returns the VLAN ID of the tag
+func (d *Dot1Q) VLANID() uint16 {
+	return d.TCI & 0xfff
+}
+
+// Priority returns the 802.1p priority of the tag
+func (d *Dot1Q) Priority() uint8 {
+	return uint8(d.TCI >> 13)
+}
+
 // DecodeDot1Q decodes an 802.1q header
 func DecodeDot1Q(raw unsafe.Pointer, length uint32) (*Dot1Q, error) {
-	if SizeOfEthernetII > uintptr(length) {
+	if SizeOfDot1Q > uintptr(length) {
 		return nil, fmt.Errorf("Frame is too short: %d", length)
 	}
 
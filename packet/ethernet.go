@@ -34,6 +34,9 @@ const (
 
 	// EtherTypeIEEE8021Q is VLAN-tagged frame (IEEE 802.1Q) EtherType value
 	EtherTypeIEEE8021Q = 0x8100
+
+	// EtherTypeIEEE8021AD is Service VLAN tag identifier (IEEE 802.1ad, QinQ) EtherType value
+	EtherTypeIEEE8021AD = 0x88A8
 )
 
 var (
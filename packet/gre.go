@@ -0,0 +1,71 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// GRE IP protocol number
+	GRE = 47
+
+	// EtherTypeTransparentEthernetBridging is the GRE protocol type of encapsulated ethernet frames
+	EtherTypeTransparentEthernetBridging = 0x6558
+
+	greChecksumPresent = 0x8000
+	greKeyPresent      = 0x2000
+	greSequencePresent = 0x1000
+)
+
+var (
+	// SizeOfGREHeader is the size of a GRE header without optional fields in bytes
+	SizeOfGREHeader = unsafe.Sizeof(GREHeader{})
+)
+
+// GREHeader represents a GRE header
+type GREHeader struct {
+	ProtocolType uint16
+	FlagsVersion uint16
+}
+
+// HeaderLength returns the length of the GRE header including optional fields
+func (g *GREHeader) HeaderLength() uint32 {
+	l := uint32(SizeOfGREHeader)
+	if g.FlagsVersion&greChecksumPresent != 0 {
+		l += 4
+	}
+	if g.FlagsVersion&greKeyPresent != 0 {
+		l += 4
+	}
+	if g.FlagsVersion&greSequencePresent != 0 {
+		l += 4
+	}
+
+	return l
+}
+
+// DecodeGRE decodes a GRE header
+func DecodeGRE(raw unsafe.Pointer, length uint32) (*GREHeader, error) {
+	if SizeOfGREHeader > uintptr(length) {
+		return nil, errors.Errorf("Frame is too short: %d", length)
+	}
+
+	gre := (*GREHeader)(unsafe.Pointer(uintptr(raw) - SizeOfGREHeader))
+	if gre.HeaderLength() > length {
+		return nil, errors.Errorf("Frame is too short: %d", length)
+	}
+
+	return gre, nil
+}
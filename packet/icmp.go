@@ -0,0 +1,47 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ICMP IP protocol number
+	ICMP = 1
+
+	// ICMPv6 IP protocol number
+	ICMPv6 = 58
+)
+
+var (
+	// SizeOfICMPHeader is the size of an ICMP header in bytes
+	SizeOfICMPHeader = unsafe.Sizeof(ICMPHeader{})
+)
+
+// ICMPHeader represents an ICMP (or ICMPv6) header
+type ICMPHeader struct {
+	Checksum uint16
+	Code     uint8
+	Type     uint8
+}
+
+// DecodeICMP decodes an ICMP header
+func DecodeICMP(raw unsafe.Pointer, length uint32) (*ICMPHeader, error) {
+	if SizeOfICMPHeader > uintptr(length) {
+		return nil, errors.Errorf("Frame is too short: %d", length)
+	}
+
+	return (*ICMPHeader)(unsafe.Pointer(uintptr(raw) - SizeOfICMPHeader)), nil
+}
@@ -33,6 +33,11 @@ type IPv4Header struct {
 	VersionHeaderLength uint8
 }
 
+// HeaderLength returns the length of the IPv4 header including options
+func (h *IPv4Header) HeaderLength() uint32 {
+	return uint32(h.VersionHeaderLength&0xf) * 4
+}
+
 func DecodeIPv4(raw unsafe.Pointer, length uint32) (*IPv4Header, error) {
 	if SizeOfIPv4Header > uintptr(length) {
 		return nil, errors.Errorf("Frame is too short: %d", length)
@@ -0,0 +1,106 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EtherTypeMPLSUnicast is MPLS unicast EtherType value
+	EtherTypeMPLSUnicast = 0x8847
+
+	// EtherTypeMPLSMulticast is MPLS multicast EtherType value
+	EtherTypeMPLSMulticast = 0x8848
+)
+
+var (
+	// SizeOfMPLSHeader is the size of an MPLS label stack entry in bytes
+	SizeOfMPLSHeader = unsafe.Sizeof(MPLSHeader{})
+)
+
+// MPLSHeader represents an MPLS label stack entry
+type MPLSHeader struct {
+	LabelStackEntry uint32
+}
+
+// Label returns the label value of the label stack entry
+func (m *MPLSHeader) Label() uint32 {
+	return m.LabelStackEntry >> 12
+}
+
+// TrafficClass returns the traffic class of the label stack entry
+func (m *MPLSHeader) TrafficClass() uint8 {
+	return uint8(m.LabelStackEntry>>9) & 0x7
+}
+
+// BottomOfStack returns true if this is the last entry of the label stack
+func (m *MPLSHeader) BottomOfStack() bool {
+	return m.LabelStackEntry&0x100 != 0
+}
+
+// TTL returns the TTL of the label stack entry
+func (m *MPLSHeader) TTL() uint8 {
+	return uint8(m.LabelStackEntry)
+}
+
+// DecodeMPLS decodes a single MPLS label stack entry
+func DecodeMPLS(raw unsafe.Pointer, length uint32) (*MPLSHeader, error) {
+	if SizeOfMPLSHeader > uintptr(length) {
+		return nil, errors.Errorf("Frame is too short: %d", length)
+	}
+
+	return (*MPLSHeader)(unsafe.Pointer(uintptr(raw) - SizeOfMPLSHeader)), nil
+}
+
+// DecodeMPLSStack decodes all MPLS label stack entries up to and including the bottom of stack
+func DecodeMPLSStack(raw unsafe.Pointer, length uint32) ([]*MPLSHeader, error) {
+	stack := make([]*MPLSHeader, 0)
+	for {
+		hdr, err := DecodeMPLS(raw, length)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to decode label stack entry")
+		}
+		stack = append(stack, hdr)
+
+		if hdr.BottomOfStack() {
+			return stack, nil
+		}
+
+		raw = unsafe.Pointer(uintptr(raw) - SizeOfMPLSHeader)
+		length -= uint32(SizeOfMPLSHeader)
+	}
+}
+
+// IPVersion returns the IP version of the IP header at `raw`. MPLS doesn't carry information
+// about the payload so this is used to guess the payloads type.
+func IPVersion(raw unsafe.Pointer, length uint32) uint8 {
+	if length == 0 {
+		return 0
+	}
+
+	return *(*uint8)(unsafe.Pointer(uintptr(raw) - 1)) >> 4
+}
+
+// LabelFromStackSection returns the label of the first label stack entry of an MPLS label stack section as
+// exported in NetFlow v9 and IPFIX records. Like all decoded record values `section` is in reversed byte order.
+// Label stack entries in these records are 3 bytes long (label, traffic class and bottom of stack bit, no TTL).
+func LabelFromStackSection(section []byte) uint32 {
+	if len(section) < 3 {
+		return 0
+	}
+
+	entry := section[len(section)-3:]
+	return (uint32(entry[2])<<16 | uint32(entry[1])<<8 | uint32(entry[0])) >> 4
+}
@@ -12,6 +12,8 @@
 package packet
 
 import (
+	"strconv"
+	"strings"
 	"unsafe"
 
 	"github.com/pkg/errors"
@@ -21,6 +23,21 @@ const (
 	TCP = 6
 )
 
+// TCP flags as found in the TCP header (and the tcpControlBits information element)
+const (
+	TCPFlagFIN = 1 << iota
+	TCPFlagSYN
+	TCPFlagRST
+	TCPFlagPSH
+	TCPFlagACK
+	TCPFlagURG
+	TCPFlagECE
+	TCPFlagCWR
+	TCPFlagNS
+)
+
+var tcpFlagNames = []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR", "NS"}
+
 var (
 	SizeOfTCPHeader = unsafe.Sizeof(TCPHeader{})
 )
@@ -44,3 +61,43 @@ func DecodeTCP(raw unsafe.Pointer, length uint32) (*TCPHeader, error) {
 
 	return (*TCPHeader)(unsafe.Pointer(uintptr(raw) - SizeOfTCPHeader)), nil
 }
+
+// TCPFlagsString formats TCP flags as a list of flag names separated by pipes, e.g. "SYN|ACK"
+func TCPFlagsString(flags uint16) string {
+	names := make([]string, 0)
+	for i, name := range tcpFlagNames {
+		if flags&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "0"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ParseTCPFlags parses TCP flags given either as number or as list of flag names separated by pipes, e.g. "SYN|ACK"
+func ParseTCPFlags(s string) (uint16, error) {
+	if v, err := strconv.ParseUint(s, 0, 16); err == nil {
+		return uint16(v), nil
+	}
+
+	flags := uint16(0)
+	for _, name := range strings.Split(s, "|") {
+		found := false
+		for i, n := range tcpFlagNames {
+			if strings.EqualFold(n, strings.TrimSpace(name)) {
+				flags |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.Errorf("invalid TCP flag: %s", name)
+		}
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package packet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPFlags(t *testing.T) {
+	assert.Equal(t, "0", TCPFlagsString(0))
+	assert.Equal(t, "SYN", TCPFlagsString(TCPFlagSYN))
+	assert.Equal(t, "SYN|ACK", TCPFlagsString(TCPFlagSYN|TCPFlagACK))
+
+	tests := []struct {
+		input    string
+		expected uint16
+		wantErr  bool
+	}{
+		{input: "18", expected: TCPFlagSYN | TCPFlagACK},
+		{input: "0x12", expected: TCPFlagSYN | TCPFlagACK},
+		{input: "SYN", expected: TCPFlagSYN},
+		{input: "syn|ack", expected: TCPFlagSYN | TCPFlagACK},
+		{input: "SYN|FOO", wantErr: true},
+	}
+
+	for _, test := range tests {
+		flags, err := ParseTCPFlags(test.input)
+		if test.wantErr {
+			assert.Error(t, err, test.input)
+			continue
+		}
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, flags, test.input)
+	}
+}
@@ -37,7 +37,7 @@ type UDPHeader struct {
 
 // DecodeUDP decodes a UDP header
 func DecodeUDP(raw unsafe.Pointer, length uint32) (*UDPHeader, error) {
-	if SizeOfTCPHeader > uintptr(length) {
+	if SizeOfUDPHeader > uintptr(length) {
 		return nil, errors.Errorf("Frame is too short: %d", length)
 	}
 
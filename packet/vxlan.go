@@ -0,0 +1,50 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// VXLANPort is the IANA assigned UDP port of VXLAN
+	VXLANPort = 4789
+)
+
+var (
+	// SizeOfVXLANHeader is the size of a VXLAN header in bytes
+	SizeOfVXLANHeader = unsafe.Sizeof(VXLANHeader{})
+)
+
+// VXLANHeader represents a VXLAN header
+type VXLANHeader struct {
+	Reserved2 uint8
+	VNIBytes  [3]byte
+	Reserved1 [3]byte
+	Flags     uint8
+}
+
+// VNI returns the VXLAN network identifier
+func (v *VXLANHeader) VNI() uint32 {
+	return uint32(v.VNIBytes[2])<<16 | uint32(v.VNIBytes[1])<<8 | uint32(v.VNIBytes[0])
+}
+
+// DecodeVXLAN decodes a VXLAN header
+func DecodeVXLAN(raw unsafe.Pointer, length uint32) (*VXLANHeader, error) {
+	if SizeOfVXLANHeader > uintptr(length) {
+		return nil, errors.Errorf("Frame is too short: %d", length)
+	}
+
+	return (*VXLANHeader)(unsafe.Pointer(uintptr(raw) - SizeOfVXLANHeader)), nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pending holds NetFlow v9/IPFIX data sets received before their template
+package pending
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/stats"
+)
+
+// Key identifies the template a data set is waiting for
+type Key struct {
+	Agent      string
+	SourceID   uint32
+	TemplateID uint16
+}
+
+type entry struct {
+	item  interface{}
+	added time.Time
+}
+
+// Queue holds data sets per Key until their template arrives. A nil *Queue holds nothing.
+type Queue struct {
+	// maxSets is the maximum number of data sets held per Key
+	maxSets int
+
+	// maxAge is the maximum time a data set is held
+	maxAge time.Duration
+
+	queues map[Key][]entry
+	lock   sync.Mutex
+}
+
+// New creates a new queue holding up to `maxSets` data sets per Key for at most `maxAge`
+func New(maxSets int, maxAge time.Duration) *Queue {
+	return &Queue{
+		maxSets: maxSets,
+		maxAge:  maxAge,
+		queues:  make(map[Key][]entry),
+	}
+}
+
+// Add holds `item` until the template identified by `k` arrives. If the queue for `k` is full
+// the oldest item is dropped.
+func (q *Queue) Add(k Key, item interface{}) {
+	if q == nil || q.maxSets <= 0 {
+		return
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entries := q.queues[k]
+	if len(entries) >= q.maxSets {
+		entries = entries[1:]
+		atomic.AddUint64(&stats.GlobalStats.PendingSetsDropped, 1)
+	}
+
+	q.queues[k] = append(entries, entry{
+		item:  item,
+		added: time.Now(),
+	})
+	atomic.AddUint64(&stats.GlobalStats.PendingSetsQueued, 1)
+}
+
+// Take removes and returns all items waiting for the template identified by `k` in the order they were added
+func (q *Queue) Take(k Key) []interface{} {
+	if q == nil {
+		return nil
+	}
+
+	q.lock.Lock()
+	entries, ok := q.queues[k]
+	delete(q.queues, k)
+	q.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	items := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		if q.expired(e, now) {
+			atomic.AddUint64(&stats.GlobalStats.PendingSetsExpired, 1)
+			continue
+		}
+		items = append(items, e.item)
+	}
+
+	atomic.AddUint64(&stats.GlobalStats.PendingSetsReplayed, uint64(len(items)))
+	return items
+}
+
+// Expire removes all items held for longer than the maximum age and returns the number of items removed
+func (q *Queue) Expire() int {
+	if q == nil {
+		return 0
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := time.Now()
+	count := 0
+	for k, entries := range q.queues {
+		// Entries are ordered by age, so only a prefix can be expired
+		i := 0
+		for i < len(entries) && q.expired(entries[i], now) {
+			i++
+		}
+
+		count += i
+		if i == len(entries) {
+			delete(q.queues, k)
+			continue
+		}
+		q.queues[k] = entries[i:]
+	}
+
+	atomic.AddUint64(&stats.GlobalStats.PendingSetsExpired, uint64(count))
+	return count
+}
+
+// Len returns the number of items held
+func (q *Queue) Len() int {
+	if q == nil {
+		return 0
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	n := 0
+	for _, entries := range q.queues {
+		n += len(entries)
+	}
+	return n
+}
+
+func (q *Queue) expired(e entry, now time.Time) bool {
+	return now.Sub(e.added) > q.maxAge
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pending
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	k1 := Key{Agent: "10.0.0.1", SourceID: 1, TemplateID: 256}
+	k2 := Key{Agent: "10.0.0.1", SourceID: 2, TemplateID: 256}
+
+	q := New(2, time.Minute)
+	q.Add(k1, 1)
+	q.Add(k1, 2)
+	q.Add(k1, 3) // Drops 1
+	q.Add(k2, 4)
+	assert.Equal(t, 3, q.Len())
+
+	assert.Equal(t, []interface{}{2, 3}, q.Take(k1))
+	assert.Nil(t, q.Take(k1))
+	assert.Equal(t, 1, q.Len())
+
+	// Expire removes old items only
+	q.Add(k2, 5)
+	q.queues[k2][0].added = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, 1, q.Expire())
+	assert.Equal(t, []interface{}{5}, q.Take(k2))
+
+	// Take skips expired items
+	q.Add(k1, 6)
+	q.Add(k1, 7)
+	q.queues[k1][0].added = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, []interface{}{7}, q.Take(k1))
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueueDisabled(t *testing.T) {
+	k := Key{Agent: "10.0.0.1", SourceID: 1, TemplateID: 256}
+
+	var nilQueue *Queue
+	nilQueue.Add(k, 1)
+	assert.Nil(t, nilQueue.Take(k))
+	assert.Equal(t, 0, nilQueue.Expire())
+
+	q := New(0, time.Minute)
+	q.Add(k, 1)
+	assert.Nil(t, q.Take(k))
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seqtrack tracks export sequence numbers to detect and account for lost export packets
+package seqtrack
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+)
+
+const (
+	// UnknownCount is passed to Update if the number of units in a packet is unknown
+	// (e.g. an IPFIX message containing data sets without template)
+	UnknownCount = -1
+
+	// reorderWindow is the maximum distance (in units) a sequence number may jump backwards
+	// to be considered reordered. Larger backward jumps are considered resets of the exporter.
+	reorderWindow = 1 << 10
+
+	// resetThreshold is the minimum distance (in units) a sequence number must jump forward
+	// to be considered a reset of the exporter rather than loss
+	resetThreshold = 1 << 20
+
+	// lossWindow is the number of units the loss ratio used for compensation is measured over
+	lossWindow = 1000
+)
+
+// Key identifies a sequence number space of an agent
+type Key struct {
+	Agent    string
+	SourceID uint32
+}
+
+// state is the sequence number state of a Key
+type state struct {
+	// next is the sequence number expected next
+	next uint32
+
+	// synced is set if `next` is known
+	synced bool
+
+	// received and lost are the units received and lost in the current loss window
+	received uint64
+	lost     uint64
+
+	// factor is the volume compensation factor measured in the last complete loss window
+	factor float64
+
+	// carry is the fraction of the compensated samplerate not applied to the last flow yet
+	carry float64
+
+	stats *stats.AgentStats
+}
+
+// Tracker tracks sequence numbers of export packets
+type Tracker struct {
+	states     map[Key]*state
+	names      map[string]string
+	compensate map[string]bool
+	lock       sync.RWMutex
+}
+
+// New creates a new Tracker and initializes it with the agents from the config
+func New(agents []config.Agent) *Tracker {
+	t := &Tracker{
+		states:     make(map[Key]*state),
+		names:      make(map[string]string),
+		compensate: make(map[string]bool),
+	}
+
+	for _, a := range agents {
+		addr := net.ParseIP(a.IPAddress).String()
+		t.names[addr] = a.Name
+		t.compensate[addr] = a.CompensateLoss
+	}
+
+	return t
+}
+
+// Update records the receipt of an export packet of `agent` for source ID/observation domain/sub agent
+// `sourceID` with sequence number `seq` carrying `count` units (e.g. 1 for a NetFlow v9 packet or the number of data
+// records of an IPFIX message). A nil *Tracker tracks nothing.
+func (t *Tracker) Update(agent net.IP, sourceID uint32, seq uint32, count int) {
+	if t == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s := t.state(agent, sourceID)
+	next, synced := s.next, s.synced
+	if count == UnknownCount {
+		s.synced = false
+	} else {
+		s.next = seq + uint32(count)
+		s.synced = true
+	}
+
+	units := uint64(0)
+	if count > 0 {
+		units = uint64(count)
+	}
+	atomic.AddUint64(&s.stats.SequenceReceived, units)
+
+	if !synced {
+		s.account(units, 0)
+		return
+	}
+
+	// Distances are calculated modulo 2^32 so wrapping sequence numbers are handled
+	gap := seq - next
+	switch {
+	case gap == 0:
+		s.account(units, 0)
+	case gap < resetThreshold:
+		atomic.AddUint64(&s.stats.SequenceGaps, 1)
+		atomic.AddUint64(&s.stats.SequenceLost, uint64(gap))
+		s.account(units, uint64(gap))
+	case next-seq <= reorderWindow:
+		// A late packet does not move the expected sequence number. Its units have been
+		// counted as lost when the gap was detected.
+		atomic.AddUint64(&s.stats.SequenceReorders, 1)
+		s.next, s.synced = next, true
+		if s.lost >= units {
+			s.lost -= units
+		}
+		s.account(units, 0)
+	default:
+		atomic.AddUint64(&s.stats.SequenceResets, 1)
+		s.account(units, 0)
+	}
+}
+
+// state returns the state of `agent`/`sourceID`. Caller must hold the lock.
+func (t *Tracker) state(agent net.IP, sourceID uint32) *state {
+	addr := agent.String()
+	k := Key{Agent: addr, SourceID: sourceID}
+	s, ok := t.states[k]
+	if !ok {
+		s = &state{
+			factor: 1,
+			stats:  stats.Agent(addr, t.names[addr]),
+		}
+		t.states[k] = s
+	}
+	return s
+}
+
+// account adds `received` and `lost` units to the current loss window of `s`
+func (s *state) account(received uint64, lost uint64) {
+	s.received += received
+	s.lost += lost
+
+	total := s.received + s.lost
+	if total < lossWindow {
+		return
+	}
+
+	if s.received > 0 {
+		s.factor = float64(total) / float64(s.received)
+	}
+	s.received = 0
+	s.lost = 0
+}
+
+// Factor returns the factor volumes of `agent`/`sourceID` are to be multiplied with to compensate
+// the loss measured in the last complete loss window
+func (t *Tracker) Factor(agent net.IP, sourceID uint32) float64 {
+	if t == nil {
+		return 1
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	s, ok := t.states[Key{Agent: agent.String(), SourceID: sourceID}]
+	if !ok {
+		return 1
+	}
+	return s.factor
+}
+
+// Compensate scales up the samplerate of `fl` by the loss measured for `sourceID` of the agent that exported `fl`,
+// if loss compensation is enabled for the agent. The fraction lost by rounding the samplerate is carried over
+// to the next flow, so flows of few packets are compensated as well.
+func (t *Tracker) Compensate(fl *netflow.Flow, sourceID uint32) {
+	if t == nil || fl.Samplerate == 0 || !t.compensate[net.IP(fl.Router).String()] {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s, ok := t.states[Key{Agent: net.IP(fl.Router).String(), SourceID: sourceID}]
+	if !ok || s.factor == 1 {
+		return
+	}
+
+	rate := float64(fl.Samplerate)*s.factor + s.carry
+	fl.Samplerate = uint64(rate)
+	s.carry = rate - float64(fl.Samplerate)
+}
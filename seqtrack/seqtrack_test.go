@@ -0,0 +1,171 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seqtrack
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name         string
+		updates      [][2]int // sequence number, count
+		wantReceived uint64
+		wantLost     uint64
+		wantGaps     uint64
+		wantResets   uint64
+		wantReorders uint64
+	}{
+		{
+			name:         "In order",
+			updates:      [][2]int{{10, 1}, {11, 1}, {12, 1}},
+			wantReceived: 3,
+		},
+		{
+			name:         "Gap",
+			updates:      [][2]int{{10, 5}, {15, 5}, {30, 5}},
+			wantReceived: 15,
+			wantLost:     10,
+			wantGaps:     1,
+		},
+		{
+			name:         "Wrap around",
+			updates:      [][2]int{{4294967294, 1}, {4294967295, 1}, {0, 1}, {2, 1}},
+			wantReceived: 4,
+			wantLost:     1,
+			wantGaps:     1,
+		},
+		{
+			name:         "Reorder",
+			updates:      [][2]int{{10, 1}, {12, 1}, {11, 1}, {13, 1}},
+			wantReceived: 4,
+			wantLost:     1,
+			wantGaps:     1,
+			wantReorders: 1,
+		},
+		{
+			name:         "Reset",
+			updates:      [][2]int{{100000, 1}, {100001, 1}, {0, 1}, {1, 1}},
+			wantReceived: 4,
+			wantResets:   1,
+		},
+		{
+			name:         "Unknown count",
+			updates:      [][2]int{{10, 1}, {11, UnknownCount}, {20, 1}, {21, 1}},
+			wantReceived: 3,
+		},
+	}
+
+	for i, test := range tests {
+		agent := net.IP{192, 0, 2, byte(i + 1)}
+		tr := New(nil)
+		for _, u := range test.updates {
+			tr.Update(agent, 1, uint32(u[0]), u[1])
+		}
+
+		s := stats.Agent(agent.String(), "")
+		assert.Equal(t, test.wantReceived, s.SequenceReceived, test.name)
+		assert.Equal(t, test.wantLost, s.SequenceLost, test.name)
+		assert.Equal(t, test.wantGaps, s.SequenceGaps, test.name)
+		assert.Equal(t, test.wantResets, s.SequenceResets, test.name)
+		assert.Equal(t, test.wantReorders, s.SequenceReorders, test.name)
+	}
+}
+
+func TestCompensate(t *testing.T) {
+	agent := net.IP{198, 51, 100, 1}
+	tr := New([]config.Agent{
+		{
+			Name:           "rtr01",
+			IPAddress:      "198.51.100.1",
+			CompensateLoss: true,
+		},
+	})
+
+	// Every fifth packet is lost
+	seq := uint32(0)
+	for i := 0; i < lossWindow; i++ {
+		if i%5 == 3 {
+			seq++
+			continue
+		}
+		tr.Update(agent, 0, seq, 1)
+		seq++
+	}
+	assert.Equal(t, 1.25, tr.Factor(agent, 0))
+	assert.Equal(t, 1.0, tr.Factor(agent, 1))
+
+	fl := &netflow.Flow{
+		Router:     agent,
+		Size:       1000,
+		Packets:    4,
+		Samplerate: 4,
+	}
+	tr.Compensate(fl, 0)
+	assert.Equal(t, uint64(1000), fl.Size)
+	assert.Equal(t, uint64(4), fl.Packets)
+	assert.Equal(t, uint64(5), fl.Samplerate)
+
+	// Agents without loss compensation are not scaled
+	other := net.IP{198, 51, 100, 2}
+	tr.Update(other, 0, 0, 1)
+	tr.Update(other, 0, lossWindow, 1)
+	fl = &netflow.Flow{
+		Router:     other,
+		Size:       1000,
+		Samplerate: 1,
+	}
+	tr.Compensate(fl, 0)
+	assert.Equal(t, uint64(1), fl.Samplerate)
+}
+
+func TestCompensateSmallFlows(t *testing.T) {
+	agent := net.IP{198, 51, 100, 1}
+	tr := New([]config.Agent{
+		{
+			Name:           "rtr01",
+			IPAddress:      "198.51.100.1",
+			CompensateLoss: true,
+		},
+	})
+
+	// Every eleventh packet is lost
+	seq := uint32(0)
+	for i := 0; i < lossWindow; i++ {
+		if i%11 == 5 {
+			seq++
+			continue
+		}
+		tr.Update(agent, 0, seq, 1)
+		seq++
+	}
+	assert.InDelta(t, 1.1, tr.Factor(agent, 0), 0.001)
+
+	// Single packet samples are scaled up in total although each is scaled by less than 1.5
+	packets := uint64(0)
+	for i := 0; i < 1000; i++ {
+		fl := &netflow.Flow{
+			Router:     agent,
+			Packets:    1,
+			Samplerate: 1,
+		}
+		tr.Compensate(fl, 0)
+		packets += fl.Packets * fl.Samplerate
+	}
+	assert.InDelta(t, 1100, float64(packets), 1)
+}
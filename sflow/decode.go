@@ -22,12 +22,23 @@ import (
 )
 
 const (
-	dataFlowSample     = 1
-	dataCounterSample  = 2
-	standardSflow      = 0
-	rawPacketHeader    = 1
-	extendedSwitchData = 1001
-	extendedRouterData = 1002
+	dataFlowSample            = 1
+	dataCounterSample         = 2
+	expandedDataFlowSample    = 3
+	expandedDataCounterSample = 4
+	standardSflow             = 0
+	rawPacketHeader           = 1
+	extendedSwitchData        = 1001
+	extendedRouterData        = 1002
+	extendedGatewayData       = 1003
+	genericInterfaceCounters  = 1
+)
+
+// Header protocols of raw packet headers
+const (
+	HeaderProtocolEthernet = 1
+	HeaderProtocolIPv4     = 11
+	HeaderProtocolIPv6     = 12
 )
 
 // errorIncompatibleVersion prints an error message in case the detected version is not supported
@@ -40,28 +51,23 @@ func Decode(raw []byte, remote net.IP) (*Packet, error) {
 	data := convert.Reverse(raw) //TODO: Make it endian aware. This assumes a little endian machine
 
 	pSize := len(data)
-	bufSize := 1500
-	buffer := [1500]byte{}
-
-	if pSize > bufSize {
-		panic("Buffer too small\n")
+	if pSize < int(sizeOfHeaderTop) {
+		return nil, errors.Errorf("Packet too short: %d bytes", pSize)
 	}
 
-	// copy data into array as arrays allow us to cast the shit out of it
-	for i := 0; i < pSize; i++ {
-		buffer[bufSize-pSize+i] = data[i]
-	}
+	// copy data into a buffer of it's own as the decoded packet keeps pointers into it
+	buffer := make([]byte, pSize)
+	copy(buffer, data)
 
-	bufferPtr := unsafe.Pointer(&buffer)
-	//bufferMinPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(bufSize) - uintptr(pSize))
-	headerPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(bufSize) - uintptr(sizeOfHeaderTop))
+	bufferPtr := unsafe.Pointer(&buffer[0])
+	headerPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(pSize) - uintptr(sizeOfHeaderTop))
 
 	var p Packet
-	p.Buffer = buffer[:]
+	p.Buffer = buffer
 	p.headerTop = (*headerTop)(headerPtr)
 
 	if p.headerTop.Version != 5 {
-		return nil, errorIncompatibleVersion(p.Header.Version)
+		return nil, errorIncompatibleVersion(p.headerTop.Version)
 	}
 
 	agentAddressLen := uint64(0)
@@ -74,7 +80,11 @@ func Decode(raw []byte, remote net.IP) (*Packet, error) {
 		agentAddressLen = 16
 	}
 
-	headerBottomPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(bufSize) - uintptr(sizeOfHeaderTop) - uintptr(agentAddressLen) - uintptr(sizeOfHeaderBottom))
+	if uint64(pSize) < uint64(sizeOfHeaderTop)+agentAddressLen+uint64(sizeOfHeaderBottom) {
+		return nil, errors.Errorf("Packet too short: %d bytes", pSize)
+	}
+
+	headerBottomPtr := unsafe.Pointer(uintptr(bufferPtr) + uintptr(pSize) - uintptr(sizeOfHeaderTop) - uintptr(agentAddressLen) - uintptr(sizeOfHeaderBottom))
 	p.headerBottom = (*headerBottom)(headerBottomPtr)
 
 	h := Header{
@@ -88,11 +98,10 @@ func Decode(raw []byte, remote net.IP) (*Packet, error) {
 	}
 	p.Header = &h
 
-	flowSamples, err := decodeFlows(headerBottomPtr, h.NumSamples)
+	err := decodeSamples(&p, headerBottomPtr, h.NumSamples)
 	if err != nil {
-		return nil, errors.Wrap(err, "Unable to dissect flows")
+		return nil, errors.Wrap(err, "Unable to dissect samples")
 	}
-	p.FlowSamples = flowSamples
 
 	return &p, nil
 }
@@ -101,58 +110,170 @@ func extractEnterpriseFormat(sfType uint32) (sfTypeEnterprise uint32, sfTypeForm
 	return sfType >> 12, sfType & 0xfff
 }
 
-func decodeFlows(samplesPtr unsafe.Pointer, NumSamples uint32) ([]*FlowSample, error) {
-	flowSamples := make([]*FlowSample, 0)
+func decodeSamples(p *Packet, samplesPtr unsafe.Pointer, NumSamples uint32) error {
+	// Samples are read backwards from the end of the buffer, so the bytes left are those below samplesPtr
+	remaining := uint64(uintptr(samplesPtr) - uintptr(unsafe.Pointer(&p.Buffer[0])))
+
+	p.FlowSamples = make([]*FlowSample, 0)
 	for i := uint32(0); i < NumSamples; i++ {
+		if remaining < 8 {
+			return errors.Errorf("Sample %d exceeds packet: %d bytes left", i, remaining)
+		}
+
 		sfTypeEnterprise, sfTypeFormat := extractEnterpriseFormat(*(*uint32)(unsafe.Pointer(uintptr(samplesPtr) - uintptr(4))))
 
-		if sfTypeEnterprise != 0 {
-			return nil, errors.Errorf("Unknown Enterprise: %d", sfTypeEnterprise)
+		sampleLengthPtr := unsafe.Pointer(uintptr(samplesPtr) - uintptr(8))
+		sampleLength := uint64(*(*uint32)(sampleLengthPtr)) + 8
+		if sampleLength > remaining {
+			return errors.Errorf("Sample %d of %d bytes exceeds packet: %d bytes left", i, sampleLength, remaining)
 		}
 
-		sampleLengthPtr := unsafe.Pointer(uintptr(samplesPtr) - uintptr(8))
-		sampleLength := *(*uint32)(sampleLengthPtr)
+		if sfTypeEnterprise != standardSflow {
+			// Skip vendor specific samples
+			samplesPtr = unsafe.Pointer(uintptr(samplesPtr) - uintptr(sampleLength))
+			remaining -= sampleLength
+			continue
+		}
+
+		switch sfTypeFormat {
+		case dataFlowSample:
+			fs, err := decodeFlowSample(samplesPtr, sampleLength)
+			if err != nil {
+				return errors.Wrap(err, "Unable to decode flow sample")
+			}
+			p.FlowSamples = append(p.FlowSamples, fs)
 
-		if sfTypeFormat == dataFlowSample {
-			fs, err := decodeFlowSample(samplesPtr)
+		case expandedDataFlowSample:
+			fs, err := decodeExpandedFlowSample(samplesPtr, sampleLength)
 			if err != nil {
-				return nil, errors.Wrap(err, "Unable to decode flow sample")
+				return errors.Wrap(err, "Unable to decode expanded flow sample")
 			}
-			flowSamples = append(flowSamples, fs)
+			p.FlowSamples = append(p.FlowSamples, fs)
+
+		case dataCounterSample:
+			cs, err := decodeCounterSample(samplesPtr, sampleLength)
+			if err != nil {
+				return errors.Wrap(err, "Unable to decode counter sample")
+			}
+			p.CounterSamples = append(p.CounterSamples, cs)
+
+		case expandedDataCounterSample:
+			cs, err := decodeExpandedCounterSample(samplesPtr, sampleLength)
+			if err != nil {
+				return errors.Wrap(err, "Unable to decode expanded counter sample")
+			}
+			p.CounterSamples = append(p.CounterSamples, cs)
 		}
 
-		samplesPtr = unsafe.Pointer(uintptr(samplesPtr) - uintptr(sampleLength+8))
+		samplesPtr = unsafe.Pointer(uintptr(samplesPtr) - uintptr(sampleLength))
+		remaining -= sampleLength
 	}
 
-	return flowSamples, nil
+	return nil
 }
 
-func decodeFlowSample(flowSamplePtr unsafe.Pointer) (*FlowSample, error) {
+func decodeFlowSample(flowSamplePtr unsafe.Pointer, sampleLength uint64) (*FlowSample, error) {
+	if sampleLength < uint64(sizeOfFlowSampleHeader) {
+		return nil, errors.Errorf("Flow sample too short: %d bytes", sampleLength)
+	}
+
 	flowSamplePtr = unsafe.Pointer(uintptr(flowSamplePtr) - uintptr(sizeOfFlowSampleHeader))
 	fsh := (*FlowSampleHeader)(flowSamplePtr)
 
+	fs, err := decodeFlowRecords(fsh, flowSamplePtr, sampleLength-uint64(sizeOfFlowSampleHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	fs.SourceIDType = fsh.SourceIDClassIndex >> 24
+	fs.SourceIDIndex = fsh.SourceIDClassIndex & 0xffffff
+	return fs, nil
+}
+
+// decodeExpandedFlowSample decodes an expanded flow sample. The expanded header is
+// converted into a FlowSampleHeader so consumers don't have to distinguish both formats.
+// The 32 bit source ID type and index don't fit SourceIDClassIndex and are only set on the FlowSample.
+func decodeExpandedFlowSample(flowSamplePtr unsafe.Pointer, sampleLength uint64) (*FlowSample, error) {
+	if sampleLength < uint64(sizeOfExpandedFlowSampleHeader) {
+		return nil, errors.Errorf("Expanded flow sample too short: %d bytes", sampleLength)
+	}
+
+	flowSamplePtr = unsafe.Pointer(uintptr(flowSamplePtr) - uintptr(sizeOfExpandedFlowSampleHeader))
+	efsh := (*ExpandedFlowSampleHeader)(flowSamplePtr)
+
+	fsh := &FlowSampleHeader{
+		FlowRecord:     efsh.FlowRecord,
+		OutputIf:       efsh.OutputIfValue,
+		InputIf:        efsh.InputIfValue,
+		DroppedPackets: efsh.DroppedPackets,
+		SamplePool:     efsh.SamplePool,
+		SamplingRate:   efsh.SamplingRate,
+		SequenceNumber: efsh.SequenceNumber,
+		SampleLength:   efsh.SampleLength,
+		EnterpriseType: efsh.EnterpriseType,
+	}
+
+	fs, err := decodeFlowRecords(fsh, flowSamplePtr, sampleLength-uint64(sizeOfExpandedFlowSampleHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	fs.SourceIDType = efsh.SourceIDType
+	fs.SourceIDIndex = efsh.SourceIDIndex
+	return fs, nil
+}
+
+// decodeFlowRecords decodes the flow records following the flow sample header `fsh`
+// within the `remaining` bytes of the sample
+func decodeFlowRecords(fsh *FlowSampleHeader, flowSamplePtr unsafe.Pointer, remaining uint64) (*FlowSample, error) {
 	var rph *RawPacketHeader
 	var rphd unsafe.Pointer
 	var erd *ExtendedRouterData
+	var esd *ExtendedSwitchData
+	var egd *ExtendedGatewayData
 
 	for i := uint32(0); i < fsh.FlowRecord; i++ {
+		if remaining < 8 {
+			return nil, errors.Errorf("Flow record %d exceeds sample: %d bytes left", i, remaining)
+		}
+
 		sfTypeEnterprise, sfTypeFormat := extractEnterpriseFormat(*(*uint32)(unsafe.Pointer(uintptr(flowSamplePtr) - uintptr(4))))
 		flowDataLength := *(*uint32)(unsafe.Pointer(uintptr(flowSamplePtr) - uintptr(8)))
+		recordLength := uint64(flowDataLength) + 8
+		if recordLength > remaining {
+			return nil, errors.Errorf("Flow record %d of %d bytes exceeds sample: %d bytes left", i, recordLength, remaining)
+		}
 
 		if sfTypeEnterprise == standardSflow {
 			var err error
 			switch sfTypeFormat {
 			case rawPacketHeader:
+				if recordLength < uint64(sizeOfRawPacketHeader) {
+					return nil, errors.Errorf("Raw packet header too short: %d bytes", recordLength)
+				}
 				rph = decodeRawPacketHeader(flowSamplePtr)
+				if uint64(rph.OriginalPacketLength) > recordLength-uint64(sizeOfRawPacketHeader) {
+					return nil, errors.Errorf("Raw packet header length %d exceeds record of %d bytes", rph.OriginalPacketLength, recordLength)
+				}
 				rphd = unsafe.Pointer(uintptr(flowSamplePtr) - sizeOfRawPacketHeader)
 
 			case extendedRouterData:
-				erd, err = decodeExtendRouterData(flowSamplePtr)
+				erd, err = decodeExtendRouterData(flowSamplePtr, recordLength)
 				if err != nil {
 					return nil, errors.Wrap(err, "Unable to decide extended router data")
 				}
 
 			case extendedSwitchData:
+				if recordLength < uint64(sizeOfExtendedSwitchData) {
+					return nil, errors.Errorf("Extended switch data too short: %d bytes", recordLength)
+				}
+				esd = decodeExtendedSwitchData(flowSamplePtr)
+
+			case extendedGatewayData:
+				egd, err = decodeExtendedGatewayData(flowSamplePtr)
+				if err != nil {
+					return nil, errors.Wrap(err, "Unable to decode extended gateway data")
+				}
 
 			default:
 				log.Infof("Unknown sfTypeFormat\n")
@@ -160,27 +281,108 @@ func decodeFlowSample(flowSamplePtr unsafe.Pointer) (*FlowSample, error) {
 
 		}
 
-		flowSamplePtr = unsafe.Pointer(uintptr(flowSamplePtr) - uintptr(8) - uintptr(flowDataLength))
+		flowSamplePtr = unsafe.Pointer(uintptr(flowSamplePtr) - uintptr(recordLength))
+		remaining -= recordLength
 	}
 
 	fs := &FlowSample{
-		FlowSampleHeader:   fsh,
-		RawPacketHeader:    rph,
-		Data:               rphd,
-		DataLen:            rph.OriginalPacketLength,
-		ExtendedRouterData: erd,
+		FlowSampleHeader:    fsh,
+		RawPacketHeader:     rph,
+		Data:                rphd,
+		ExtendedRouterData:  erd,
+		ExtendedSwitchData:  esd,
+		ExtendedGatewayData: egd,
+	}
+
+	if rph != nil {
+		fs.DataLen = rph.OriginalPacketLength
 	}
 
 	return fs, nil
 }
 
+func decodeCounterSample(counterSamplePtr unsafe.Pointer, sampleLength uint64) (*CounterSample, error) {
+	if sampleLength < uint64(sizeOfCounterSampleHeader) {
+		return nil, errors.Errorf("Counter sample too short: %d bytes", sampleLength)
+	}
+
+	counterSamplePtr = unsafe.Pointer(uintptr(counterSamplePtr) - uintptr(sizeOfCounterSampleHeader))
+	csh := (*CounterSampleHeader)(counterSamplePtr)
+
+	cs := &CounterSample{
+		SequenceNumber: csh.SequenceNumber,
+		SourceIDType:   csh.SourceIDClassIndex >> 24,
+		SourceIDIndex:  csh.SourceIDClassIndex & 0xffffff,
+	}
+
+	err := decodeCounterRecords(cs, counterSamplePtr, csh.CounterRecords, sampleLength-uint64(sizeOfCounterSampleHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+func decodeExpandedCounterSample(counterSamplePtr unsafe.Pointer, sampleLength uint64) (*CounterSample, error) {
+	if sampleLength < uint64(sizeOfExpandedCounterSampleHeader) {
+		return nil, errors.Errorf("Expanded counter sample too short: %d bytes", sampleLength)
+	}
+
+	counterSamplePtr = unsafe.Pointer(uintptr(counterSamplePtr) - uintptr(sizeOfExpandedCounterSampleHeader))
+	csh := (*ExpandedCounterSampleHeader)(counterSamplePtr)
+
+	cs := &CounterSample{
+		SequenceNumber: csh.SequenceNumber,
+		SourceIDType:   csh.SourceIDType,
+		SourceIDIndex:  csh.SourceIDIndex,
+	}
+
+	err := decodeCounterRecords(cs, counterSamplePtr, csh.CounterRecords, sampleLength-uint64(sizeOfExpandedCounterSampleHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// decodeCounterRecords decodes the counter records of counter sample `cs` within the `remaining` bytes of the sample
+func decodeCounterRecords(cs *CounterSample, recordPtr unsafe.Pointer, numRecords uint32, remaining uint64) error {
+	for i := uint32(0); i < numRecords; i++ {
+		if remaining < 8 {
+			return errors.Errorf("Counter record %d exceeds sample: %d bytes left", i, remaining)
+		}
+
+		sfTypeEnterprise, sfTypeFormat := extractEnterpriseFormat(*(*uint32)(unsafe.Pointer(uintptr(recordPtr) - uintptr(4))))
+		counterDataLength := uint64(*(*uint32)(unsafe.Pointer(uintptr(recordPtr) - uintptr(8))))
+		if counterDataLength+8 > remaining {
+			return errors.Errorf("Counter record %d of %d bytes exceeds sample: %d bytes left", i, counterDataLength+8, remaining)
+		}
+
+		if sfTypeEnterprise == standardSflow && sfTypeFormat == genericInterfaceCounters {
+			if counterDataLength < uint64(sizeOfGenericInterfaceCounters) {
+				return errors.Errorf("Generic interface counters too short: %d bytes", counterDataLength)
+			}
+			cs.GenericInterfaceCounters = (*GenericInterfaceCounters)(unsafe.Pointer(uintptr(recordPtr) - uintptr(8) - sizeOfGenericInterfaceCounters))
+		}
+
+		recordPtr = unsafe.Pointer(uintptr(recordPtr) - uintptr(8) - uintptr(counterDataLength))
+		remaining -= counterDataLength + 8
+	}
+
+	return nil
+}
+
 func decodeRawPacketHeader(rphPtr unsafe.Pointer) *RawPacketHeader {
 	rphPtr = unsafe.Pointer(uintptr(rphPtr) - uintptr(sizeOfRawPacketHeader))
 	rph := (*RawPacketHeader)(rphPtr)
 	return rph
 }
 
-func decodeExtendRouterData(erhPtr unsafe.Pointer) (*ExtendedRouterData, error) {
+func decodeExtendRouterData(erhPtr unsafe.Pointer, recordLength uint64) (*ExtendedRouterData, error) {
+	if recordLength < uint64(sizeOfextendedRouterDataTop) {
+		return nil, errors.Errorf("Extended router data too short: %d bytes", recordLength)
+	}
+
 	erhTopPtr := unsafe.Pointer(uintptr(erhPtr) - uintptr(sizeOfextendedRouterDataTop))
 	erhTop := (*extendedRouterDataTop)(erhTopPtr)
 
@@ -194,7 +396,11 @@ func decodeExtendRouterData(erhPtr unsafe.Pointer) (*ExtendedRouterData, error)
 		addressLen = 16
 	}
 
-	erhBottomPtr := unsafe.Pointer(uintptr(erhTopPtr) - uintptr(sizeOfextendedRouterDataBottom) - uintptr(addressLen) - uintptr(sizeOfextendedRouterDataBottom))
+	if recordLength < uint64(sizeOfextendedRouterDataTop)+addressLen+uint64(sizeOfextendedRouterDataBottom) {
+		return nil, errors.Errorf("Extended router data too short: %d bytes", recordLength)
+	}
+
+	erhBottomPtr := unsafe.Pointer(uintptr(erhTopPtr) - uintptr(addressLen) - uintptr(sizeOfextendedRouterDataBottom))
 	erhBottom := (*extendedRouterDataBottom)(erhBottomPtr)
 
 	return &ExtendedRouterData{
@@ -207,6 +413,104 @@ func decodeExtendRouterData(erhPtr unsafe.Pointer) (*ExtendedRouterData, error)
 	}, nil
 }
 
+func decodeExtendedSwitchData(esdPtr unsafe.Pointer) *ExtendedSwitchData {
+	esdPtr = unsafe.Pointer(uintptr(esdPtr) - uintptr(sizeOfExtendedSwitchData))
+	return (*ExtendedSwitchData)(esdPtr)
+}
+
+func decodeExtendedGatewayData(egdPtr unsafe.Pointer) (*ExtendedGatewayData, error) {
+	egd := &ExtendedGatewayData{
+		EnterpriseType: *(*uint32)(unsafe.Pointer(uintptr(egdPtr) - uintptr(4))),
+		FlowDataLength: *(*uint32)(unsafe.Pointer(uintptr(egdPtr) - uintptr(8))),
+	}
+
+	r := &reader{
+		ptr:       unsafe.Pointer(uintptr(egdPtr) - uintptr(8)),
+		remaining: egd.FlowDataLength,
+	}
+	egd.AddressType = r.uint32()
+
+	addressLen := uint32(0)
+	switch egd.AddressType {
+	default:
+		return nil, errors.Errorf("Unknown AgentAddressType %d", egd.AddressType)
+	case 1:
+		addressLen = 4
+	case 2:
+		addressLen = 16
+	}
+
+	if !r.skip(addressLen) {
+		return nil, errors.Errorf("Extended gateway data too short")
+	}
+	egd.NextHop = getNetIP(unsafe.Pointer(uintptr(r.ptr)+uintptr(addressLen)), uint64(addressLen))
+
+	egd.AS = r.uint32()
+	egd.SrcAS = r.uint32()
+	egd.SrcPeerAS = r.uint32()
+
+	numSegments := r.uint32()
+	for i := uint32(0); i < numSegments && !r.exceeded; i++ {
+		seg := ASPathSegment{
+			Type: r.uint32(),
+		}
+		numASNs := r.uint32()
+		if numASNs > r.remaining/4 {
+			return nil, errors.Errorf("Invalid AS path segment length %d", numASNs)
+		}
+
+		seg.ASNs = make([]uint32, numASNs)
+		for j := range seg.ASNs {
+			seg.ASNs[j] = r.uint32()
+		}
+		egd.ASPath = append(egd.ASPath, seg)
+	}
+
+	numCommunities := r.uint32()
+	if numCommunities > r.remaining/4 {
+		return nil, errors.Errorf("Invalid number of communities %d", numCommunities)
+	}
+	egd.Communities = make([]uint32, numCommunities)
+	for i := range egd.Communities {
+		egd.Communities[i] = r.uint32()
+	}
+
+	egd.LocalPref = r.uint32()
+
+	if r.exceeded {
+		return nil, errors.Errorf("Extended gateway data too short")
+	}
+
+	return egd, nil
+}
+
+// reader reads consecutive 32 bit values from a reversed buffer.
+// It makes sure no more than `remaining` bytes are consumed.
+type reader struct {
+	ptr       unsafe.Pointer
+	remaining uint32
+	exceeded  bool
+}
+
+func (r *reader) skip(n uint32) bool {
+	if n > r.remaining {
+		r.exceeded = true
+		return false
+	}
+	r.remaining -= n
+
+	r.ptr = unsafe.Pointer(uintptr(r.ptr) - uintptr(n))
+	return true
+}
+
+func (r *reader) uint32() uint32 {
+	if r.exceeded || !r.skip(4) {
+		return 0
+	}
+
+	return *(*uint32)(r.ptr)
+}
+
 func getNetIP(headerPtr unsafe.Pointer, addressLen uint64) net.IP {
 	ptr := unsafe.Pointer(uintptr(headerPtr) - uintptr(1))
 	addr := make([]byte, addressLen)
@@ -130,3 +130,486 @@ func testEq(a, b []byte) bool {
 
 	return true
 }
+
+func TestDecodeCounterSamples(t *testing.T) {
+	genericCounters := []byte{
+		0, 0, 0, 1, // Enterprise/Type (Generic interface counters)
+		0, 0, 0, 88, // Flow Data Length
+		0, 0, 0, 23, // ifIndex
+		0, 0, 0, 6, // ifType
+		0, 0, 0, 2, 0x54, 0x0b, 0xe4, 0, // ifSpeed (10G)
+		0, 0, 0, 1, // ifDirection
+		0, 0, 0, 3, // ifStatus
+		0, 0, 0, 1, 0, 0, 0, 0, // ifInOctets
+		0, 0, 0, 10, // ifInUcastPkts
+		0, 0, 0, 11, // ifInMulticastPkts
+		0, 0, 0, 12, // ifInBroadcastPkts
+		0, 0, 0, 13, // ifInDiscards
+		0, 0, 0, 14, // ifInErrors
+		0, 0, 0, 15, // ifInUnknownProtos
+		0, 0, 0, 0, 0, 0, 0x10, 0, // ifOutOctets
+		0, 0, 0, 20, // ifOutUcastPkts
+		0, 0, 0, 21, // ifOutMulticastPkts
+		0, 0, 0, 22, // ifOutBroadcastPkts
+		0, 0, 0, 23, // ifOutDiscards
+		0, 0, 0, 24, // ifOutErrors
+		0, 0, 0, 0, // ifPromiscuousMode
+	}
+
+	s := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 1, // Agent Address Type
+		10, 205, 19, 14, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 222, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+		0, 0, 0, 2, // NumSamples
+
+		0, 0, 0, 2, // Enterprise/Type (Counter sample)
+		0, 0, 0, 108, // Sample length
+		0, 0, 0, 7, // Sequence Number
+		0, 0, 0, 23, // Source ID + Index
+		0, 0, 0, 1, // Counter Record count
+	}
+	s = append(s, genericCounters...)
+	s = append(s, []byte{
+		0, 0, 0, 4, // Enterprise/Type (Expanded counter sample)
+		0, 0, 0, 112, // Sample length
+		0, 0, 0, 8, // Sequence Number
+		0, 0, 0, 0, // Source ID Type
+		0, 0, 0, 23, // Source ID Index
+		0, 0, 0, 1, // Counter Record count
+	}...)
+	s = append(s, genericCounters...)
+
+	packet, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	if err != nil {
+		t.Fatalf("Decoding packet failed: %v\n", err)
+	}
+
+	if len(packet.CounterSamples) != 2 {
+		t.Fatalf("Unexpected number of counter samples: %d", len(packet.CounterSamples))
+	}
+
+	for _, cs := range packet.CounterSamples {
+		if cs.SourceIDIndex != 23 {
+			t.Errorf("Unexpected SourceIDIndex: %d", cs.SourceIDIndex)
+		}
+
+		c := cs.GenericInterfaceCounters
+		if c == nil {
+			t.Fatalf("Generic interface counters missing")
+		}
+
+		if c.IfIndex != 23 || c.IfSpeed != 10000000000 || c.IfInOctets != 1<<32 || c.IfOutOctets != 4096 {
+			t.Errorf("Unexpected counters: %+v", *c)
+		}
+
+		if c.IfInErrors != 14 || c.IfOutDiscards != 23 {
+			t.Errorf("Unexpected counters: %+v", *c)
+		}
+	}
+}
+
+func TestDecodeExpandedFlowSamples(t *testing.T) {
+	s := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 1, // Agent Address Type
+		10, 205, 19, 14, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 223, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+		0, 0, 0, 2, // NumSamples
+
+		0, 0, 0x90, 0x01, // Enterprise/Type (Enterprise 9, Format 1)
+		0, 0, 0, 8, // Sample length
+		1, 2, 3, 4, 5, 6, 7, 8, // Vendor specific data
+
+		0, 0, 0, 3, // Enterprise/Type (Expanded flow sample)
+		0, 0, 0, 68, // Sample length
+		0, 0, 0, 9, // Sequence Number
+		0, 0, 0, 0, // Source ID Type
+		0x01, 0, 0, 42, // Source ID Index
+		0, 0, 0x10, 0, // Sampling Rate
+		0, 0, 0x20, 0, // Sample Pool
+		0, 0, 0, 5, // Dropped Packets
+		0, 0, 0, 0, // Input Interface Format
+		0, 0, 0, 42, // Input Interface Value
+		0, 0, 0, 0, // Output Interface Format
+		0, 0, 0, 43, // Output Interface Value
+		0, 0, 0, 1, // Flow Record count
+
+		0, 0, 0x03, 0xea, // Enterprise/Type (Extended router data)
+		0, 0, 0, 16, // Flow Data Length
+		0, 0, 0, 1, // Address Type
+		10, 0, 0, 1, // Next Hop
+		0, 0, 0, 24, // Source Mask
+		0, 0, 0, 16, // Destination Mask
+	}
+
+	packet, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	if err != nil {
+		t.Fatalf("Decoding packet failed: %v\n", err)
+	}
+
+	if len(packet.FlowSamples) != 1 {
+		t.Fatalf("Unexpected number of flow samples: %d", len(packet.FlowSamples))
+	}
+
+	fs := packet.FlowSamples[0]
+	if fs.FlowSampleHeader.SamplingRate != 4096 || fs.FlowSampleHeader.SamplePool != 8192 || fs.FlowSampleHeader.DroppedPackets != 5 {
+		t.Errorf("Unexpected flow sample header: %+v", *fs.FlowSampleHeader)
+	}
+
+	if fs.FlowSampleHeader.InputIf != 42 || fs.FlowSampleHeader.OutputIf != 43 {
+		t.Errorf("Unexpected interfaces: in=%d out=%d", fs.FlowSampleHeader.InputIf, fs.FlowSampleHeader.OutputIf)
+	}
+
+	if fs.FlowSampleHeader.SequenceNumber != 9 {
+		t.Errorf("Unexpected flow sample header: %+v", *fs.FlowSampleHeader)
+	}
+
+	if fs.SourceIDType != 0 || fs.SourceIDIndex != 0x0100002a {
+		t.Errorf("Unexpected source ID: type=%d index=%d", fs.SourceIDType, fs.SourceIDIndex)
+	}
+
+	if fs.RawPacketHeader != nil || fs.DataLen != 0 {
+		t.Errorf("Unexpected raw packet header")
+	}
+
+	if fs.ExtendedRouterData == nil {
+		t.Fatalf("Extended router data missing")
+	}
+
+	if !fs.ExtendedRouterData.NextHop.Equal(net.IP([]byte{10, 0, 0, 1})) {
+		t.Errorf("Unexpected next hop: %s", fs.ExtendedRouterData.NextHop)
+	}
+
+	if fs.ExtendedRouterData.NextHopSourceMask != 24 || fs.ExtendedRouterData.NextHopDestinationMask != 16 {
+		t.Errorf("Unexpected masks: src=%d dst=%d", fs.ExtendedRouterData.NextHopSourceMask, fs.ExtendedRouterData.NextHopDestinationMask)
+	}
+}
+
+func TestDecodeJumboIPv6Agent(t *testing.T) {
+	s := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 2, // Agent Address Type
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 224, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+		0, 0, 0, 1, // NumSamples
+
+		0, 0, 0x90, 0x01, // Enterprise/Type (Enterprise 9, Format 1)
+		0, 0, 0x1f, 0x40, // Sample length
+	}
+	s = append(s, make([]byte, 8000)...) // Vendor specific data
+
+	packet, err := Decode(s, net.ParseIP("2001:db8::2"))
+	if err != nil {
+		t.Fatalf("Decoding packet failed: %v\n", err)
+	}
+
+	if packet.Header.AgentAddress.String() != "2001:db8::1" {
+		t.Errorf("Incorrect AgentAddress: Exptected 2001:db8::1 got %s", packet.Header.AgentAddress.String())
+	}
+
+	if packet.Header.SequenceNumber != 224 {
+		t.Errorf("Unexpected sequence number: %d", packet.Header.SequenceNumber)
+	}
+}
+
+func TestDecodeShortPacket(t *testing.T) {
+	_, err := Decode([]byte{0, 0, 0, 5, 0, 0, 0, 2, 1, 2, 3, 4}, net.IP([]byte{1, 1, 1, 1}))
+	if err == nil {
+		t.Errorf("Expected error for truncated packet")
+	}
+}
+
+func TestDecodeExtendedSwitchGatewayData(t *testing.T) {
+	s := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 1, // Agent Address Type
+		10, 205, 19, 14, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 225, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+		0, 0, 0, 1, // NumSamples
+
+		0, 0, 0, 1, // Enterprise/Type (Flow sample)
+		0, 0, 0, 120, // Sample length
+		0, 0, 0, 10, // Sequence Number
+		0, 0, 0, 42, // Source ID + Index
+		0, 0, 0x10, 0, // Sampling Rate
+		0, 0, 0x20, 0, // Sample Pool
+		0, 0, 0, 0, // Dropped Packets
+		0, 0, 0, 42, // Input interface
+		0, 0, 0, 43, // Output interface
+		0, 0, 0, 2, // Flow Record count
+
+		0, 0, 0x03, 0xe9, // Enterprise/Type (Extended switch data)
+		0, 0, 0, 16, // Flow Data Length
+		0, 0, 0, 100, // VLAN IN
+		0, 0, 0, 1, // Priority IN
+		0, 0, 0, 200, // VLAN OUT
+		0, 0, 0, 2, // Priority OUT
+
+		0, 0, 0x03, 0xeb, // Enterprise/Type (Extended gateway data)
+		0, 0, 0, 56, // Flow Data Length
+		0, 0, 0, 1, // Address Type
+		192, 0, 2, 1, // Next Hop
+		0, 0, 0xfd, 0xe8, // AS (65000)
+		0, 0, 0xfd, 0xe9, // SRC AS (65001)
+		0, 0, 0xfd, 0xea, // SRC Peer AS (65002)
+		0, 0, 0, 1, // AS path segment count
+		0, 0, 0, 2, // Segment type (AS_SEQUENCE)
+		0, 0, 0, 2, // Segment length
+		0, 0, 0xfd, 0xeb, // AS 65003
+		0, 0, 0xfd, 0xec, // AS 65004
+		0, 0, 0, 2, // Community count
+		0xfd, 0xe8, 0, 1, // 65000:1
+		0xfd, 0xe8, 0, 2, // 65000:2
+		0, 0, 0, 100, // Local Pref
+	}
+
+	packet, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	if err != nil {
+		t.Fatalf("Decoding packet failed: %v\n", err)
+	}
+
+	if len(packet.FlowSamples) != 1 {
+		t.Fatalf("Unexpected number of flow samples: %d", len(packet.FlowSamples))
+	}
+
+	esd := packet.FlowSamples[0].ExtendedSwitchData
+	if esd == nil {
+		t.Fatalf("Extended switch data missing")
+	}
+
+	if esd.SourceVLAN != 100 || esd.SourcePriority != 1 || esd.DestinationVLAN != 200 || esd.DestinationPriority != 2 {
+		t.Errorf("Unexpected extended switch data: %+v", *esd)
+	}
+
+	egd := packet.FlowSamples[0].ExtendedGatewayData
+	if egd == nil {
+		t.Fatalf("Extended gateway data missing")
+	}
+
+	if !egd.NextHop.Equal(net.IP([]byte{192, 0, 2, 1})) {
+		t.Errorf("Unexpected next hop: %s", egd.NextHop)
+	}
+
+	if egd.AS != 65000 || egd.SrcAS != 65001 || egd.SrcPeerAS != 65002 || egd.LocalPref != 100 {
+		t.Errorf("Unexpected extended gateway data: %+v", *egd)
+	}
+
+	if egd.DstAS() != 65004 || egd.DstPeerAS() != 65003 {
+		t.Errorf("Unexpected DST AS %d / DST peer AS %d", egd.DstAS(), egd.DstPeerAS())
+	}
+
+	if len(egd.ASPath) != 1 || egd.ASPath[0].Type != ASSequence || !testEqUint32(egd.ASNs(), []uint32{65003, 65004}) {
+		t.Errorf("Unexpected AS path: %+v", egd.ASPath)
+	}
+
+	if !testEqUint32(egd.Communities, []uint32{65000<<16 + 1, 65000<<16 + 2}) {
+		t.Errorf("Unexpected communities: %v", egd.Communities)
+	}
+}
+
+func TestDecodeExtendedGatewayDataInvalid(t *testing.T) {
+	s := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 1, // Agent Address Type
+		10, 205, 19, 14, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 226, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+		0, 0, 0, 1, // NumSamples
+
+		0, 0, 0, 1, // Enterprise/Type (Flow sample)
+		0, 0, 0, 68, // Sample length
+		0, 0, 0, 10, // Sequence Number
+		0, 0, 0, 42, // Source ID + Index
+		0, 0, 0x10, 0, // Sampling Rate
+		0, 0, 0x20, 0, // Sample Pool
+		0, 0, 0, 0, // Dropped Packets
+		0, 0, 0, 42, // Input interface
+		0, 0, 0, 43, // Output interface
+		0, 0, 0, 1, // Flow Record count
+
+		0, 0, 0x03, 0xeb, // Enterprise/Type (Extended gateway data)
+		0, 0, 0, 28, // Flow Data Length
+		0, 0, 0, 1, // Address Type
+		192, 0, 2, 1, // Next Hop
+		0, 0, 0xfd, 0xe8, // AS (65000)
+		0, 0, 0xfd, 0xe9, // SRC AS (65001)
+		0, 0, 0xfd, 0xea, // SRC Peer AS (65002)
+		0, 0, 0, 1, // AS path segment count
+		0, 0, 0, 2, // Segment type (AS_SEQUENCE)
+	}
+
+	_, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	if err == nil {
+		t.Errorf("Expected error for truncated extended gateway data")
+	}
+}
+
+func TestDecodeTruncatedSamples(t *testing.T) {
+	header := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 1, // Agent Address Type
+		10, 205, 19, 14, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 227, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+	}
+
+	tests := []struct {
+		name    string
+		samples []byte
+	}{
+		{
+			name: "Vendor sample exceeding packet",
+			samples: []byte{
+				0, 0, 0, 2, // NumSamples
+				0, 0, 0x90, 0x01, // Enterprise/Type (Enterprise 9, format 1)
+				0xff, 0xff, 0xff, 0xf0, // Sample length
+				0, 0, 0, 0,
+			},
+		},
+		{
+			name: "Flow sample exceeding packet",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 1, // Enterprise/Type (Flow sample)
+				0, 0, 1, 0, // Sample length
+				0, 0, 0, 10, // Sequence Number
+			},
+		},
+		{
+			name: "Flow sample shorter than its header",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 1, // Enterprise/Type (Flow sample)
+				0, 0, 0, 4, // Sample length
+				0, 0, 0, 10, // Sequence Number
+			},
+		},
+		{
+			name: "Flow record exceeding sample",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 1, // Enterprise/Type (Flow sample)
+				0, 0, 0, 48, // Sample length
+				0, 0, 0, 10, // Sequence Number
+				0, 0, 0, 42, // Source ID + Index
+				0, 0, 0x10, 0, // Sampling Rate
+				0, 0, 0x20, 0, // Sample Pool
+				0, 0, 0, 0, // Dropped Packets
+				0, 0, 0, 42, // Input interface
+				0, 0, 0, 43, // Output interface
+				0, 0, 0, 2, // Flow Record count
+				0, 0, 0x03, 0xe9, // Enterprise/Type (Extended switch data)
+				0, 0, 0, 0xff, // Flow Data Length
+				0, 0, 0, 100, // VLAN IN
+				0, 0, 0, 1, // Priority IN
+			},
+		},
+		{
+			name: "Raw packet header exceeding record",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 1, // Enterprise/Type (Flow sample)
+				0, 0, 0, 60, // Sample length
+				0, 0, 0, 10, // Sequence Number
+				0, 0, 0, 42, // Source ID + Index
+				0, 0, 0x10, 0, // Sampling Rate
+				0, 0, 0x20, 0, // Sample Pool
+				0, 0, 0, 0, // Dropped Packets
+				0, 0, 0, 42, // Input interface
+				0, 0, 0, 43, // Output interface
+				0, 0, 0, 1, // Flow Record count
+				0, 0, 0, 1, // Enterprise/Type (Raw packet header)
+				0, 0, 0, 20, // Flow Data Length
+				0, 0, 0, 1, // Header Protocol
+				0, 0, 5, 0xdc, // Frame Length
+				0, 0, 0, 0, // Payload Removed
+				0, 0, 5, 0xdc, // Header Length
+				0, 0, 0, 0, // Header
+			},
+		},
+		{
+			name: "Extended router data shorter than its next hop",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 1, // Enterprise/Type (Flow sample)
+				0, 0, 0, 56, // Sample length
+				0, 0, 0, 10, // Sequence Number
+				0, 0, 0, 42, // Source ID + Index
+				0, 0, 0x10, 0, // Sampling Rate
+				0, 0, 0x20, 0, // Sample Pool
+				0, 0, 0, 0, // Dropped Packets
+				0, 0, 0, 42, // Input interface
+				0, 0, 0, 43, // Output interface
+				0, 0, 0, 1, // Flow Record count
+				0, 0, 0x03, 0xea, // Enterprise/Type (Extended router data)
+				0, 0, 0, 16, // Flow Data Length
+				0, 0, 0, 2, // Address Type
+				0x20, 0x01, 0x0d, 0xb8, // Next Hop
+				0, 0, 0, 24, // Source Mask
+				0, 0, 0, 16, // Destination Mask
+			},
+		},
+		{
+			name: "Counter record exceeding sample",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 2, // Enterprise/Type (Counter sample)
+				0, 0, 0, 20, // Sample length
+				0, 0, 0, 10, // Sequence Number
+				0, 0, 0, 42, // Source ID + Index
+				0, 0, 0, 1, // Counter Record count
+				0, 0, 0, 1, // Enterprise/Type (Generic interface counters)
+				0, 0, 0, 88, // Counter Data Length
+			},
+		},
+		{
+			name: "Generic interface counters too short",
+			samples: []byte{
+				0, 0, 0, 1, // NumSamples
+				0, 0, 0, 2, // Enterprise/Type (Counter sample)
+				0, 0, 0, 36, // Sample length
+				0, 0, 0, 10, // Sequence Number
+				0, 0, 0, 42, // Source ID + Index
+				0, 0, 0, 1, // Counter Record count
+				0, 0, 0, 1, // Enterprise/Type (Generic interface counters)
+				0, 0, 0, 16, // Counter Data Length
+				0, 0, 0, 42, // Interface Index
+				0, 0, 0, 6, // Interface Type
+				0, 0, 0, 0, // Interface Speed
+				0, 0, 0, 0,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Decode(append(append([]byte{}, header...), test.samples...), net.IP([]byte{1, 1, 1, 1}))
+		if err == nil {
+			t.Errorf("%s: Expected error for truncated sample", test.name)
+		}
+	}
+}
+
+func testEqUint32(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -26,6 +26,9 @@ type Packet struct {
 	// A slice of pointers to FlowSet. Each element is instance of (Data)FlowSet
 	FlowSamples []*FlowSample
 
+	// A slice of pointers to counter samples found in this packet
+	CounterSamples []*CounterSample
+
 	// Buffer is a slice pointing to the original byte array that this packet was decoded from.
 	// This field is only populated if debug level is at least 2
 	Buffer []byte
@@ -35,10 +38,16 @@ var (
 	sizeOfHeaderTop                = unsafe.Sizeof(headerTop{})
 	sizeOfHeaderBottom             = unsafe.Sizeof(headerBottom{})
 	sizeOfFlowSampleHeader         = unsafe.Sizeof(FlowSampleHeader{})
+	sizeOfExpandedFlowSampleHeader = unsafe.Sizeof(ExpandedFlowSampleHeader{})
 	sizeOfRawPacketHeader          = unsafe.Sizeof(RawPacketHeader{})
 	sizeofExtendedRouterData       = unsafe.Sizeof(ExtendedRouterData{})
 	sizeOfextendedRouterDataTop    = unsafe.Sizeof(extendedRouterDataTop{})
 	sizeOfextendedRouterDataBottom = unsafe.Sizeof(extendedRouterDataBottom{})
+	sizeOfExtendedSwitchData       = unsafe.Sizeof(ExtendedSwitchData{})
+
+	sizeOfCounterSampleHeader         = unsafe.Sizeof(CounterSampleHeader{})
+	sizeOfExpandedCounterSampleHeader = unsafe.Sizeof(ExpandedCounterSampleHeader{})
+	sizeOfGenericInterfaceCounters    = unsafe.Sizeof(GenericInterfaceCounters{})
 )
 
 // Header is an sflow version 5 header
@@ -66,11 +75,15 @@ type headerBottom struct {
 
 // FlowSample is an sflow version 5 flow sample
 type FlowSample struct {
-	FlowSampleHeader   *FlowSampleHeader
-	RawPacketHeader    *RawPacketHeader
-	Data               unsafe.Pointer
-	DataLen            uint32
-	ExtendedRouterData *ExtendedRouterData
+	SourceIDType        uint32
+	SourceIDIndex       uint32
+	FlowSampleHeader    *FlowSampleHeader
+	RawPacketHeader     *RawPacketHeader
+	Data                unsafe.Pointer
+	DataLen             uint32
+	ExtendedRouterData  *ExtendedRouterData
+	ExtendedSwitchData  *ExtendedSwitchData
+	ExtendedGatewayData *ExtendedGatewayData
 }
 
 // FlowSampleHeader is an sflow version 5 flow sample header
@@ -87,6 +100,23 @@ type FlowSampleHeader struct {
 	EnterpriseType     uint32
 }
 
+// ExpandedFlowSampleHeader is an sflow version 5 expanded flow sample header
+type ExpandedFlowSampleHeader struct {
+	FlowRecord     uint32
+	OutputIfValue  uint32
+	OutputIfFormat uint32
+	InputIfValue   uint32
+	InputIfFormat  uint32
+	DroppedPackets uint32
+	SamplePool     uint32
+	SamplingRate   uint32
+	SourceIDIndex  uint32
+	SourceIDType   uint32
+	SequenceNumber uint32
+	SampleLength   uint32
+	EnterpriseType uint32
+}
+
 // RawPacketHeader is a raw packet header
 type RawPacketHeader struct {
 	OriginalPacketLength uint32
@@ -117,3 +147,122 @@ type ExtendedRouterData struct {
 	FlowDataLength         uint32
 	EnterpriseType         uint32
 }
+
+// CounterSample is an sflow version 5 counter sample
+type CounterSample struct {
+	SequenceNumber           uint32
+	SourceIDType             uint32
+	SourceIDIndex            uint32
+	GenericInterfaceCounters *GenericInterfaceCounters
+}
+
+// CounterSampleHeader is an sflow version 5 counter sample header
+type CounterSampleHeader struct {
+	CounterRecords     uint32
+	SourceIDClassIndex uint32
+	SequenceNumber     uint32
+	SampleLength       uint32
+	EnterpriseType     uint32
+}
+
+// ExpandedCounterSampleHeader is an sflow version 5 expanded counter sample header
+type ExpandedCounterSampleHeader struct {
+	CounterRecords uint32
+	SourceIDIndex  uint32
+	SourceIDType   uint32
+	SequenceNumber uint32
+	SampleLength   uint32
+	EnterpriseType uint32
+}
+
+// GenericInterfaceCounters represents sflow version 5 generic interface counters (RFC 2233)
+type GenericInterfaceCounters struct {
+	IfPromiscuousMode  uint32
+	IfOutErrors        uint32
+	IfOutDiscards      uint32
+	IfOutBroadcastPkts uint32
+	IfOutMulticastPkts uint32
+	IfOutUcastPkts     uint32
+	IfOutOctets        uint64
+	IfInUnknownProtos  uint32
+	IfInErrors         uint32
+	IfInDiscards       uint32
+	IfInBroadcastPkts  uint32
+	IfInMulticastPkts  uint32
+	IfInUcastPkts      uint32
+	IfInOctets         uint64
+	IfStatus           uint32
+	IfDirection        uint32
+	IfSpeed            uint64
+	IfType             uint32
+	IfIndex            uint32
+}
+
+// ExtendedSwitchData represents sflow version 5 extended switch data
+type ExtendedSwitchData struct {
+	DestinationPriority uint32
+	DestinationVLAN     uint32
+	SourcePriority      uint32
+	SourceVLAN          uint32
+	FlowDataLength      uint32
+	EnterpriseType      uint32
+}
+
+// ExtendedGatewayData represents sflow version 5 extended gateway data
+type ExtendedGatewayData struct {
+	EnterpriseType uint32
+	FlowDataLength uint32
+	AddressType    uint32
+	NextHop        net.IP
+	AS             uint32
+	SrcAS          uint32
+	SrcPeerAS      uint32
+	ASPath         []ASPathSegment
+	Communities    []uint32
+	LocalPref      uint32
+}
+
+// ASPathSegment is a segment of an AS path
+type ASPathSegment struct {
+	Type uint32
+	ASNs []uint32
+}
+
+// AS path segment types
+const (
+	ASSet      = 1
+	ASSequence = 2
+)
+
+// DstAS returns the destination AS, which is the last AS in the AS path. In case the AS path is
+// empty the destination is the local AS.
+func (e *ExtendedGatewayData) DstAS() uint32 {
+	for i := len(e.ASPath) - 1; i >= 0; i-- {
+		if len(e.ASPath[i].ASNs) > 0 {
+			return e.ASPath[i].ASNs[len(e.ASPath[i].ASNs)-1]
+		}
+	}
+
+	return e.AS
+}
+
+// DstPeerAS returns the peer AS towards the destination, which is the first AS in the AS path
+func (e *ExtendedGatewayData) DstPeerAS() uint32 {
+	for _, seg := range e.ASPath {
+		if len(seg.ASNs) > 0 {
+			return seg.ASNs[0]
+		}
+	}
+
+	return 0
+}
+
+// ASNs returns all ASNs of the AS path in order
+func (e *ExtendedGatewayData) ASNs() []uint32 {
+	res := make([]uint32, 0)
+	for _, seg := range e.ASPath {
+		res = append(res, seg.ASNs...)
+	}
+
+	return res
+}
@@ -23,8 +23,10 @@ import (
 
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/ifcounters"
 	"github.com/bio-routing/tflow2/netflow"
 	"github.com/bio-routing/tflow2/packet"
+	"github.com/bio-routing/tflow2/seqtrack"
 	"github.com/bio-routing/tflow2/sflow"
 	"github.com/bio-routing/tflow2/srcache"
 	"github.com/bio-routing/tflow2/stats"
@@ -52,14 +54,21 @@ type SflowServer struct {
 	config *config.Config
 
 	sampleRateCache *srcache.SamplerateCache
+
+	// seqTracker tracks sequence numbers of export packets
+	seqTracker *seqtrack.Tracker
+
+	ifCounters *ifcounters.Cache
 }
 
 // New creates and starts a new `SflowServer` instance
-func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *SflowServer {
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache, seqTracker *seqtrack.Tracker, ifCounters *ifcounters.Cache) *SflowServer {
 	sfs := &SflowServer{
 		Output:          make(chan *netflow.Flow),
 		config:          config,
 		sampleRateCache: sampleRateCache,
+		seqTracker:      seqTracker,
+		ifCounters:      ifCounters,
 	}
 
 	addr, err := net.ResolveUDPAddr("udp", sfs.config.Sflow.Listen)
@@ -104,10 +113,8 @@ func (sfs *SflowServer) packetWorker(identity int, conn *net.UDPConn) {
 		atomic.AddUint64(&stats.GlobalStats.SflowPackets, 1)
 		atomic.AddUint64(&stats.GlobalStats.SflowBytes, uint64(length))
 
-		remote.IP = remote.IP.To4()
-		if remote.IP == nil {
-			log.Errorf("Received IPv6 packet. Dropped.")
-			continue
+		if ip4 := remote.IP.To4(); ip4 != nil {
+			remote.IP = ip4
 		}
 
 		sfs.processPacket(remote.IP, buffer[:length])
@@ -116,14 +123,21 @@ func (sfs *SflowServer) packetWorker(identity int, conn *net.UDPConn) {
 }
 
 // processPacket takes a raw sflow packet, send it to the decoder and passes the decoded packet
-func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
+func (sfs *SflowServer) processPacket(remote net.IP, buffer []byte) {
 	length := len(buffer)
-	p, err := sflow.Decode(buffer[:length], agent)
+	p, err := sflow.Decode(buffer[:length], remote)
 	if err != nil {
 		log.Errorf("sflow.Decode: %v", err)
 		return
 	}
 
+	agent := sfs.agentAddress(remote, p)
+
+	// Sequence numbers of sflow count datagrams per sub agent
+	sfs.seqTracker.Update(agent, p.Header.SubAgentID, p.Header.SequenceNumber, 1)
+
+	sfs.processCounterSamples(agent, p.CounterSamples)
+
 	for _, fs := range p.FlowSamples {
 		if fs.RawPacketHeader == nil {
 			log.Infof("Received sflow packet without raw packet header. Skipped.")
@@ -135,25 +149,19 @@ func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
 			continue
 		}
 
-		if fs.RawPacketHeader.HeaderProtocol != 1 {
+		switch fs.RawPacketHeader.HeaderProtocol {
+		case sflow.HeaderProtocolEthernet, sflow.HeaderProtocolIPv4, sflow.HeaderProtocolIPv6:
+		default:
 			log.Infof("Unknown header protocol: %d", fs.RawPacketHeader.HeaderProtocol)
 			continue
 		}
 
-		ether, err := packet.DecodeEthernet(fs.Data, fs.RawPacketHeader.OriginalPacketLength)
-		if err != nil {
-			log.Infof("Unable to decode ether packet: %v", err)
-			continue
-		}
-		fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfEthernetII)
-		fs.DataLen -= uint32(packet.SizeOfEthernetII)
-
 		fl := &netflow.Flow{
 			Router:     agent,
 			IntIn:      fs.FlowSampleHeader.InputIf,
 			IntOut:     fs.FlowSampleHeader.OutputIf,
 			Size:       uint64(fs.RawPacketHeader.FrameLength),
-			Packets:    uint32(1),
+			Packets:    uint64(1),
 			Timestamp:  time.Now().Unix(),
 			Samplerate: uint64(fs.FlowSampleHeader.SamplingRate),
 		}
@@ -161,12 +169,31 @@ func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
 		// We're updating the sampleCache to allow the forntend to show current sampling rates
 		sfs.sampleRateCache.Set(agent, uint64(fs.FlowSampleHeader.SamplingRate))
 
-		if fs.ExtendedRouterData == nil {
-			continue
+		if fs.ExtendedRouterData != nil {
+			fl.NextHop = fs.ExtendedRouterData.NextHop
+		}
+
+		if fs.ExtendedSwitchData != nil {
+			fl.SrcVlan = fs.ExtendedSwitchData.SourceVLAN
+			fl.DstVlan = fs.ExtendedSwitchData.DestinationVLAN
+			fl.SrcPriority = fs.ExtendedSwitchData.SourcePriority
+			fl.DstPriority = fs.ExtendedSwitchData.DestinationPriority
+		}
+
+		if fs.ExtendedGatewayData != nil {
+			sfs.processGatewayData(fs.ExtendedGatewayData, fl)
 		}
-		fl.NextHop = fs.ExtendedRouterData.NextHop
 
-		sfs.processEthernet(ether.EtherType, fs, fl)
+		switch fs.RawPacketHeader.HeaderProtocol {
+		case sflow.HeaderProtocolEthernet:
+			sfs.processEthernetFrame(fs, fl)
+		case sflow.HeaderProtocolIPv4:
+			sfs.processIPv4Packet(fs, fl)
+		case sflow.HeaderProtocolIPv6:
+			sfs.processIPv6Packet(fs, fl)
+		}
+		sfs.selectTunnelHeader(agent, fl)
+		sfs.seqTracker.Compensate(fl, p.Header.SubAgentID)
 
 		if fl.Family >= 0 {
 			if fl.Family == 4 {
@@ -183,6 +210,73 @@ func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
 	}
 }
 
+// processGatewayData populates the BGP related fields of `fl` from extended gateway data `egd`
+func (sfs *SflowServer) processGatewayData(egd *sflow.ExtendedGatewayData, fl *netflow.Flow) {
+	fl.BgpNextHop = egd.NextHop
+	fl.AsPath = egd.ASNs()
+	fl.BgpCommunities = egd.Communities
+
+	if sfs.config.BGPAugmentation.Enabled {
+		return
+	}
+
+	fl.SrcAs = egd.SrcAS
+	fl.SrcPeerAs = egd.SrcPeerAS
+	fl.DstAs = egd.DstAS()
+	fl.NextHopAs = egd.DstPeerAS()
+}
+
+// agentAddress identifies the agent that sent packet `p`. The agent address from the sflow header
+// is preferred if it belongs to a configured agent, as the packets source address might
+// differ from it (e.g. sflow exported via a management interface). Otherwise `remote` is used.
+func (sfs *SflowServer) agentAddress(remote net.IP, p *sflow.Packet) net.IP {
+	agent := p.Header.AgentAddress
+	if agent == nil {
+		return remote
+	}
+
+	if _, ok := sfs.config.AgentsNameByIP[agent.String()]; !ok {
+		return remote
+	}
+
+	if ip4 := agent.To4(); ip4 != nil {
+		return ip4
+	}
+	return agent
+}
+
+// processCounterSamples stores the interface counters contained in `samples`
+func (sfs *SflowServer) processCounterSamples(agent net.IP, samples []*sflow.CounterSample) {
+	now := time.Now().Unix()
+	for _, cs := range samples {
+		c := cs.GenericInterfaceCounters
+		if c == nil {
+			continue
+		}
+
+		sfs.ifCounters.Set(agent, ifcounters.Counters{
+			IfIndex:      c.IfIndex,
+			IfType:       c.IfType,
+			IfSpeed:      c.IfSpeed,
+			IfDirection:  c.IfDirection,
+			IfStatus:     c.IfStatus,
+			InOctets:     c.IfInOctets,
+			InUcastPkts:  c.IfInUcastPkts,
+			InMcastPkts:  c.IfInMulticastPkts,
+			InBcastPkts:  c.IfInBroadcastPkts,
+			InDiscards:   c.IfInDiscards,
+			InErrors:     c.IfInErrors,
+			OutOctets:    c.IfOutOctets,
+			OutUcastPkts: c.IfOutUcastPkts,
+			OutMcastPkts: c.IfOutMulticastPkts,
+			OutBcastPkts: c.IfOutBroadcastPkts,
+			OutDiscards:  c.IfOutDiscards,
+			OutErrors:    c.IfOutErrors,
+			Timestamp:    now,
+		})
+	}
+}
+
 func (sfs *SflowServer) processEthernet(ethType uint16, fs *sflow.FlowSample, fl *netflow.Flow) {
 	if ethType == packet.EtherTypeIPv4 {
 		sfs.processIPv4Packet(fs, fl)
@@ -190,61 +284,120 @@ func (sfs *SflowServer) processEthernet(ethType uint16, fs *sflow.FlowSample, fl
 		sfs.processIPv6Packet(fs, fl)
 	} else if ethType == packet.EtherTypeARP || ethType == packet.EtherTypeLACP {
 		return
-	} else if ethType == packet.EtherTypeIEEE8021Q {
+	} else if ethType == packet.EtherTypeIEEE8021Q || ethType == packet.EtherTypeIEEE8021AD {
 		sfs.processDot1QPacket(fs, fl)
+	} else if ethType == packet.EtherTypeMPLSUnicast || ethType == packet.EtherTypeMPLSMulticast {
+		sfs.processMPLSPacket(fs, fl)
 	} else {
 		log.Errorf("Unknown EtherType: 0x%x", ethType)
 	}
 }
 
+// processEthernetFrame processes an ethernet frame
+func (sfs *SflowServer) processEthernetFrame(fs *sflow.FlowSample, fl *netflow.Flow) {
+	ether, err := packet.DecodeEthernet(fs.Data, fs.DataLen)
+	if err != nil {
+		log.Errorf("Unable to decode ether packet: %v", err)
+		return
+	}
+	fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfEthernetII)
+	fs.DataLen -= uint32(packet.SizeOfEthernetII)
+
+	// MAC addresses are taken from the outermost ethernet header
+	if fl.SrcMac == nil {
+		fl.SrcMac = ether.SrcMAC
+		fl.DstMac = ether.DstMAC
+	}
+
+	sfs.processEthernet(ether.EtherType, fs, fl)
+}
+
 func (sfs *SflowServer) processDot1QPacket(fs *sflow.FlowSample, fl *netflow.Flow) {
 	dot1q, err := packet.DecodeDot1Q(fs.Data, fs.DataLen)
 	if err != nil {
 		log.Errorf("Unable to decode dot1q header: %v", err)
+		return
 	}
 	fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfDot1Q)
 	fs.DataLen -= uint32(packet.SizeOfDot1Q)
 
+	// Extended switch data takes precedence over the outermost VLAN tag
+	if fl.SrcVlan == 0 {
+		fl.SrcVlan = uint32(dot1q.VLANID())
+	}
+
 	sfs.processEthernet(dot1q.EtherType, fs, fl)
 }
 
+func (sfs *SflowServer) processMPLSPacket(fs *sflow.FlowSample, fl *netflow.Flow) {
+	stack, err := packet.DecodeMPLSStack(fs.Data, fs.DataLen)
+	if err != nil {
+		log.Errorf("Unable to decode MPLS label stack: %v", err)
+		return
+	}
+	fs.Data = unsafe.Pointer(uintptr(fs.Data) - uintptr(len(stack))*packet.SizeOfMPLSHeader)
+	fs.DataLen -= uint32(len(stack)) * uint32(packet.SizeOfMPLSHeader)
+
+	// Labels are taken from the outermost label stack
+	if fl.MplsLabel1 == 0 {
+		labels := []*uint32{&fl.MplsLabel1, &fl.MplsLabel2, &fl.MplsLabel3}
+		for i := 0; i < len(stack) && i < len(labels); i++ {
+			*labels[i] = stack[i].Label()
+		}
+	}
+
+	// MPLS has no information about the payload. Guess it from the IP version field.
+	switch packet.IPVersion(fs.Data, fs.DataLen) {
+	case 4:
+		sfs.processIPv4Packet(fs, fl)
+	case 6:
+		sfs.processIPv6Packet(fs, fl)
+	default:
+		log.Debugf("Unknown MPLS payload")
+	}
+}
+
 func (sfs *SflowServer) processIPv4Packet(fs *sflow.FlowSample, fl *netflow.Flow) {
-	fl.Family = 4
 	ipv4, err := packet.DecodeIPv4(fs.Data, fs.DataLen)
 	if err != nil {
 		log.Errorf("Unable to decode IPv4 packet: %v", err)
+		return
+	}
+	hdrLen := ipv4.HeaderLength()
+	if hdrLen < uint32(packet.SizeOfIPv4Header) || hdrLen > fs.DataLen {
+		hdrLen = uint32(packet.SizeOfIPv4Header)
 	}
-	fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfIPv4Header)
-	fs.DataLen -= uint32(packet.SizeOfIPv4Header)
+	fs.Data = unsafe.Pointer(uintptr(fs.Data) - uintptr(hdrLen))
+	fs.DataLen -= hdrLen
 
+	fl.Family = 4
 	fl.SrcAddr = convert.Reverse(ipv4.SrcAddr[:])
 	fl.DstAddr = convert.Reverse(ipv4.DstAddr[:])
 	fl.Protocol = uint32(ipv4.Protocol)
-	switch ipv4.Protocol {
-	case packet.TCP:
-		if err := getTCP(fs.Data, fs.DataLen, fl); err != nil {
-			log.Errorf("%v", err)
-		}
-	case packet.UDP:
-		if err := getUDP(fs.Data, fs.DataLen, fl); err != nil {
-			log.Errorf("%v", err)
-		}
-	}
+	fl.Tos = uint32(ipv4.DSCP)
+	sfs.processIPPayload(fs, fl)
 }
 
 func (sfs *SflowServer) processIPv6Packet(fs *sflow.FlowSample, fl *netflow.Flow) {
-	fl.Family = 6
 	ipv6, err := packet.DecodeIPv6(fs.Data, fs.DataLen)
 	if err != nil {
 		log.Errorf("Unable to decode IPv6 packet: %v", err)
+		return
 	}
 	fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfIPv6Header)
 	fs.DataLen -= uint32(packet.SizeOfIPv6Header)
 
+	fl.Family = 6
 	fl.SrcAddr = convert.Reverse(ipv6.SrcAddr[:])
 	fl.DstAddr = convert.Reverse(ipv6.DstAddr[:])
 	fl.Protocol = uint32(ipv6.NextHeader)
-	switch ipv6.NextHeader {
+	fl.Tos = (ipv6.VersionTrafficClassFlowLabel >> 20) & 0xff
+	sfs.processIPPayload(fs, fl)
+}
+
+// processIPPayload processes the payload of an IP packet. fl.Protocol must be set already.
+func (sfs *SflowServer) processIPPayload(fs *sflow.FlowSample, fl *netflow.Flow) {
+	switch fl.Protocol {
 	case packet.TCP:
 		if err := getTCP(fs.Data, fs.DataLen, fl); err != nil {
 			log.Errorf("%v", err)
@@ -252,10 +405,122 @@ func (sfs *SflowServer) processIPv6Packet(fs *sflow.FlowSample, fl *netflow.Flow
 	case packet.UDP:
 		if err := getUDP(fs.Data, fs.DataLen, fl); err != nil {
 			log.Errorf("%v", err)
+			return
+		}
+
+		if fl.DstPort == packet.VXLANPort {
+			sfs.processVXLANPacket(fs, fl)
+		}
+	case packet.ICMP, packet.ICMPv6:
+		if err := getICMP(fs.Data, fs.DataLen, fl); err != nil {
+			log.Errorf("%v", err)
 		}
+	case packet.GRE:
+		sfs.processGREPacket(fs, fl)
 	}
 }
 
+func (sfs *SflowServer) processGREPacket(fs *sflow.FlowSample, fl *netflow.Flow) {
+	gre, err := packet.DecodeGRE(fs.Data, fs.DataLen)
+	if err != nil {
+		log.Errorf("Unable to decode GRE header: %v", err)
+		return
+	}
+	fs.Data = unsafe.Pointer(uintptr(fs.Data) - uintptr(gre.HeaderLength()))
+	fs.DataLen -= gre.HeaderLength()
+
+	enterTunnel(fl)
+	if gre.ProtocolType == packet.EtherTypeTransparentEthernetBridging {
+		sfs.processEthernetFrame(fs, fl)
+		return
+	}
+	sfs.processEthernet(gre.ProtocolType, fs, fl)
+}
+
+func (sfs *SflowServer) processVXLANPacket(fs *sflow.FlowSample, fl *netflow.Flow) {
+	if uint32(packet.SizeOfUDPHeader) > fs.DataLen {
+		return
+	}
+	fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfUDPHeader)
+	fs.DataLen -= uint32(packet.SizeOfUDPHeader)
+
+	_, err := packet.DecodeVXLAN(fs.Data, fs.DataLen)
+	if err != nil {
+		log.Errorf("Unable to decode VXLAN header: %v", err)
+		return
+	}
+	fs.Data = unsafe.Pointer(uintptr(fs.Data) - packet.SizeOfVXLANHeader)
+	fs.DataLen -= uint32(packet.SizeOfVXLANHeader)
+
+	enterTunnel(fl)
+	sfs.processEthernetFrame(fs, fl)
+}
+
+// enterTunnel saves the outermost IP header of `fl` and resets its IP header fields
+// so the tunnels payload can be decoded into them
+func enterTunnel(fl *netflow.Flow) {
+	if fl.Outer == nil {
+		fl.Outer = getTuple(fl)
+	}
+
+	setTuple(fl, &netflow.Tuple{})
+}
+
+// selectTunnelHeader records the innermost IP header of a tunneled flow `fl` and decides
+// which IP header is used for the flow depending on the agents tunnel mode
+func (sfs *SflowServer) selectTunnelHeader(agent net.IP, fl *netflow.Flow) {
+	if fl.Outer == nil {
+		return
+	}
+
+	if fl.Family != 0 {
+		fl.Inner = getTuple(fl)
+	}
+
+	if fl.Inner != nil && sfs.tunnelMode(agent) == config.TunnelModeInner {
+		return
+	}
+
+	setTuple(fl, fl.Outer)
+}
+
+// tunnelMode returns the tunnel mode configured for `agent`
+func (sfs *SflowServer) tunnelMode(agent net.IP) string {
+	if a, ok := sfs.config.AgentsByIP[agent.String()]; ok {
+		return a.TunnelMode
+	}
+
+	return config.TunnelModeOuter
+}
+
+func getTuple(fl *netflow.Flow) *netflow.Tuple {
+	return &netflow.Tuple{
+		Family:   fl.Family,
+		SrcAddr:  fl.SrcAddr,
+		DstAddr:  fl.DstAddr,
+		Protocol: fl.Protocol,
+		SrcPort:  fl.SrcPort,
+		DstPort:  fl.DstPort,
+		TcpFlags: fl.TcpFlags,
+		Tos:      fl.Tos,
+		IcmpType: fl.IcmpType,
+		IcmpCode: fl.IcmpCode,
+	}
+}
+
+func setTuple(fl *netflow.Flow, t *netflow.Tuple) {
+	fl.Family = t.Family
+	fl.SrcAddr = t.SrcAddr
+	fl.DstAddr = t.DstAddr
+	fl.Protocol = t.Protocol
+	fl.SrcPort = t.SrcPort
+	fl.DstPort = t.DstPort
+	fl.TcpFlags = t.TcpFlags
+	fl.Tos = t.Tos
+	fl.IcmpType = t.IcmpType
+	fl.IcmpCode = t.IcmpCode
+}
+
 func getUDP(udpPtr unsafe.Pointer, length uint32, fl *netflow.Flow) error {
 	udp, err := packet.DecodeUDP(udpPtr, length)
 	if err != nil {
@@ -276,6 +541,19 @@ func getTCP(tcpPtr unsafe.Pointer, length uint32, fl *netflow.Flow) error {
 
 	fl.SrcPort = uint32(tcp.SrcPort)
 	fl.DstPort = uint32(tcp.DstPort)
+	fl.TcpFlags = uint32(tcp.Flags)
+
+	return nil
+}
+
+func getICMP(icmpPtr unsafe.Pointer, length uint32, fl *netflow.Flow) error {
+	icmp, err := packet.DecodeICMP(icmpPtr, length)
+	if err != nil {
+		return errors.Wrap(err, "Unable to decode ICMP header")
+	}
+
+	fl.IcmpType = uint32(icmp.Type)
+	fl.IcmpCode = uint32(icmp.Code)
 
 	return nil
 }
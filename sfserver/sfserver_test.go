@@ -16,9 +16,14 @@ import (
 	"testing"
 	"unsafe"
 
+	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/ifcounters"
+	"github.com/bio-routing/tflow2/netflow"
 	"github.com/bio-routing/tflow2/packet"
 	"github.com/bio-routing/tflow2/sflow"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/stretchr/testify/assert"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -146,3 +151,404 @@ func TestIntegration(t *testing.T) {
 		}
 	}
 }
+
+func TestAgentAddress(t *testing.T) {
+	sfs := &SflowServer{
+		config: &config.Config{
+			AgentsNameByIP: map[string]string{
+				"2001:db8::1": "rtr01",
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		remote   net.IP
+		header   net.IP
+		expected net.IP
+	}{
+		{
+			name:     "Configured agent address",
+			remote:   net.ParseIP("2001:db8:ffff::1"),
+			header:   net.ParseIP("2001:db8::1"),
+			expected: net.ParseIP("2001:db8::1"),
+		},
+		{
+			name:     "Unknown agent address",
+			remote:   net.IP([]byte{192, 0, 2, 1}),
+			header:   net.ParseIP("2001:db8::2"),
+			expected: net.IP([]byte{192, 0, 2, 1}),
+		},
+	}
+
+	for _, test := range tests {
+		p := &sflow.Packet{
+			Header: &sflow.Header{
+				AgentAddress: test.header,
+			},
+		}
+
+		res := sfs.agentAddress(test.remote, p)
+		if !res.Equal(test.expected) {
+			t.Errorf("Test %q: Expected %s got %s", test.name, test.expected, res)
+		}
+	}
+}
+
+func TestProcessPacketTunnels(t *testing.T) {
+	ethernet := func(etherType uint16) []byte {
+		return []byte{
+			0x80, 0x71, 0x1f, 0x7f, 0x02, 0x94, // Destination MAC
+			0x20, 0x4e, 0x71, 0x04, 0x1c, 0xb9, // Source MAC
+			byte(etherType >> 8), byte(etherType), // EtherType
+		}
+	}
+	ipv4 := func(protocol uint8, src, dst []byte) []byte {
+		h := []byte{
+			0x45,       // Version + Length
+			0,          // TOS
+			0, 0, 0, 0, // Total Length, Identifier
+			0x40, 0, // Flags + Fragment offset
+			64,       // TTL
+			protocol, // Protocol
+			0, 0,     // Header Checksum
+		}
+		h = append(h, src...)
+		return append(h, dst...)
+	}
+	ports := func(src, dst uint16, length int) []byte {
+		p := []byte{byte(src >> 8), byte(src), byte(dst >> 8), byte(dst)}
+		return append(p, make([]byte, length-4)...)
+	}
+
+	gre := ethernet(packet.EtherTypeIPv4)
+	gre = append(gre, ipv4(packet.GRE, []byte{192, 0, 2, 1}, []byte{192, 0, 2, 2})...)
+	gre = append(gre, 0, 0, 0x08, 0x00) // GRE header
+	gre = append(gre, ipv4(packet.UDP, []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2})...)
+	gre = append(gre, ports(1234, 53, 8)...)
+
+	vxlan := ethernet(packet.EtherTypeIPv4)
+	vxlan = append(vxlan, ipv4(packet.UDP, []byte{192, 0, 2, 3}, []byte{192, 0, 2, 4})...)
+	vxlan = append(vxlan, ports(5000, packet.VXLANPort, 8)...)
+	vxlan = append(vxlan, 0x08, 0, 0, 0, 0, 0, 100, 0) // VXLAN header
+	vxlan = append(vxlan, ethernet(packet.EtherTypeIEEE8021Q)...)
+	vxlan = append(vxlan, 0, 10, 0x08, 0x00) // 802.1Q tag
+	vxlan = append(vxlan, ipv4(packet.TCP, []byte{10, 0, 0, 3}, []byte{10, 0, 0, 4})...)
+	vxlan = append(vxlan, ports(40000, 443, 20)...)
+
+	mpls := ethernet(packet.EtherTypeMPLSUnicast)
+	mpls = append(mpls, 0, 0x06, 0x40, 0x40) // Label 100
+	mpls = append(mpls, 0, 0x0c, 0x81, 0x40) // Label 200, bottom of stack
+	mpls = append(mpls, 0x60, 0, 0, 0, 0, 20, packet.TCP, 64)
+	mpls = append(mpls, net.ParseIP("2001:db8::1")...)
+	mpls = append(mpls, net.ParseIP("2001:db8::2")...)
+	mpls = append(mpls, ports(5555, 443, 20)...)
+
+	rawIPv4 := ipv4(packet.UDP, []byte{10, 0, 0, 5}, []byte{10, 0, 0, 6})
+	rawIPv4 = append(rawIPv4, ports(4000, 53, 8)...)
+
+	rawIPv6 := []byte{0x60, 0, 0, 0, 0, 20, packet.TCP, 64}
+	rawIPv6 = append(rawIPv6, net.ParseIP("2001:db8::3")...)
+	rawIPv6 = append(rawIPv6, net.ParseIP("2001:db8::4")...)
+	rawIPv6 = append(rawIPv6, ports(6666, 80, 20)...)
+
+	tests := []struct {
+		name           string
+		headerProtocol uint32
+		frame          []byte
+		tunnelMode     string
+		expectedSrc    net.IP
+		expectedDst    net.IP
+		expectedPorts  [2]uint32
+		expectedInner  net.IP
+	}{
+		{
+			name:          "GRE outer",
+			frame:         gre,
+			tunnelMode:    config.TunnelModeOuter,
+			expectedSrc:   net.IP{192, 0, 2, 1},
+			expectedDst:   net.IP{192, 0, 2, 2},
+			expectedInner: net.IP{10, 0, 0, 1},
+		},
+		{
+			name:          "GRE inner",
+			frame:         gre,
+			tunnelMode:    config.TunnelModeInner,
+			expectedSrc:   net.IP{10, 0, 0, 1},
+			expectedDst:   net.IP{10, 0, 0, 2},
+			expectedPorts: [2]uint32{1234, 53},
+			expectedInner: net.IP{10, 0, 0, 1},
+		},
+		{
+			name:          "VXLAN inner",
+			frame:         vxlan,
+			tunnelMode:    config.TunnelModeInner,
+			expectedSrc:   net.IP{10, 0, 0, 3},
+			expectedDst:   net.IP{10, 0, 0, 4},
+			expectedPorts: [2]uint32{40000, 443},
+			expectedInner: net.IP{10, 0, 0, 3},
+		},
+		{
+			name:          "VXLAN outer",
+			frame:         vxlan,
+			tunnelMode:    config.TunnelModeOuter,
+			expectedSrc:   net.IP{192, 0, 2, 3},
+			expectedDst:   net.IP{192, 0, 2, 4},
+			expectedPorts: [2]uint32{5000, packet.VXLANPort},
+			expectedInner: net.IP{10, 0, 0, 3},
+		},
+		{
+			name:          "MPLS",
+			frame:         mpls,
+			tunnelMode:    config.TunnelModeOuter,
+			expectedSrc:   net.ParseIP("2001:db8::1"),
+			expectedDst:   net.ParseIP("2001:db8::2"),
+			expectedPorts: [2]uint32{5555, 443},
+		},
+		{
+			name:           "Raw IPv4",
+			headerProtocol: sflow.HeaderProtocolIPv4,
+			frame:          rawIPv4,
+			tunnelMode:     config.TunnelModeOuter,
+			expectedSrc:    net.IP{10, 0, 0, 5},
+			expectedDst:    net.IP{10, 0, 0, 6},
+			expectedPorts:  [2]uint32{4000, 53},
+		},
+		{
+			name:           "Raw IPv6",
+			headerProtocol: sflow.HeaderProtocolIPv6,
+			frame:          rawIPv6,
+			tunnelMode:     config.TunnelModeOuter,
+			expectedSrc:    net.ParseIP("2001:db8::3"),
+			expectedDst:    net.ParseIP("2001:db8::4"),
+			expectedPorts:  [2]uint32{6666, 80},
+		},
+	}
+
+	for i := range tests {
+		if tests[i].headerProtocol == 0 {
+			tests[i].headerProtocol = sflow.HeaderProtocolEthernet
+		}
+	}
+
+	for _, test := range tests {
+		agent := &config.Agent{
+			Name:       "rtr01",
+			IPAddress:  "192.0.2.100",
+			TunnelMode: test.tunnelMode,
+		}
+		sfs := &SflowServer{
+			Output: make(chan *netflow.Flow, 1),
+			config: &config.Config{
+				BGPAugmentation: &config.BGPAugment{},
+				AgentsNameByIP: map[string]string{
+					agent.IPAddress: agent.Name,
+				},
+				AgentsByIP: map[string]*config.Agent{
+					agent.IPAddress: agent,
+				},
+			},
+			sampleRateCache: srcache.New(nil),
+			ifCounters:      ifcounters.New(),
+		}
+
+		sfs.processPacket(net.IP{192, 0, 2, 100}, sflowDatagram(test.headerProtocol, test.frame))
+
+		var fl *netflow.Flow
+		select {
+		case fl = <-sfs.Output:
+		default:
+			t.Errorf("Test %q: No flow received", test.name)
+			continue
+		}
+
+		if !net.IP(fl.SrcAddr).Equal(test.expectedSrc) || !net.IP(fl.DstAddr).Equal(test.expectedDst) {
+			t.Errorf("Test %q: Unexpected addresses: %s -> %s", test.name, net.IP(fl.SrcAddr), net.IP(fl.DstAddr))
+		}
+
+		if fl.SrcPort != test.expectedPorts[0] || fl.DstPort != test.expectedPorts[1] {
+			t.Errorf("Test %q: Unexpected ports: %d -> %d", test.name, fl.SrcPort, fl.DstPort)
+		}
+
+		if test.expectedInner == nil {
+			if fl.Inner != nil || fl.Outer != nil {
+				t.Errorf("Test %q: Unexpected tunnel headers", test.name)
+			}
+			continue
+		}
+
+		if fl.Inner == nil || !net.IP(fl.Inner.SrcAddr).Equal(test.expectedInner) {
+			t.Errorf("Test %q: Unexpected inner header: %v", test.name, fl.Inner)
+		}
+	}
+}
+
+// sflowDatagram builds an sflow datagram containing a single flow sample with raw packet header `frame`
+func sflowDatagram(headerProtocol uint32, frame []byte) []byte {
+	for len(frame)%4 != 0 {
+		frame = append(frame, 0)
+	}
+	hdrLen := uint32(len(frame))
+
+	s := []byte{
+		0, 0, 0, 5, // Version
+		0, 0, 0, 1, // Agent Address Type
+		192, 0, 2, 100, // Agent Address
+		0, 0, 0, 0, // Sub-AgentID
+		0, 0, 0, 1, // Sequence Number
+		0, 0, 0, 111, // SysUpTime
+		0, 0, 0, 1, // NumSamples
+
+		0, 0, 0, 1, // Enterprise/Type (Flow sample)
+	}
+	s = append(s, convert.Uint32Byte(32+8+16+hdrLen)...) // Sample length
+	s = append(s, []byte{
+		0, 0, 0, 1, // Sequence Number
+		0, 0, 0, 1, // Source ID + Index
+		0, 0, 0, 100, // Sampling Rate
+		0, 0, 1, 0, // Sample Pool
+		0, 0, 0, 0, // Dropped Packets
+		0, 0, 0, 1, // Input interface
+		0, 0, 0, 2, // Output interface
+		0, 0, 0, 1, // Flow Record count
+
+		0, 0, 0, 1, // Enterprise/Type (Raw packet header)
+	}...)
+	s = append(s, convert.Uint32Byte(16+hdrLen)...)      // Flow Data Length
+	s = append(s, convert.Uint32Byte(headerProtocol)...) // Header Protocol
+	s = append(s, convert.Uint32Byte(hdrLen+100)...)     // Frame length
+	s = append(s, 0, 0, 0, 4)                            // Payload removed
+	s = append(s, convert.Uint32Byte(hdrLen)...)         // Original Packet length
+	return append(s, frame...)
+}
+
+func TestProcessPacketDimensions(t *testing.T) {
+	tcp := []byte{
+		0x80, 0x71, 0x1f, 0x7f, 0x02, 0x94, // Destination MAC
+		0x20, 0x4e, 0x71, 0x04, 0x1c, 0xb9, // Source MAC
+		0x81, 0x00, // EtherType (802.1Q)
+		0, 42, 0x08, 0x00, // 802.1Q tag (VLAN 42)
+		0x45,       // Version + Length
+		0xb8,       // TOS (DSCP EF)
+		0, 0, 0, 0, // Total Length, Identifier
+		0x40, 0, // Flags + Fragment offset
+		64,         // TTL
+		packet.TCP, // Protocol
+		0, 0,       // Header Checksum
+		10, 0, 0, 1, // Source Address
+		10, 0, 0, 2, // Destination Address
+		0x9c, 0x40, 0x01, 0xbb, // Ports
+		0, 0, 0, 1, // Sequence Number
+		0, 0, 0, 0, // ACK Number
+		0x50,                   // Data Offset
+		0x02,                   // Flags (SYN)
+		0xff, 0xff, 0, 0, 0, 0, // Window, Checksum, Urgent Pointer
+	}
+
+	icmp := []byte{
+		0x45,       // Version + Length
+		0,          // TOS
+		0, 0, 0, 0, // Total Length, Identifier
+		0x40, 0, // Flags + Fragment offset
+		64,          // TTL
+		packet.ICMP, // Protocol
+		0, 0,        // Header Checksum
+		10, 0, 0, 3, // Source Address
+		10, 0, 0, 4, // Destination Address
+		3, 13, 0, 0, // Type, Code, Checksum
+	}
+
+	mpls := []byte{
+		0x80, 0x71, 0x1f, 0x7f, 0x02, 0x94, // Destination MAC
+		0x20, 0x4e, 0x71, 0x04, 0x1c, 0xb9, // Source MAC
+		0x88, 0x47, // EtherType (MPLS)
+		0, 0x06, 0x40, 0x40, // Label 100
+		0, 0x0c, 0x81, 0x40, // Label 200, bottom of stack
+		0x45,       // Version + Length
+		0,          // TOS
+		0, 0, 0, 0, // Total Length, Identifier
+		0x40, 0, // Flags + Fragment offset
+		64,          // TTL
+		packet.ICMP, // Protocol
+		0, 0,        // Header Checksum
+		10, 0, 0, 5, // Source Address
+		10, 0, 0, 6, // Destination Address
+		8, 0, 0, 0, // Type, Code, Checksum
+	}
+
+	tests := []struct {
+		name           string
+		headerProtocol uint32
+		frame          []byte
+		expected       netflow.Flow
+	}{
+		{
+			name:           "TCP SYN",
+			headerProtocol: sflow.HeaderProtocolEthernet,
+			frame:          tcp,
+			expected: netflow.Flow{
+				TcpFlags: packet.TCPFlagSYN,
+				Tos:      0xb8,
+				SrcVlan:  42,
+				SrcMac:   []byte{0x20, 0x4e, 0x71, 0x04, 0x1c, 0xb9},
+				DstMac:   []byte{0x80, 0x71, 0x1f, 0x7f, 0x02, 0x94},
+			},
+		},
+		{
+			name:           "ICMP",
+			headerProtocol: sflow.HeaderProtocolIPv4,
+			frame:          icmp,
+			expected: netflow.Flow{
+				IcmpType: 3,
+				IcmpCode: 13,
+			},
+		},
+		{
+			name:           "MPLS",
+			headerProtocol: sflow.HeaderProtocolEthernet,
+			frame:          mpls,
+			expected: netflow.Flow{
+				IcmpType:   8,
+				SrcMac:     []byte{0x20, 0x4e, 0x71, 0x04, 0x1c, 0xb9},
+				DstMac:     []byte{0x80, 0x71, 0x1f, 0x7f, 0x02, 0x94},
+				MplsLabel1: 100,
+				MplsLabel2: 200,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		sfs := &SflowServer{
+			Output: make(chan *netflow.Flow, 1),
+			config: &config.Config{
+				BGPAugmentation: &config.BGPAugment{},
+				AgentsNameByIP: map[string]string{
+					"192.0.2.100": "rtr01",
+				},
+			},
+			sampleRateCache: srcache.New(nil),
+			ifCounters:      ifcounters.New(),
+		}
+
+		sfs.processPacket(net.IP{192, 0, 2, 100}, sflowDatagram(test.headerProtocol, test.frame))
+
+		var fl *netflow.Flow
+		select {
+		case fl = <-sfs.Output:
+		default:
+			t.Errorf("Test %q: No flow received", test.name)
+			continue
+		}
+
+		assert.Equal(t, test.expected.TcpFlags, fl.TcpFlags, test.name)
+		assert.Equal(t, test.expected.Tos, fl.Tos, test.name)
+		assert.Equal(t, test.expected.IcmpType, fl.IcmpType, test.name)
+		assert.Equal(t, test.expected.IcmpCode, fl.IcmpCode, test.name)
+		assert.Equal(t, test.expected.SrcVlan, fl.SrcVlan, test.name)
+		assert.Equal(t, net.HardwareAddr(test.expected.SrcMac), net.HardwareAddr(fl.SrcMac), test.name)
+		assert.Equal(t, net.HardwareAddr(test.expected.DstMac), net.HardwareAddr(fl.DstMac), test.name)
+		assert.Equal(t, test.expected.MplsLabel1, fl.MplsLabel1, test.name)
+		assert.Equal(t, test.expected.MplsLabel2, fl.MplsLabel2, test.name)
+		assert.Equal(t, test.expected.MplsLabel3, fl.MplsLabel3, test.name)
+	}
+}
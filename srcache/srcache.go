@@ -9,19 +9,41 @@ import (
 
 // SamplerateCache caches information about samplerates
 type SamplerateCache struct {
-	cache map[string]uint64
-	mu    sync.RWMutex
+	cache      map[string]uint64
+	samplers   map[samplerKey]uint64
+	interfaces map[interfaceKey]uint64
+	mu         sync.RWMutex
+}
+
+// samplerKey identifies a sampler of an observation domain/source ID of an agent
+type samplerKey struct {
+	agent     string
+	sourceID  uint32
+	samplerID uint64
+}
+
+// interfaceKey identifies an interface of an agent
+type interfaceKey struct {
+	agent   string
+	ifIndex uint32
 }
 
 // New creates a new SamplerateCache and initializes it with values from the config
 func New(agents []config.Agent) *SamplerateCache {
 	c := &SamplerateCache{
-		cache: make(map[string]uint64),
+		cache:      make(map[string]uint64),
+		samplers:   make(map[samplerKey]uint64),
+		interfaces: make(map[interfaceKey]uint64),
 	}
 
 	// Initialize cache with configured samplerates
 	for _, a := range agents {
-		c.Set(net.ParseIP(a.IPAddress), a.SampleRate)
+		rtr := net.ParseIP(a.IPAddress)
+		c.Set(rtr, a.SampleRate)
+
+		for ifIndex, rate := range a.InterfaceSampleRates {
+			c.interfaces[interfaceKey{agent: key(rtr), ifIndex: ifIndex}] = rate
+		}
 	}
 
 	return c
@@ -32,7 +54,7 @@ func (s *SamplerateCache) Set(rtr net.IP, rate uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.cache[string(rtr)] = rate
+	s.cache[key(rtr)] = rate
 }
 
 // Get gets a cache entry
@@ -40,9 +62,59 @@ func (s *SamplerateCache) Get(rtr net.IP) uint64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if _, ok := s.cache[string(rtr)]; !ok {
+	return s.get(key(rtr))
+}
+
+// get returns the agent level samplerate of agent `k`. Caller must hold the read lock.
+func (s *SamplerateCache) get(k string) uint64 {
+	rate, ok := s.cache[k]
+	if !ok {
 		return 1
 	}
 
-	return s.cache[string(rtr)]
+	return rate
+}
+
+// SetSampler updates the samplerate of sampler `samplerID` of observation domain/source ID `sourceID` of `rtr`.
+// Sampler ID 0 is used for samplerates not bound to a specific sampler.
+func (s *SamplerateCache) SetSampler(rtr net.IP, sourceID uint32, samplerID uint64, rate uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samplers[samplerKey{agent: key(rtr), sourceID: sourceID, samplerID: samplerID}] = rate
+}
+
+// GetSampler gets the samplerate of a flow sampled by sampler `samplerID` of observation domain/source ID
+// `sourceID` of `rtr` on interface `ifIndex`. If the sampler is unknown the samplerate of the observation
+// domain/source ID, the configured samplerate of the interface and the samplerate of the agent are used
+// (in that order).
+func (s *SamplerateCache) GetSampler(rtr net.IP, sourceID uint32, samplerID uint64, ifIndex uint32) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k := key(rtr)
+	if rate, ok := s.samplers[samplerKey{agent: k, sourceID: sourceID, samplerID: samplerID}]; ok {
+		return rate
+	}
+
+	if samplerID != 0 {
+		if rate, ok := s.samplers[samplerKey{agent: k, sourceID: sourceID}]; ok {
+			return rate
+		}
+	}
+
+	if rate, ok := s.interfaces[interfaceKey{agent: k, ifIndex: ifIndex}]; ok {
+		return rate
+	}
+
+	return s.get(k)
+}
+
+// key returns the cache key for `rtr`. IPv4 addresses are normalized to their 4 byte representation
+// so lookups work regardless of how the address was obtained.
+func key(rtr net.IP) string {
+	if addr := rtr.To4(); addr != nil {
+		return string(addr)
+	}
+	return string(rtr.To16())
 }
@@ -0,0 +1,58 @@
+package srcache
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplerateCache(t *testing.T) {
+	c := New([]config.Agent{
+		{
+			Name:       "rtr01",
+			IPAddress:  "192.0.2.1",
+			SampleRate: 1000,
+		},
+		{
+			Name:       "rtr02",
+			IPAddress:  "2001:db8::1",
+			SampleRate: 2000,
+		},
+	})
+
+	assert.Equal(t, uint64(1000), c.Get(net.IP([]byte{192, 0, 2, 1})))
+	assert.Equal(t, uint64(1000), c.Get(net.ParseIP("192.0.2.1")))
+	assert.Equal(t, uint64(2000), c.Get(net.ParseIP("2001:db8::1")))
+	assert.Equal(t, uint64(1), c.Get(net.ParseIP("2001:db8::2")))
+
+	c.Set(net.ParseIP("2001:db8::1").To16(), 4096)
+	assert.Equal(t, uint64(4096), c.Get(net.ParseIP("2001:db8::1")))
+}
+
+func TestSamplerateCacheSampler(t *testing.T) {
+	rtr := net.ParseIP("192.0.2.1")
+	c := New([]config.Agent{
+		{
+			Name:       "rtr01",
+			IPAddress:  "192.0.2.1",
+			SampleRate: 1000,
+			InterfaceSampleRates: map[uint32]uint64{
+				10: 500,
+			},
+		},
+	})
+
+	assert.Equal(t, uint64(500), c.GetSampler(rtr, 1, 2, 10))
+	assert.Equal(t, uint64(1000), c.GetSampler(rtr, 1, 2, 11))
+
+	c.SetSampler(rtr, 1, 0, 64)
+	assert.Equal(t, uint64(64), c.GetSampler(rtr, 1, 2, 10))
+	assert.Equal(t, uint64(500), c.GetSampler(rtr, 2, 2, 10))
+
+	c.SetSampler(net.IP{192, 0, 2, 1}, 1, 2, 128)
+	assert.Equal(t, uint64(128), c.GetSampler(rtr, 1, 2, 10))
+	assert.Equal(t, uint64(64), c.GetSampler(rtr, 1, 3, 10))
+	assert.Equal(t, uint64(1), c.GetSampler(net.ParseIP("192.0.2.2"), 1, 2, 10))
+}
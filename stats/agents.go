@@ -0,0 +1,59 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"sync"
+)
+
+// AgentStats represents statistics of a single agent
+type AgentStats struct {
+	Address string
+	Name    string
+
+	// Sequence number accounting. Units are export packets (NetFlow v9, sFlow) or data records (IPFIX).
+	SequenceReceived uint64
+	SequenceLost     uint64
+	SequenceGaps     uint64
+	SequenceResets   uint64
+	SequenceReorders uint64
+}
+
+var agentStats = struct {
+	agents map[string]*AgentStats
+	lock   sync.RWMutex
+}{
+	agents: make(map[string]*AgentStats),
+}
+
+// Agent returns the statistics of the agent with address `addr` and name `name`
+func Agent(addr string, name string) *AgentStats {
+	agentStats.lock.RLock()
+	a, ok := agentStats.agents[addr]
+	agentStats.lock.RUnlock()
+	if ok {
+		return a
+	}
+
+	agentStats.lock.Lock()
+	defer agentStats.lock.Unlock()
+	if a, ok := agentStats.agents[addr]; ok {
+		return a
+	}
+
+	a = &AgentStats{
+		Address: addr,
+		Name:    name,
+	}
+	agentStats.agents[addr] = a
+	return a
+}
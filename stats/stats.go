@@ -15,6 +15,7 @@ package stats
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"sync/atomic"
 	"time"
 )
@@ -29,12 +30,23 @@ type Stats struct {
 	BirdCacheMiss   uint64
 	FlowPackets     uint64
 	FlowBytes       uint64
+	Netflow5packets uint64
+	Netflow5bytes   uint64
 	Netflow9packets uint64
 	Netflow9bytes   uint64
 	IPFIXpackets    uint64
 	IPFIXbytes      uint64
+	IPFIXSessions   int64
 	SflowPackets    uint64
 	SflowBytes      uint64
+
+	PendingSetsQueued   uint64
+	PendingSetsReplayed uint64
+	PendingSetsExpired  uint64
+	PendingSetsDropped  uint64
+
+	// FlowsDirectionSkipped is the number of flows not counted due to the direction policy of their agent
+	FlowsDirectionSkipped uint64
 }
 
 // GlobalStats is instance of `Stats` to keep stats of this program
@@ -51,20 +63,46 @@ func Metrics(w http.ResponseWriter) {
 	fmt.Fprintf(w, "netflow_collector_uptime %d\n", now-GlobalStats.StartTime)
 	fmt.Fprintf(w, "netflow_collector_flows4 %d\n", atomic.LoadUint64(&GlobalStats.Flows4))
 	fmt.Fprintf(w, "netflow_collector_flows6 %d\n", atomic.LoadUint64(&GlobalStats.Flows6))
+	fmt.Fprintf(w, "netflow_collector_flows_direction_skipped %d\n", atomic.LoadUint64(&GlobalStats.FlowsDirectionSkipped))
 	fmt.Fprintf(w, "netflow_collector_queries %d\n", atomic.LoadUint64(&GlobalStats.Queries))
 	fmt.Fprintf(w, "netflow_collector_bird_cache_hits %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheHits))
 	fmt.Fprintf(w, "netflow_collector_bird_cache_miss %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheMiss))
 	fmt.Fprintf(w, "netflow_collector_packets %d\n", atomic.LoadUint64(&GlobalStats.FlowPackets))
 	fmt.Fprintf(w, "netflow_collector_bytes %d\n", atomic.LoadUint64(&GlobalStats.FlowBytes))
+	fmt.Fprintf(w, "netflow_collector_netflow5_packets %d\n", atomic.LoadUint64(&GlobalStats.Netflow5packets))
+	fmt.Fprintf(w, "netflow_collector_netflow5_bytes %d\n", atomic.LoadUint64(&GlobalStats.Netflow5bytes))
 	fmt.Fprintf(w, "netflow_collector_netflow9_packets %d\n", atomic.LoadUint64(&GlobalStats.Netflow9packets))
 	fmt.Fprintf(w, "netflow_collector_netflow9_bytes %d\n", atomic.LoadUint64(&GlobalStats.Netflow9bytes))
 	fmt.Fprintf(w, "netflow_collector_ipfix_packets %d\n", atomic.LoadUint64(&GlobalStats.IPFIXpackets))
 	fmt.Fprintf(w, "netflow_collector_ipfix_bytes %d\n", atomic.LoadUint64(&GlobalStats.IPFIXbytes))
+	fmt.Fprintf(w, "netflow_collector_ipfix_tcp_sessions %d\n", atomic.LoadInt64(&GlobalStats.IPFIXSessions))
+	fmt.Fprintf(w, "netflow_collector_pending_sets_queued %d\n", atomic.LoadUint64(&GlobalStats.PendingSetsQueued))
+	fmt.Fprintf(w, "netflow_collector_pending_sets_replayed %d\n", atomic.LoadUint64(&GlobalStats.PendingSetsReplayed))
+	fmt.Fprintf(w, "netflow_collector_pending_sets_expired %d\n", atomic.LoadUint64(&GlobalStats.PendingSetsExpired))
+	fmt.Fprintf(w, "netflow_collector_pending_sets_dropped %d\n", atomic.LoadUint64(&GlobalStats.PendingSetsDropped))
 	fmt.Fprintf(w, "netflow_collector_sflow_packets %d\n", atomic.LoadUint64(&GlobalStats.SflowPackets))
 	fmt.Fprintf(w, "netflow_collector_sflow_bytes %d\n", atomic.LoadUint64(&GlobalStats.SflowBytes))
 	routerStats(w)
 }
 
 func routerStats(w http.ResponseWriter) {
+	agentStats.lock.RLock()
+	agents := make([]*AgentStats, 0, len(agentStats.agents))
+	for _, a := range agentStats.agents {
+		agents = append(agents, a)
+	}
+	agentStats.lock.RUnlock()
+
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Address < agents[j].Address
+	})
 
+	for _, a := range agents {
+		labels := fmt.Sprintf("{agent=%q,name=%q}", a.Address, a.Name)
+		fmt.Fprintf(w, "netflow_collector_agent_sequence_received%s %d\n", labels, atomic.LoadUint64(&a.SequenceReceived))
+		fmt.Fprintf(w, "netflow_collector_agent_sequence_lost%s %d\n", labels, atomic.LoadUint64(&a.SequenceLost))
+		fmt.Fprintf(w, "netflow_collector_agent_sequence_gaps%s %d\n", labels, atomic.LoadUint64(&a.SequenceGaps))
+		fmt.Fprintf(w, "netflow_collector_agent_sequence_resets%s %d\n", labels, atomic.LoadUint64(&a.SequenceResets))
+		fmt.Fprintf(w, "netflow_collector_agent_sequence_reorders%s %d\n", labels, atomic.LoadUint64(&a.SequenceReorders))
+	}
 }
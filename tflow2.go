@@ -20,14 +20,19 @@ import (
 	"time"
 
 	"github.com/bio-routing/tflow2/annotation"
+	"github.com/bio-routing/tflow2/appcache"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/database"
 	"github.com/bio-routing/tflow2/frontend"
 	"github.com/bio-routing/tflow2/iana"
+	"github.com/bio-routing/tflow2/ifcounters"
 	"github.com/bio-routing/tflow2/ifserver"
 	"github.com/bio-routing/tflow2/intfmapper"
+	"github.com/bio-routing/tflow2/ipfix"
 	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/nf5server"
 	"github.com/bio-routing/tflow2/nfserver"
+	"github.com/bio-routing/tflow2/seqtrack"
 	"github.com/bio-routing/tflow2/sfserver"
 	"github.com/bio-routing/tflow2/srcache"
 	"github.com/bio-routing/tflow2/stats"
@@ -37,6 +42,7 @@ import (
 
 var (
 	protoNums     = flag.String("protonums", "protocol_numbers.csv", "CSV file to read protocol definitions from")
+	ipfixElements = flag.String("ipfixelements", "ipfix_information_elements.csv", "CSV file to read IPFIX information element definitions from")
 	sockReaders   = flag.Int("sockreaders", 24, "Num of go routines reading and parsing netflow packets")
 	channelBuffer = flag.Int("channelbuffer", 1024, "Size of buffer for channels")
 	dbAddWorkers  = flag.Int("dbaddworkers", 24, "Number of workers adding flows into database")
@@ -69,21 +75,47 @@ func main() {
 	// Sample Rate Cache
 	srcache := srcache.New(cfg.Agents)
 
+	// Sequence number tracking of export packets
+	seqTracker := seqtrack.New(cfg.Agents)
+
+	// Application tables of agents
+	appCache := appcache.New()
+
+	// Interface counters reported by agents
+	ifCounters := ifcounters.New()
+
+	// Netflow v5 Server
+	if *cfg.NetflowV5.Enabled {
+		nf5s := nf5server.New(*sockReaders, cfg, srcache)
+		chans = append(chans, nf5s.Output)
+	}
+
+	// Template caches of Netflow v9 and IPFIX servers
+	templateSources := make(map[string]frontend.TemplateSource)
+
 	// Netflow v9 Server
 	if *cfg.NetflowV9.Enabled {
-		nfs := nfserver.New(*sockReaders, cfg, srcache)
+		nfs := nfserver.New(*sockReaders, cfg, srcache, seqTracker, appCache)
 		chans = append(chans, nfs.Output)
+		templateSources["netflow_v9"] = nfs
 	}
 
 	// IPFIX Server
-	if *cfg.IPFIX.Enabled {
-		ifs := ifserver.New(*sockReaders, cfg, srcache)
+	if *cfg.IPFIX.Enabled || *cfg.IPFIXTCP.Enabled {
+		registry, err := ipfix.LoadRegistry(*ipfixElements)
+		if err != nil {
+			log.Errorf("Unable to load IPFIX information elements: %v", err)
+			os.Exit(1)
+		}
+
+		ifs := ifserver.New(*sockReaders, cfg, srcache, seqTracker, appCache, registry)
 		chans = append(chans, ifs.Output)
+		templateSources["ipfix"] = ifs
 	}
 
 	// sFlow Server
 	if *cfg.Sflow.Enabled {
-		sfs := sfserver.New(*sockReaders, cfg, srcache)
+		sfs := sfserver.New(*sockReaders, cfg, srcache, seqTracker, ifCounters)
 		chans = append(chans, sfs.Output)
 	}
 
@@ -118,6 +150,8 @@ func main() {
 			flowDB,
 			inftMapper,
 			iana,
+			ifCounters,
+			templateSources,
 			cfg,
 		)
 	}
@@ -31,7 +31,7 @@ function drawChart() {
                 $("#chart_div").text("No data found")
                 return
             }
-            renderChart(rdata)
+            renderChart(rdata, parseParams(query).Metric)
         },
         error: function(xhr) {
             $("#chart_div").text(xhr.responseText)
@@ -39,7 +39,14 @@ function drawChart() {
     })
 }
 
-function renderChart(rdata) {
+var chartTitles = {
+    "bytes": "NetFlow bps of top flows",
+    "packets": "NetFlow pps of top flows",
+    "flows": "NetFlow flow records of top flows",
+    "avg_packet_size": "NetFlow average packet size (bytes) of top flows"
+};
+
+function renderChart(rdata, metric) {
     pres = Papa.parse(rdata.trim())
 
     var data = [];
@@ -61,8 +68,8 @@ function renderChart(rdata) {
     data = google.visualization.arrayToDataTable(data);
 
     var options = {
-        isStacked: true,
-        title: 'NetFlow bps of top flows',
+        isStacked: metric != "avg_packet_size",
+        title: chartTitles[metric || "bytes"],
         hAxis: {
             title: 'Time',
             titleTextStyle: {
@@ -157,6 +164,10 @@ function loadAgents() {
         for (var k in data.Agents) {
             agents.push(data.Agents[k].Name);
         }
+        for (var k in data.Groups) {
+            agents.push(k);
+        }
+        agents.push("*");
 
         $("#Agent").autocomplete({
             source: agents,
@@ -208,7 +219,7 @@ function submitQuery() {
     var breakdown = []
     var query = {};
 
-    $(".in input").each(function(){
+    $(".in input, .in select").each(function(){
         var field = this.id.replace("_",".")
         var value = this.value
 